@@ -0,0 +1,422 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Cluster runs several factomd processes on this machine, networked over the loopback interface, waits for
+// them to sync, and shows their heights, leaders and peers until Ctrl+C, when it stops them.  Flags after the
+// cluster's own, following --, are given to every node.  eg:
+//
+//	$ Cluster -count=4 -leaders=3 -- -blktime=30
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/engine"
+	"github.com/FactomProject/factomd/util"
+)
+
+// A local cluster: several factomd processes on this machine, talking to each other over the p2p network on
+// the loopback interface.  Each node gets its own config file, folder and ports, and every node after the
+// first takes one of the simulator's identities, as the simulator's own nodes do.  The launcher starts the
+// nodes, waits for them to sync, makes the leaders and audit servers asked for through each node's simulator
+// API, then shows a table of the nodes until Ctrl+C, when it shuts them all down.
+
+// clusterStopWait is how long a node has to shut down before it is killed.
+var clusterStopWait = 30 * time.Second
+
+type clusterNode struct {
+	index      int
+	folder     string
+	port       int              // WSAPI
+	netPort    int              // p2p network
+	simAPIPort int              // Simulator API, for the status and making servers
+	identity   interfaces.IHash // nil for the first node, which leads from the start
+	key        *primitives.PrivateKey
+
+	cmd    *exec.Cmd
+	log    *os.File
+	exited chan bool // Closed when the process ends
+}
+
+type cluster struct {
+	factomd  string   // The factomd to run
+	password string   // The AdminPassword of every node, for the simulator API
+	args     []string // More flags for every node
+	nodes    []*clusterNode
+}
+
+// newCluster lays out count nodes in folders under dir, on ports counting up from the given ones.
+func newCluster(count int, dir string, port, netPort, simAPIPort int, factomd string, args []string) (*cluster, error) {
+	identities := engine.SimIdentityChainIDs()
+	if count < 1 || count > len(identities)+1 {
+		return nil, fmt.Errorf("a cluster has from 1 to %d nodes", len(identities)+1)
+	}
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	c := &cluster{factomd: factomd, password: hex.EncodeToString(secret), args: args}
+	for i := 0; i < count; i++ {
+		n := &clusterNode{
+			index:      i,
+			folder:     filepath.Join(dir, fmt.Sprintf("node%d", i)),
+			port:       port + i,
+			netPort:    netPort + i,
+			simAPIPort: simAPIPort + i,
+			exited:     make(chan bool),
+		}
+		if 0 < i {
+			n.identity = identities[i-1]
+			key, err := engine.SimIdentityKey(n.identity)
+			if err != nil {
+				return nil, err
+			}
+			n.key = key
+		}
+		c.nodes = append(c.nodes, n)
+	}
+	return c, nil
+}
+
+func (n *clusterNode) configFile() string {
+	return filepath.Join(n.folder, "factomd.conf")
+}
+
+// config is the node's config file.  Anything it doesn't set comes from the defaults.
+func (c *cluster) config(n *clusterNode) string {
+	out := "[app]\n"
+	out += fmt.Sprintf("HomeDir = %q\n", n.folder)
+	out += "Network = LOCAL\n"
+	out += fmt.Sprintf("LocalNetworkPort = %d\n", n.netPort)
+	out += "ControlPanelSetting = disabled\n"
+	if nil != n.identity {
+		out += "NodeMode = SERVER\n"
+		out += fmt.Sprintf("IdentityChainID = %s\n", n.identity.String())
+		out += fmt.Sprintf("LocalServerPrivKey = %s\n", n.key.PrivateKeyString())
+		out += fmt.Sprintf("LocalServerPublicKey = %s\n", n.key.PublicKeyString())
+	}
+	out += "\n[wsapi]\n"
+	out += fmt.Sprintf("PortNumber = %d\n", n.port)
+	out += fmt.Sprintf("AdminPassword = %q\n", c.password)
+	return out
+}
+
+// nodeArgs are the flags a node is run with.  Every node dials the nodes before it.
+func (c *cluster) nodeArgs(n *clusterNode) []string {
+	var peers []string
+	for _, before := range c.nodes[:n.index] {
+		peers = append(peers, fmt.Sprintf("127.0.0.1:%d", before.netPort))
+	}
+	args := []string{
+		"-config=" + n.configFile(),
+		"-count=1",
+		"-network=LOCAL",
+		"-exclusive",
+		fmt.Sprintf("-port=%d", n.port),
+		fmt.Sprintf("-networkPort=%d", n.netPort),
+		fmt.Sprintf("-simapi=%d", n.simAPIPort),
+		"-peers=" + strings.Join(peers, " "),
+	}
+	if 0 < n.index {
+		// Without a prefix, a node takes the first node's identity
+		args = append(args, fmt.Sprintf("-prefix=node%d-", n.index))
+	}
+	return append(args, c.args...)
+}
+
+// start writes the node's config and starts it, with what it prints going to factomd.log in its folder.
+func (c *cluster) start(n *clusterNode) error {
+	if err := os.MkdirAll(n.folder, 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(n.configFile(), []byte(c.config(n)), 0600); err != nil {
+		return err
+	}
+	log, err := os.Create(filepath.Join(n.folder, "factomd.log"))
+	if err != nil {
+		return err
+	}
+	n.log = log
+	n.cmd = exec.Command(c.factomd, c.nodeArgs(n)...)
+	n.cmd.Stdout = log
+	n.cmd.Stderr = log
+	if err := n.cmd.Start(); err != nil {
+		log.Close()
+		return err
+	}
+	go func() {
+		n.cmd.Wait()
+		n.log.Close()
+		close(n.exited)
+	}()
+	return nil
+}
+
+func (n *clusterNode) running() bool {
+	select {
+	case <-n.exited:
+		return false
+	default:
+		return nil != n.cmd
+	}
+}
+
+// stop interrupts every node, as Ctrl+C would, and kills those that haven't stopped in clusterStopWait.
+func (c *cluster) stop() {
+	for _, n := range c.nodes {
+		if n.running() {
+			n.cmd.Process.Signal(os.Interrupt)
+		}
+	}
+	deadline := time.After(clusterStopWait)
+	for _, n := range c.nodes {
+		if nil == n.cmd {
+			continue
+		}
+		select {
+		case <-n.exited:
+		case <-deadline:
+			fmt.Printf("Node %d did not stop, killing it\n", n.index)
+			n.cmd.Process.Kill()
+			<-n.exited
+		}
+	}
+}
+
+// simAPI calls a node's simulator API, and decodes what it returns into result.
+func (c *cluster) simAPI(n *clusterNode, method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if nil != body {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("http://127.0.0.1:%d%s", n.simAPIPort, path), reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("cluster", c.password)
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if http.StatusOK != resp.StatusCode {
+		failed := map[string]string{}
+		json.NewDecoder(resp.Body).Decode(&failed)
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, failed["error"])
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// simNode is what a node's simulator API says of one of its nodes.
+type simNode struct {
+	Name         string `json:"name"`
+	Identity     string `json:"identity"`
+	Role         string `json:"role"` // leader, audit or follower
+	SavedHeight  uint32 `json:"savedheight"`
+	LeaderHeight uint32 `json:"leaderheight"`
+	Peers        int    `json:"peers"`
+}
+
+// clusterStatus is what a node says of itself, or why it couldn't be asked.
+type clusterStatus struct {
+	simNode
+	Err error
+}
+
+func (c *cluster) status() []clusterStatus {
+	statuses := make([]clusterStatus, len(c.nodes))
+	for i, n := range c.nodes {
+		if !n.running() {
+			statuses[i].Err = errors.New("exited")
+			continue
+		}
+		var nodes []simNode
+		if err := c.simAPI(n, "GET", "/nodes", nil, &nodes); err != nil {
+			statuses[i].Err = err
+		} else if 0 == len(nodes) {
+			statuses[i].Err = errors.New("no nodes")
+		} else {
+			statuses[i].simNode = nodes[0]
+		}
+	}
+	return statuses
+}
+
+// clusterSynced returns true once every node is up, connected, and has saved the same block, past the first.
+func clusterSynced(statuses []clusterStatus) bool {
+	for _, s := range statuses {
+		if nil != s.Err ||
+			s.SavedHeight < 1 ||
+			s.SavedHeight != statuses[0].SavedHeight ||
+			(1 < len(statuses) && 0 == s.Peers) {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForSync waits for the nodes to sync, printing the table every so often.  It gives up if a node exits,
+// the timeout passes, or a stop comes in.
+func (c *cluster) waitForSync(timeout time.Duration, every time.Duration, stop chan os.Signal) error {
+	deadline := time.Now().Add(timeout)
+	shown := time.Now()
+	for {
+		statuses := c.status()
+		if clusterSynced(statuses) {
+			return nil
+		}
+		for _, n := range c.nodes {
+			if !n.running() {
+				return fmt.Errorf("node %d exited, see %s", n.index, filepath.Join(n.folder, "factomd.log"))
+			}
+		}
+		if time.Now().After(deadline) {
+			writeClusterStatus(os.Stdout, c, statuses)
+			return fmt.Errorf("the nodes did not sync in %s", timeout)
+		}
+		if every <= time.Since(shown) {
+			writeClusterStatus(os.Stdout, c, statuses)
+			shown = time.Now()
+		}
+		select {
+		case <-stop:
+			return errors.New("stopped")
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// promote makes nodes 1 to leaders-1 leaders, and the next audits nodes audit servers.
+func (c *cluster) promote(leaders, audits int) error {
+	if leaders < 1 || leaders+audits > len(c.nodes) {
+		return fmt.Errorf("can't make %d leaders and %d audit servers of %d nodes", leaders, audits, len(c.nodes))
+	}
+	for _, n := range c.nodes[1 : leaders+audits] {
+		role := "leader"
+		if n.index >= leaders {
+			role = "audit"
+		}
+		var result simNode
+		if err := c.simAPI(n, "POST", "/server", map[string]interface{}{"node": 0, "role": role}, &result); err != nil {
+			return fmt.Errorf("node %d: %v", n.index, err)
+		}
+		fmt.Printf("Making node %d %s\n", n.index, map[string]string{"leader": "a leader", "audit": "an audit server"}[role])
+	}
+	return nil
+}
+
+// writeClusterStatus writes a table of the nodes, and a line on how they agree.
+func writeClusterStatus(w io.Writer, c *cluster, statuses []clusterStatus) {
+	out := fmt.Sprintf("%4s %-16s %6s %6s %8s %8s %-9s %5s %s\n", "Node", "Name", "WSAPI", "P2P", "Saved", "Leader", "Role", "Peers", "Identity")
+	leaders, audits := 0, 0
+	var low, high uint32
+	up := 0
+	for i, s := range statuses {
+		n := c.nodes[i]
+		if nil != s.Err {
+			out += fmt.Sprintf("%4d %-16s %6d %6d %s\n", n.index, "", n.port, n.netPort, s.Err)
+			continue
+		}
+		switch s.Role {
+		case "leader":
+			leaders++
+		case "audit":
+			audits++
+		}
+		if 0 == up || s.SavedHeight < low {
+			low = s.SavedHeight
+		}
+		if s.SavedHeight > high {
+			high = s.SavedHeight
+		}
+		up++
+		identity := s.Identity
+		if 10 < len(identity) {
+			identity = identity[:10]
+		}
+		out += fmt.Sprintf("%4d %-16s %6d %6d %8d %8d %-9s %5d %s\n",
+			n.index, s.Name, n.port, n.netPort, s.SavedHeight, s.LeaderHeight, s.Role, s.Peers, identity)
+	}
+	out += fmt.Sprintf("%d of %d nodes up, saved heights %d to %d, %d leaders, %d audit servers\n\n",
+		up, len(statuses), low, high, leaders, audits)
+	io.WriteString(w, out)
+}
+
+func main() {
+	countPtr := flag.Int("count", 3, "The number of factomd processes to run")
+	leadersPtr := flag.Int("leaders", 1, "The number of nodes to make leaders, starting with the first")
+	auditsPtr := flag.Int("audits", 0, "The number of nodes after the leaders to make audit servers")
+	dirPtr := flag.String("dir", filepath.Join(util.GetHomeDir(), ".factom", "cluster"), "Folder for the nodes' configs, databases and logs, a folder each")
+	factomdPtr := flag.String("factomd", "factomd", "The factomd to run")
+	portPtr := flag.Int("port", 8088, "WSAPI port of the first node; the others count up from it")
+	networkPortPtr := flag.Int("networkPort", 8110, "p2p port of the first node; the others count up from it")
+	simAPIPortPtr := flag.Int("simapi", 8190, "Simulator API port of the first node; the others count up from it")
+	syncTimeoutPtr := flag.Duration("synctimeout", 5*time.Minute, "How long to wait for the nodes to sync before giving up")
+	refreshPtr := flag.Duration("refresh", 10*time.Second, "How often to show the status of the nodes")
+	flag.Parse()
+
+	c, err := newCluster(*countPtr, *dirPtr, *portPtr, *networkPortPtr, *simAPIPortPtr, *factomdPtr, flag.Args())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+
+	exitCode := 0
+	for _, n := range c.nodes {
+		fmt.Printf("Starting node %d: %s %s\n", n.index, c.factomd, strings.Join(c.nodeArgs(n), " "))
+		if err := c.start(n); err != nil {
+			fmt.Printf("Could not start node %d: %v\n", n.index, err)
+			c.stop()
+			os.Exit(1)
+		}
+	}
+
+	fmt.Println("Waiting for the nodes to sync...")
+	if err = c.waitForSync(*syncTimeoutPtr, *refreshPtr, stop); err == nil {
+		err = c.promote(*leadersPtr, *auditsPtr)
+	}
+	if err != nil {
+		fmt.Println(err)
+		exitCode = 1
+	} else {
+		fmt.Println("The nodes are in sync.  Ctrl+C to stop them.")
+	status:
+		for {
+			writeClusterStatus(os.Stdout, c, c.status())
+			select {
+			case <-stop:
+				break status
+			case <-time.After(*refreshPtr):
+			}
+		}
+	}
+
+	fmt.Println("Stopping the nodes...")
+	c.stop()
+	os.Exit(exitCode)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/factomd/engine"
+)
+
+func TestClusterLayout(t *testing.T) {
+	c, err := newCluster(3, "/tmp/cluster", 9000, 9100, 9200, "factomd", []string{"-blktime=30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newCluster(len(engine.SimIdentityChainIDs())+2, "/tmp/cluster", 9000, 9100, 9200, "factomd", nil); err == nil {
+		t.Errorf("Expected an error for more nodes than identities")
+	}
+
+	n := c.nodes[2]
+	if 9002 != n.port || 9102 != n.netPort || 9202 != n.simAPIPort || "/tmp/cluster/node2" != n.folder {
+		t.Errorf("Node 2 laid out as %+v", n)
+	}
+	args := strings.Join(c.nodeArgs(n), " ")
+	for _, want := range []string{"-config=/tmp/cluster/node2/factomd.conf", "-peers=127.0.0.1:9100 127.0.0.1:9101", "-prefix=node2-", "-simapi=9202", "-blktime=30"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Node 2's flags lack %s: %s", want, args)
+		}
+	}
+	if strings.Contains(strings.Join(c.nodeArgs(c.nodes[0]), " "), "-prefix") {
+		t.Errorf("Node 0 must keep the leader's identity")
+	}
+
+	// Every node after the first takes a simulator identity, with its key, and they all share the password.
+	if strings.Contains(c.config(c.nodes[0]), "IdentityChainID") {
+		t.Errorf("Node 0 has an identity in its config")
+	}
+	config := c.config(n)
+	key, _ := engine.SimIdentityKey(engine.SimIdentityChainIDs()[1])
+	for _, want := range []string{"IdentityChainID = " + engine.SimIdentityChainIDs()[1].String(), "LocalServerPrivKey = " + key.PrivateKeyString(), "PortNumber = 9002", `AdminPassword = "` + c.password + `"`} {
+		if !strings.Contains(config, want) {
+			t.Errorf("Node 2's config lacks %s:\n%s", want, config)
+		}
+	}
+}
+
+func TestClusterStatus(t *testing.T) {
+	c, _ := newCluster(2, "/tmp/cluster", 9000, 9100, 9200, "factomd", nil)
+	servers := []string{}
+	for i, n := range c.nodes {
+		i := i
+		mux := http.NewServeMux()
+		mux.HandleFunc("/nodes", func(w http.ResponseWriter, r *http.Request) {
+			if _, password, _ := r.BasicAuth(); password != c.password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode([]simNode{{Name: "FNode" + strconv.Itoa(i), SavedHeight: 5, Role: "follower", Peers: 1}})
+		})
+		mux.HandleFunc("/server", func(w http.ResponseWriter, r *http.Request) {
+			servers = append(servers, r.URL.Path+strconv.Itoa(i))
+			json.NewEncoder(w).Encode(simNode{})
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+		n.simAPIPort, _ = strconv.Atoi(port)
+		n.cmd = new(exec.Cmd) // Running, as far as the launcher can tell
+	}
+
+	statuses := c.status()
+	if !clusterSynced(statuses) {
+		t.Errorf("Expected the nodes to be in sync: %+v", statuses)
+	}
+	statuses[1].SavedHeight = 4
+	if clusterSynced(statuses) {
+		t.Errorf("Nodes at different heights are not in sync")
+	}
+
+	close(c.nodes[1].exited)
+	statuses = c.status()
+	if nil == statuses[1].Err || clusterSynced(statuses) {
+		t.Errorf("Expected node 1 to be down: %+v", statuses)
+	}
+	var out bytes.Buffer
+	writeClusterStatus(&out, c, statuses)
+	if !strings.Contains(out.String(), "FNode0") || !strings.Contains(out.String(), "exited") || !strings.Contains(out.String(), "1 of 2 nodes up") {
+		t.Errorf("Status table:\n%s", out.String())
+	}
+
+	if err := c.promote(1, 2); err == nil {
+		t.Errorf("Expected an error for more servers than nodes")
+	}
+	if err := c.promote(1, 1); err != nil || 1 != len(servers) || "/server1" != servers[0] {
+		t.Errorf("Expected node 1 made an audit server, got %v %v", servers, err)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// JournalConverter writes a journal in the old text format (journalN.log) as a binary journal, with its index,
+// so it can be replayed from a height with factomd -journal=FILE -journalfrom=H.  eg:
+//
+//	$ JournalConverter journal0.log journal0.jnl
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/FactomProject/factomd/state"
+)
+
+func main() {
+	sizePtr := flag.Int("size", 64, "Megabytes each file of the binary journal grows to before it goes on in the next.  0 is unlimited.")
+	flag.Parse()
+	if 2 != flag.NArg() {
+		fmt.Println("Usage: JournalConverter [-size=MB] TEXTJOURNAL BINARYJOURNAL")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	out, err := state.CreateJournal(flag.Arg(1), int64(*sizePtr)*1024*1024)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	n, err := state.ConvertTextJournal(bufio.NewReaderSize(f, 64*1024), out)
+	if cerr := out.Close(); nil == err {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Converted %d messages to %s\n", n, flag.Arg(1))
+}
@@ -0,0 +1,505 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// LoadGenerator pushes new chains, entries and factoid transactions through a local factomd's V2 API at the
+// rates given, then reports how many were acknowledged and made it into a block, and how long that took.  It
+// pays with the simulator's funded factoid address, so factomd must be on a LOCAL network.  eg:
+//
+//	$ LoadGenerator -chains=1 -entries=20 -entrysize=1024 -factoids=5 -duration=30m
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/engine"
+	"github.com/FactomProject/factomd/wsapi"
+)
+
+// A load generator.  It pushes a steady stream of new chains, entries and factoid transactions through a local
+// factomd's V2 API, and follows each until it makes it into a directory block, to measure how long it takes to
+// be acknowledged and to be included.  It buys entry credits for its own addresses from the simulator's funded
+// factoid address, as the simulator's fundWallet does, so the node must be on a LOCAL network.
+
+const (
+	loadChain   = "chain"
+	loadEntry   = "entry"
+	loadFactoid = "factoid"
+)
+
+var loadKinds = []string{loadChain, loadEntry, loadFactoid}
+
+// errLoadNoChain is returned for an entry when no chain has been acknowledged to put it in yet.
+var errLoadNoChain = errors.New("No chain to put entries in yet")
+
+type loadItem struct {
+	kind      string
+	method    string // The V2 method reporting its status, factoid-ack or entry-ack
+	ack       wsapi.AckRequest
+	chainID   string // Of a chain
+	submitted time.Time
+	acked     time.Time
+	included  time.Time // In a directory block
+	failed    bool      // Refused by the node, or found invalid
+}
+
+type loader struct {
+	sync.Mutex
+	port      int
+	entrySize int           // Bytes of content in each entry
+	timeout   time.Duration // How long an item has to make it into a block
+	rate      uint64        // Factoshis per entry credit
+	ecs       []*factom.ECAddress
+	next      int      // The entry credit address to pay with next
+	chains    []string // Chains acknowledged, to put entries in
+	items     []*loadItem
+	errs      int
+	lastErr   error
+	rand      *rand.Rand
+}
+
+func newLoader(port int, addresses int, entrySize int, timeout time.Duration) (*loader, error) {
+	l := &loader{port: port, entrySize: entrySize, timeout: timeout, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	for i := 0; i < addresses; i++ {
+		sec := make([]byte, 32)
+		if _, err := crand.Read(sec); err != nil {
+			return nil, err
+		}
+		ec, err := factom.MakeECAddress(sec)
+		if err != nil {
+			return nil, err
+		}
+		l.ecs = append(l.ecs, ec)
+	}
+	return l, nil
+}
+
+// call makes a V2 API request of the node, and unmarshals the result into result, if not nil.
+func (l *loader) call(method string, params interface{}, result interface{}) error {
+	resp, err := engine.V2Request(primitives.NewJSON2Request(method, 0, params), l.port)
+	if err != nil {
+		return err
+	}
+	if nil != resp.Error {
+		return fmt.Errorf("%s: %s", method, resp.Error.Message)
+	}
+	if nil == result {
+		return nil
+	}
+	return wsapi.MapToObject(resp.Result, result)
+}
+
+// fund buys credits entry credits for each of the loader's addresses, and waits for the node to credit them.
+func (l *loader) fund(credits uint64, timeout time.Duration) error {
+	rate := new(wsapi.EntryCreditRateResponse)
+	if err := l.call("entry-credit-rate", nil, rate); err != nil {
+		return err
+	}
+	l.rate = uint64(rate.Rate)
+	for _, ec := range l.ecs {
+		trans, err := engine.SimFactoidTransaction(ec.PubBytes(), credits*l.rate, true, l.rate)
+		if err != nil {
+			return err
+		}
+		data, _ := trans.MarshalBinary()
+		if err := l.call("factoid-submit", &wsapi.TransactionRequest{Transaction: hex.EncodeToString(data)}, nil); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, ec := range l.ecs {
+		for {
+			balance := new(wsapi.EntryCreditBalanceResponse)
+			err := l.call("entry-credit-balance", &wsapi.AddressRequest{Address: hex.EncodeToString(ec.PubBytes())}, balance)
+			if err == nil && 0 < balance.Balance {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("The entry credits bought for %s did not arrive within %s", ec.PubString(), timeout)
+			}
+			time.Sleep(time.Second)
+		}
+	}
+	return nil
+}
+
+// ec returns the entry credit address to pay with next, going round them all.
+func (l *loader) ec() *factom.ECAddress {
+	l.Lock()
+	defer l.Unlock()
+	ec := l.ecs[l.next%len(l.ecs)]
+	l.next++
+	return ec
+}
+
+// newEntry returns an entry of the loader's size, with ExtIDs to make it unique.
+func (l *loader) newEntry(chainID string) *factom.Entry {
+	l.Lock()
+	defer l.Unlock()
+	e := new(factom.Entry)
+	e.ChainID = chainID
+	e.ExtIDs = [][]byte{[]byte("load"), []byte(strconv.FormatInt(time.Now().UnixNano(), 10)), []byte(strconv.FormatInt(l.rand.Int63(), 16))}
+	e.Content = make([]byte, l.entrySize)
+	l.rand.Read(e.Content)
+	return e
+}
+
+func (l *loader) submitChain() error {
+	c := factom.NewChain(l.newEntry(""))
+	com, rev := engine.GetMessageStringChain(c, l.ec())
+	if 0 == len(com) {
+		return errors.New("Could not compose the chain")
+	}
+	item := &loadItem{kind: loadChain, method: "entry-ack", ack: wsapi.AckRequest{FullTransaction: com}, chainID: c.ChainID}
+	item.submitted = time.Now()
+	err := l.call("commit-chain", &wsapi.MessageRequest{Message: com}, nil)
+	if err == nil {
+		err = l.call("reveal-chain", &wsapi.EntryRequest{Entry: rev}, nil)
+	}
+	return l.add(item, err)
+}
+
+func (l *loader) submitEntry() error {
+	l.Lock()
+	if 0 == len(l.chains) {
+		l.Unlock()
+		return errLoadNoChain
+	}
+	chainID := l.chains[l.rand.Intn(len(l.chains))]
+	l.Unlock()
+
+	com, rev := engine.GetMessageStringEntry(l.newEntry(chainID), l.ec())
+	if 0 == len(com) {
+		return errors.New("Could not compose the entry")
+	}
+	item := &loadItem{kind: loadEntry, method: "entry-ack", ack: wsapi.AckRequest{FullTransaction: com}}
+	item.submitted = time.Now()
+	err := l.call("commit-entry", &wsapi.MessageRequest{Message: com}, nil)
+	if err == nil {
+		err = l.call("reveal-entry", &wsapi.EntryRequest{Entry: rev}, nil)
+	}
+	return l.add(item, err)
+}
+
+// submitFactoid sends a few thousand factoshis from the simulator's factoid address to a new one.
+func (l *loader) submitFactoid() error {
+	out := make([]byte, 32)
+	l.Lock()
+	l.rand.Read(out)
+	amt := 1000 + uint64(l.rand.Intn(9000))
+	l.Unlock()
+
+	trans, err := engine.SimFactoidTransaction(out, amt, false, l.rate)
+	if err != nil {
+		return err
+	}
+	data, _ := trans.MarshalBinary()
+	item := &loadItem{kind: loadFactoid, method: "factoid-ack", ack: wsapi.AckRequest{TxID: trans.GetSigHash().String()}}
+	item.submitted = time.Now()
+	err = l.call("factoid-submit", &wsapi.TransactionRequest{Transaction: hex.EncodeToString(data)}, nil)
+	return l.add(item, err)
+}
+
+// add records an item submitted, and if the node refused it, why.
+func (l *loader) add(item *loadItem, err error) error {
+	l.Lock()
+	defer l.Unlock()
+	if err != nil {
+		item.failed = true
+		l.errs++
+		l.lastErr = err
+	}
+	l.items = append(l.items, item)
+	return err
+}
+
+// pending returns the items still to make it into a block, and not yet given up on.
+func (l *loader) pending(now time.Time) []*loadItem {
+	l.Lock()
+	defer l.Unlock()
+	var items []*loadItem
+	for _, item := range l.items {
+		if !item.failed && item.included.IsZero() && now.Sub(item.submitted) < l.timeout {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadPollers is how many of the node's V2 requests poll makes at a time.
+const loadPollers = 16
+
+// poll asks the node how each pending item is getting on, several at a time.  What the node reports is
+// stamped with the time the round started, so the latencies are to within the time between rounds, which is
+// -poll plus however long the round before took.
+func (l *loader) poll() {
+	pending := l.pending(time.Now())
+	start := time.Now()
+	items := make(chan *loadItem)
+	var pollers sync.WaitGroup
+	for i := 0; i < loadPollers && i < len(pending); i++ {
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			for item := range items {
+				if status, err := l.status(item); err == nil {
+					l.update(item, status, start)
+				}
+			}
+		}()
+	}
+	for _, item := range pending {
+		items <- item
+	}
+	close(items)
+	pollers.Wait()
+}
+
+// status asks the node the status of an item.
+func (l *loader) status(item *loadItem) (string, error) {
+	if "factoid-ack" == item.method {
+		ack := new(wsapi.FactoidTxStatus)
+		if err := l.call(item.method, &item.ack, ack); err != nil {
+			return "", err
+		}
+		return ack.Status, nil
+	}
+	ack := new(wsapi.EntryStatus)
+	if err := l.call(item.method, &item.ack, ack); err != nil {
+		return "", err
+	}
+	return ack.EntryData.Status, nil
+}
+
+// update records an item's status, as the node reported it at now.
+func (l *loader) update(item *loadItem, status string, now time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	wasAcked := !item.acked.IsZero()
+	switch status {
+	case wsapi.AckStatusInvalid:
+		item.failed = true
+	case wsapi.AckStatusACK, wsapi.AckStatus1Minute:
+		if !wasAcked {
+			item.acked = now
+		}
+	case wsapi.AckStatusDBlockConfirmed:
+		if !wasAcked {
+			item.acked = now
+		}
+		item.included = now
+	}
+	if loadChain == item.kind && !wasAcked && !item.acked.IsZero() {
+		l.chains = append(l.chains, item.chainID)
+	}
+}
+
+type loadStats struct {
+	Kind      string
+	Submitted int
+	Acked     int
+	Included  int
+	Failed    int
+	Pending   int // Still to make it into a block
+	TimedOut  int // Not in a block within the timeout
+	Ack       []time.Duration
+	Block     []time.Duration
+}
+
+type loadDurations []time.Duration
+
+func (d loadDurations) Len() int           { return len(d) }
+func (d loadDurations) Less(i, j int) bool { return d[i] < d[j] }
+func (d loadDurations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// stats sums up the items of each kind, as of now.  The latencies are sorted.
+func (l *loader) stats(now time.Time) []*loadStats {
+	l.Lock()
+	defer l.Unlock()
+	byKind := make(map[string]*loadStats)
+	var all []*loadStats
+	for _, kind := range loadKinds {
+		byKind[kind] = &loadStats{Kind: kind}
+		all = append(all, byKind[kind])
+	}
+	for _, item := range l.items {
+		s := byKind[item.kind]
+		s.Submitted++
+		if !item.acked.IsZero() {
+			s.Acked++
+			s.Ack = append(s.Ack, item.acked.Sub(item.submitted))
+		}
+		switch {
+		case !item.included.IsZero():
+			s.Included++
+			s.Block = append(s.Block, item.included.Sub(item.submitted))
+		case item.failed:
+			s.Failed++
+		case now.Sub(item.submitted) < l.timeout:
+			s.Pending++
+		default:
+			s.TimedOut++
+		}
+	}
+	for _, s := range all {
+		sort.Sort(loadDurations(s.Ack))
+		sort.Sort(loadDurations(s.Block))
+	}
+	return all
+}
+
+// percentile returns the pth percentile, by nearest rank, of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if 0 == len(sorted) {
+		return 0
+	}
+	i := int(p/100*float64(len(sorted))+0.999999) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func loadLatencies(sorted []time.Duration) string {
+	if 0 == len(sorted) {
+		return fmt.Sprintf("%8s %8s %8s %8s", "-", "-", "-", "-")
+	}
+	out := ""
+	for _, p := range []float64{50, 90, 99, 100} {
+		out += fmt.Sprintf(" %8s", percentile(sorted, p)/time.Millisecond*time.Millisecond)
+	}
+	return out[1:]
+}
+
+// writeLoadStats writes a table of what was submitted over elapsed, how much of it was acknowledged and made it
+// into a block, and how long that took.
+func writeLoadStats(w io.Writer, elapsed time.Duration, stats []*loadStats) {
+	out := fmt.Sprintf("%-8s %9s %7s %7s %8s %6s %7s %8s | %-35s | %-35s\n", "Kind", "Submitted", "Per sec", "Acked", "In block", "Failed", "Pending", "Timedout",
+		"Acknowledged p50 p90 p99 max", "In a block p50 p90 p99 max")
+	for _, s := range stats {
+		perSec := 0.0
+		if 0 < elapsed {
+			perSec = float64(s.Submitted) / elapsed.Seconds()
+		}
+		out += fmt.Sprintf("%-8s %9d %7.2f %7d %8d %6d %7d %8d | %-35s | %-35s\n", s.Kind, s.Submitted, perSec, s.Acked, s.Included, s.Failed, s.Pending, s.TimedOut,
+			loadLatencies(s.Ack), loadLatencies(s.Block))
+	}
+	io.WriteString(w, out)
+}
+
+// generate calls submit perSec times a second until stop is closed.
+func (l *loader) generate(perSec float64, submit func() error, stop chan bool, done *sync.WaitGroup) {
+	defer done.Done()
+	if perSec <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / perSec))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			submit()
+		}
+	}
+}
+
+func main() {
+	portPtr := flag.Int("port", 8088, "WSAPI port of the factomd to load")
+	chainsPtr := flag.Float64("chains", 0.2, "New chains a second")
+	entriesPtr := flag.Float64("entries", 2, "New entries a second, into the chains made")
+	entrySizePtr := flag.Int("entrysize", 512, "Bytes of content in each entry")
+	factoidsPtr := flag.Float64("factoids", 1, "Factoid transactions a second")
+	addressesPtr := flag.Int("ecaddresses", 4, "Entry credit addresses to pay for the chains and entries")
+	creditsPtr := flag.Uint64("credits", 100000, "Entry credits to buy for each address")
+	durationPtr := flag.Duration("duration", 10*time.Minute, "How long to generate load.  Ctrl+C stops early.")
+	timeoutPtr := flag.Duration("timeout", 5*time.Minute, "How long a submission has to make it into a block")
+	pollPtr := flag.Duration("poll", time.Second, "How often to ask the node how the submissions are getting on.  The latencies are to within this.")
+	reportPtr := flag.Duration("report", 30*time.Second, "How often to show the figures so far")
+	flag.Parse()
+
+	if *entrySizePtr < 0 || *entrySizePtr > 10000 {
+		fmt.Println("The content of an entry must be from 0 to 10000 bytes")
+		os.Exit(1)
+	}
+	l, err := newLoader(*portPtr, *addressesPtr, *entrySizePtr, *timeoutPtr)
+	if err == nil && 0 == len(l.ecs) {
+		err = errors.New("At least one entry credit address is needed")
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Buying %d entry credits for each of %d addresses...\n", *creditsPtr, len(l.ecs))
+	if err := l.fund(*creditsPtr, *timeoutPtr); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	stop := make(chan bool)
+	var generators sync.WaitGroup
+	generators.Add(3)
+	go l.generate(*chainsPtr, l.submitChain, stop, &generators)
+	go l.generate(*entriesPtr, l.submitEntry, stop, &generators)
+	go l.generate(*factoidsPtr, l.submitFactoid, stop, &generators)
+
+	fmt.Printf("Generating load for %s.  Ctrl+C to stop.\n", *durationPtr)
+	start := time.Now()
+	end := time.After(*durationPtr)
+	report := time.Now().Add(*reportPtr)
+load:
+	for {
+		select {
+		case <-interrupt:
+			break load
+		case <-end:
+			break load
+		case <-time.After(*pollPtr):
+		}
+		l.poll()
+		if time.Now().After(report) {
+			writeLoadStats(os.Stdout, time.Since(start), l.stats(time.Now()))
+			report = time.Now().Add(*reportPtr)
+		}
+	}
+	close(stop)
+	generators.Wait()
+	elapsed := time.Since(start)
+
+	// Give what was submitted its chance to make it into a block.
+	fmt.Println("Waiting for the submissions to make it into blocks...")
+wait:
+	for 0 < len(l.pending(time.Now())) {
+		select {
+		case <-interrupt:
+			break wait
+		case <-time.After(*pollPtr):
+		}
+		l.poll()
+	}
+	writeLoadStats(os.Stdout, elapsed, l.stats(time.Now()))
+	if nil != l.lastErr {
+		fmt.Printf("%d submissions refused, the last with: %v\n", l.errs, l.lastErr)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/wsapi"
+)
+
+func TestLoadPercentile(t *testing.T) {
+	var d []time.Duration
+	if 0 != percentile(d, 50) {
+		t.Errorf("Expected 0 for no durations")
+	}
+	for i := 1; i <= 100; i++ {
+		d = append(d, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 90: 90 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond, 0: time.Millisecond} {
+		if got := percentile(d, p); want != got {
+			t.Errorf("Percentile %v is %s, expected %s", p, got, want)
+		}
+	}
+}
+
+// testV2Node answers the V2 requests the load generator makes.  Each factoid transaction is acknowledged on
+// the first ask, and in a block on the second.
+type testV2Node struct {
+	sync.Mutex
+	submitted []string
+	asked     map[string]int
+}
+
+func (n *testV2Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.Lock()
+	defer n.Unlock()
+	req := new(primitives.JSON2Request)
+	json.NewDecoder(r.Body).Decode(req)
+	resp := primitives.NewJSON2Response()
+	switch req.Method {
+	case "entry-credit-rate":
+		resp.Result = &wsapi.EntryCreditRateResponse{Rate: 1000}
+	case "entry-credit-balance":
+		resp.Result = &wsapi.EntryCreditBalanceResponse{Balance: 100}
+	case "factoid-submit":
+		n.submitted = append(n.submitted, req.Method)
+		resp.Result = &wsapi.FactoidSubmitResponse{}
+	case "factoid-ack":
+		ack := new(wsapi.AckRequest)
+		wsapi.MapToObject(req.Params, ack)
+		n.asked[ack.TxID]++
+		status := new(wsapi.FactoidTxStatus)
+		status.Status = wsapi.AckStatusACK
+		if 1 < n.asked[ack.TxID] {
+			status.Status = wsapi.AckStatusDBlockConfirmed
+		}
+		resp.Result = status
+	default:
+		resp.Error = primitives.NewJSONError(-32601, "Method not found", nil)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestLoad(t *testing.T) {
+	node := &testV2Node{asked: make(map[string]int)}
+	mux := http.NewServeMux()
+	mux.Handle("/v2", node)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	portNumber, _ := strconv.Atoi(port)
+
+	l, err := newLoader(portNumber, 2, 100, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.fund(10, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if 1000 != l.rate || 2 != len(node.submitted) {
+		t.Fatalf("Expected the rate 1000 and 2 purchases, got %d %v", l.rate, node.submitted)
+	}
+	// More than are polled at a time.
+	factoids := 2*loadPollers + 3
+	for i := 0; i < factoids; i++ {
+		if err := l.submitFactoid(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.submitEntry(); err != errLoadNoChain {
+		t.Errorf("Expected no entries before a chain is acknowledged, got %v", err)
+	}
+
+	l.poll()
+	stats := l.stats(time.Now())
+	if s := stats[2]; loadFactoid != s.Kind || factoids != s.Submitted || factoids != s.Acked || 0 != s.Included || factoids != s.Pending {
+		t.Errorf("After the first poll, %+v", s)
+	}
+	if s := stats[2]; s.Ack[0] < 0 {
+		t.Errorf("Acknowledged before being submitted, %v", s.Ack)
+	}
+	l.poll()
+	stats = l.stats(time.Now())
+	if s := stats[2]; factoids != s.Included || 0 != s.Pending || factoids != len(s.Block) || s.Block[0] < s.Ack[0] {
+		t.Errorf("After the second poll, %+v", s)
+	}
+	if 0 != len(l.pending(time.Now())) {
+		t.Errorf("Expected nothing pending")
+	}
+
+	// A chain takes entries once it is acknowledged.
+	chain := &loadItem{kind: loadChain, chainID: "abc", submitted: time.Now()}
+	l.add(chain, nil)
+	l.update(chain, wsapi.AckStatusNotConfirmed, time.Now())
+	if 0 != len(l.chains) {
+		t.Errorf("A chain not yet acknowledged was taken for entries")
+	}
+	l.update(chain, wsapi.AckStatusACK, time.Now())
+	l.update(chain, wsapi.AckStatusDBlockConfirmed, time.Now())
+	if 1 != len(l.chains) || "abc" != l.chains[0] {
+		t.Errorf("Expected the chain taken for entries once, got %v", l.chains)
+	}
+
+	// Refused and timed out submissions.
+	l.add(&loadItem{kind: loadEntry, submitted: time.Now()}, errLoadNoChain)
+	l.add(&loadItem{kind: loadEntry, submitted: time.Now().Add(-2 * time.Minute)}, nil)
+	stats = l.stats(time.Now())
+	if s := stats[1]; 2 != s.Submitted || 1 != s.Failed || 1 != s.TimedOut || 1 != l.errs {
+		t.Errorf("Entries %+v", s)
+	}
+
+	var out bytes.Buffer
+	writeLoadStats(&out, 3*time.Second, stats)
+	if !strings.Contains(out.String(), "factoid") || !strings.Contains(out.String(), "0.33") {
+		t.Errorf("Stats table:\n%s", out.String())
+	}
+}
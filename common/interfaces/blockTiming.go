@@ -0,0 +1,33 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package interfaces
+
+// BlockTiming records how the production of one Directory Block went.
+// Times of events are in milliseconds from the start of the block;
+// durations of work are in microseconds.
+type BlockTiming struct {
+	DBHeight   uint32           `json:"dbheight"`
+	Start      int64            `json:"start"` // Unix time in milliseconds the block started
+	Minutes    [10]MinuteTiming `json:"minutes"`
+	DBSigs     int64            `json:"dbsigs"`     // When the DBSigs for this block were all processed.  0 until then.
+	SaveMicro  int64            `json:"savemicro"`  // Time spent in SaveDBStateToDB
+	MissingCnt int              `json:"missingcnt"` // Missing messages asked for during the block
+	ResendCnt  int              `json:"resendcnt"`  // Messages resent during the block
+	ExpireCnt  int              `json:"expirecnt"`  // Messages expired during the block
+}
+
+type MinuteTiming struct {
+	EOMs         []int64 `json:"eoms"`         // When each VM's EOM was processed.  0 if not yet.
+	ProcessMicro int64   `json:"processmicro"` // Time spent in ProcessList.Process during the minute
+}
+
+// Copy returns a BlockTiming that shares nothing with this one.
+func (b *BlockTiming) Copy() BlockTiming {
+	c := *b
+	for i := range b.Minutes {
+		c.Minutes[i].EOMs = append([]int64(nil), b.Minutes[i].EOMs...)
+	}
+	return c
+}
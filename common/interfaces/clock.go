@@ -0,0 +1,15 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package interfaces
+
+import (
+	"time"
+)
+
+// IClock is where the time comes from: the wall clock, or the simulator's virtual clock.
+type IClock interface {
+	Now() time.Time
+	Sleep(d time.Duration) // Returns once the clock has moved on by d
+}
@@ -194,6 +194,11 @@ type DBOverlay interface {
 
 	FetchPaidFor(hash IHash) (IHash, error)
 
+	//******************************Replay**********************************//
+
+	SaveReplay(replay BinaryMarshallable) error
+	FetchReplay(dst BinaryMarshallable) (BinaryMarshallable, error)
+
 	FetchFactoidTransaction(hash IHash) (ITransaction, error)
 	FetchECTransaction(hash IHash) (IECBlockEntry, error)
 }
@@ -71,6 +71,7 @@ type IState interface {
 	TimerMsgQueue() chan IMsg
 	NetworkOutMsgQueue() chan IMsg
 	NetworkInvalidMsgQueue() chan IMsg
+	NetworkUsefulMsgQueue() chan IMsg
 
 	// Journalling
 	JournalMessage(IMsg)
@@ -124,6 +125,10 @@ type IState interface {
 	// ============
 	SetPort(int)
 	GetPort() int
+	GetAdminPassword() string // Password for the admin API methods; empty disables them
+	IsShuttingDown() bool     // True once a shutdown has begun; submissions are refused
+	FindInReplay(hash IHash) (mask int, hour int, found bool)
+	GetBlockTimings(count int) []BlockTiming // Timing of the production of recent blocks, oldest first
 
 	// Factoid State
 	// =============
@@ -0,0 +1,159 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package primitives
+
+import (
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// clock is where timestamps, timers and timeouts get the time.  It is the wall clock unless the simulator
+// sets a SimClock, before starting any nodes.
+var clock interfaces.IClock = WallClock{}
+
+func SetClock(c interfaces.IClock) {
+	clock = c
+}
+
+func GetClock() interfaces.IClock {
+	return clock
+}
+
+// IdleSleep is for a loop that found nothing to do, and waits d before it looks again.  The wait reads no time,
+// so it is on the wall clock either way; but under a SimClock it is cut to a millisecond, since the virtual
+// time only moves on once the nodes are idle, and each poll would otherwise add d to every simulated step.
+func IdleSleep(d time.Duration) {
+	if _, ok := clock.(*SimClock); ok && d > time.Millisecond {
+		d = time.Millisecond
+	}
+	time.Sleep(d)
+}
+
+// WallClock is the real time.
+type WallClock struct{}
+
+var _ interfaces.IClock = WallClock{}
+
+func (WallClock) Now() time.Time {
+	return time.Now()
+}
+
+func (WallClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// ScaledClock runs from a given time, at a multiple of the pace of the real time.  A node replaying captured
+// traffic keeps the time of the capture with one, so the messages' timestamps are as fresh as when they came.
+type ScaledClock struct {
+	start time.Time // Where the clock starts
+	real  time.Time // When it started
+	speed float64
+}
+
+var _ interfaces.IClock = (*ScaledClock)(nil)
+
+// NewScaledClock returns a clock at start, running speed times as fast as the real time.  speed must be
+// more than 0.
+func NewScaledClock(start time.Time, speed float64) *ScaledClock {
+	return &ScaledClock{start: start, real: time.Now(), speed: speed}
+}
+
+func (c *ScaledClock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.real)) * c.speed))
+}
+
+func (c *ScaledClock) Sleep(d time.Duration) {
+	time.Sleep(time.Duration(float64(d) / c.speed))
+}
+
+// SimClock is a virtual clock.  It stands still until Advance is called, when it jumps straight to the time
+// the first of the goroutines sleeping on it is due to wake, and wakes it.  So a simulation runs as fast as
+// the nodes can do their work, and every run sees the same times.
+type SimClock struct {
+	sync.Mutex
+	now      time.Time
+	sleepers []simSleeper
+}
+
+type simSleeper struct {
+	wake time.Time
+	done chan bool
+}
+
+var _ interfaces.IClock = (*SimClock)(nil)
+
+func NewSimClock(start time.Time) *SimClock {
+	c := new(SimClock)
+	c.now = start
+	return c
+}
+
+func (c *SimClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *SimClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.Lock()
+	sleeper := simSleeper{wake: c.now.Add(d), done: make(chan bool)}
+	c.sleepers = append(c.sleepers, sleeper)
+	c.Unlock()
+	<-sleeper.done
+}
+
+// Sleepers returns how many goroutines are sleeping on the clock.
+func (c *SimClock) Sleepers() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.sleepers)
+}
+
+// Advance moves the clock on to when the next sleeper is due, and wakes every sleeper due by then.  It
+// returns false, and leaves the clock where it is, if nothing is sleeping.
+func (c *SimClock) Advance() bool {
+	c.Lock()
+	defer c.Unlock()
+	if 0 == len(c.sleepers) {
+		return false
+	}
+	next := c.sleepers[0].wake
+	for _, sleeper := range c.sleepers[1:] {
+		if sleeper.wake.Before(next) {
+			next = sleeper.wake
+		}
+	}
+	if next.After(c.now) {
+		c.now = next
+	}
+	c.wake()
+	return true
+}
+
+// AdvanceBy moves the clock on by d, and wakes every sleeper due by then.
+func (c *SimClock) AdvanceBy(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	c.wake()
+}
+
+// wake wakes the sleepers that are due.  Call with the lock held.
+func (c *SimClock) wake() {
+	sleeping := c.sleepers[:0]
+	for _, sleeper := range c.sleepers {
+		if c.now.Before(sleeper.wake) {
+			sleeping = append(sleeping, sleeper)
+		} else {
+			close(sleeper.done)
+		}
+	}
+	c.sleepers = sleeping
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package primitives_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/factomd/common/primitives"
+)
+
+func TestScaledClock(t *testing.T) {
+	start := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewScaledClock(start, 100)
+	began := time.Now()
+	clock.Sleep(time.Second)
+	if elapsed := time.Since(began); elapsed > 500*time.Millisecond {
+		t.Errorf("Slept %s for a second at 100 times the pace", elapsed)
+	}
+	if now := clock.Now(); now.Before(start.Add(time.Second)) || now.After(start.Add(time.Hour)) {
+		t.Errorf("Clock at %s, expected a little over a second after %s", now, start)
+	}
+}
+
+func TestSimClock(t *testing.T) {
+	start := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewSimClock(start)
+	if clock.Advance() {
+		t.Errorf("Advanced with nothing sleeping")
+	}
+
+	woke := make(chan time.Duration, 2)
+	for _, d := range []time.Duration{time.Minute, time.Second} {
+		go func(d time.Duration) {
+			clock.Sleep(d)
+			woke <- d
+		}(d)
+	}
+	for clock.Sleepers() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The clock jumps to the first sleeper due, and wakes only that one.
+	if !clock.Advance() {
+		t.Fatalf("Nothing to advance to")
+	}
+	if d := <-woke; time.Second != d {
+		t.Errorf("Woke the %s sleeper first", d)
+	}
+	if !start.Add(time.Second).Equal(clock.Now()) {
+		t.Errorf("Clock at %s, expected a second after the start", clock.Now())
+	}
+	if 1 != clock.Sleepers() {
+		t.Errorf("%d sleepers left, expected 1", clock.Sleepers())
+	}
+
+	clock.AdvanceBy(time.Hour)
+	if d := <-woke; time.Minute != d {
+		t.Errorf("Woke the %s sleeper", d)
+	}
+	clock.Sleep(0)
+}
+
+func TestSetClock(t *testing.T) {
+	defer SetClock(GetClock())
+	start := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	SetClock(NewSimClock(start))
+	if ts := NewTimestampNow(); ts.GetTimeMilli() != start.UnixNano()/1e6 {
+		t.Errorf("Timestamp %d, expected the virtual time %d", ts.GetTimeMilli(), start.UnixNano()/1e6)
+	}
+}
+
+func TestIdleSleep(t *testing.T) {
+	defer SetClock(GetClock())
+	SetClock(NewSimClock(time.Now()))
+	start := time.Now()
+	IdleSleep(time.Hour)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Idled %s under a SimClock", d)
+	}
+}
@@ -39,6 +39,7 @@ function updateHTML() {
     // Does every another cycle
     if(!skipInterval){
       updateTransactions()
+      updateBans()
       skipInterval = true
     } else {
       skipInterval = false
@@ -104,6 +105,8 @@ function updataDataDumps() {
 
     $("#dump5 #dumpConRaw").text(obj.DataDump5.RawDump)
     $("#dump5 #dumpSort").text(obj.DataDump5.SortedDump)
+
+    $("#dump6 #dumpRaw").text(obj.DataDump6.RawDump)
   })
 }
 
@@ -319,6 +322,9 @@ function updateAllPeers() {
           }
           //$("#" + peer.Hash).find("#peerquality").text(formatQuality(con.PeerQuality))
         }
+        if ($("#" + peer.Hash).find("#peerquality").text() != String(con.ApplicationScore)) {
+          $("#" + peer.Hash).find("#peerquality").text(con.ApplicationScore)
+        }
 
         if ($("#" + peer.Hash).find("#sent").val().length == 0 || $("#" + peer.Hash).find("#sent").val() != con.BytesSent) {
           $("#" + peer.Hash).find("#sent").val(con.BytesSent) // Value
@@ -431,4 +437,65 @@ function formatBytes(bytes, messages) {
     m = m + " K"
   }
   return m + "(" + b + ")"
-}
\ No newline at end of file
+}
+function updateBans() {
+  queryState("bans", "", function(resp){
+    if(resp == "error") {
+      return
+    }
+    bans = JSON.parse(resp)
+    $("#totalBanCount").text(bans.length)
+    $("#banList tbody tr").each(function(){
+      jQuery(this).remove()
+    })
+    for (index in bans) {
+      ban = bans[index]
+      row = $("<tr>\
+          <td id='address'></td>\
+          <td id='reason'></td>\
+          <td id='source'></td>\
+          <td id='expires'></td>\
+          <td><a id='unban' class='button tiny'>Lift</a></td>\
+      </tr>")
+      row.find("#address").text(ban.Address)
+      row.find("#reason").text(ban.Reason)
+      row.find("#source").text(ban.Source)
+      row.find("#expires").text(new Date(ban.Expires).toLocaleString())
+      row.find("#unban").attr("value", ban.Address)
+      row.find("#unban").click(function(){
+        button = jQuery(this)
+        queryState("unban", button.attr("value"), function(resp){
+          obj = JSON.parse(resp)
+          button.addClass("disabled")
+          if(obj.Access == "denied") {
+            button.text("Denied")
+          } else {
+            updateBans()
+          }
+        })
+      })
+      $("#banList > tbody").append(row)
+    }
+  })
+}
+
+$(document).ready(function(){
+  $("#banList").find("#ban").click(function(){
+    address = $("#banAddress").val()
+    if(address.length == 0) {
+      return
+    }
+    queryState("ban", address, function(resp){
+      obj = JSON.parse(resp)
+      if(obj.Access == "denied") {
+        $("#banList").find("#ban").text("Denied")
+      } else if(typeof obj.Error != "undefined") {
+        $("#banList").find("#ban").text("Invalid")
+      } else {
+        $("#banAddress").val("")
+        $("#banList").find("#ban").text("Ban")
+        updateBans()
+      }
+    })
+  })
+})
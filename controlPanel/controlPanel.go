@@ -360,10 +360,39 @@ func factomdQuery(item string, value string) []byte {
 		} else {
 			return []byte(`{"Access":"denied", "Id":"` + hash + `"}`)
 		}
+	case "bans":
+		return getBans()
+	case "ban", "unban":
+		DisplayStateMutex.RLock()
+		CPS := DisplayState.ControlPanelSetting
+		DisplayStateMutex.RUnlock()
+		if CPS != 2 || Controller == nil {
+			return []byte(`{"Access":"denied"}`)
+		}
+		if item == "unban" {
+			Controller.LiftBan(value)
+			return []byte(`{"Access":"granted"}`)
+		}
+		if _, err := Controller.BanAddress(value, "Banned from the control panel"); err != nil {
+			data, _ := json.Marshal(err.Error())
+			return []byte(`{"Access":"granted", "Error":` + string(data) + `}`)
+		}
+		return []byte(`{"Access":"granted"}`)
 	}
 	return []byte("")
 }
 
+func getBans() []byte {
+	if Controller == nil {
+		return []byte(`[]`)
+	}
+	data, err := json.Marshal(Controller.Bans())
+	if err != nil {
+		return []byte(`error`)
+	}
+	return data
+}
+
 func disconnectPeer(hash string) {
 	if Controller != nil {
 		fmt.Println("ControlPanel: Sent a disconnect signal.")
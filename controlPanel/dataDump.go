@@ -27,6 +27,9 @@ type DataDump struct {
 		RawDump    string
 		SortedDump string
 	}
+	DataDump6 struct { // Block Timing
+		RawDump string
+	}
 }
 
 func getDataDumps() []byte {
@@ -49,6 +52,8 @@ func getDataDumps() []byte {
 	holder.DataDump5.RawDump = AllConnectionsString()
 	holder.DataDump5.SortedDump = SortedConnectionString()
 
+	holder.DataDump6.RawDump = dd.BlockTimings(*DsCopy)
+
 	ret, err := json.Marshal(holder)
 	if err != nil {
 		return []byte(`{"list":"none"}`)
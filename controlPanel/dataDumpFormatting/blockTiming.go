@@ -0,0 +1,27 @@
+package dataDumpFormatting
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/factomd/state"
+)
+
+func BlockTimings(copyDS state.DisplayState) string {
+	prt := ""
+	prt = prt + fmt.Sprintf("=== Block Timing ===   Total: %d Displaying: All, newest first\n", len(copyDS.BlockTimings))
+	prt = prt + "EOM and DBSig times are ms from the start of the block.  Process and Save times are ms of work.\n"
+	for i := len(copyDS.BlockTimings) - 1; i >= 0; i-- {
+		b := copyDS.BlockTimings[i]
+		prt = prt + fmt.Sprintf("------------------------------------ DBHeight %d ---------------------------------------\n", b.DBHeight)
+		prt = prt + fmt.Sprintf("DBSigs: %d  Save: %.3f  Missing: %d  Resend: %d  Expire: %d\n",
+			b.DBSigs, float64(b.SaveMicro)/1000, b.MissingCnt, b.ResendCnt, b.ExpireCnt)
+		for m, minute := range b.Minutes {
+			prt = prt + fmt.Sprintf("  Minute %d  Process %9.3f  EOMs", m, float64(minute.ProcessMicro)/1000)
+			for _, eom := range minute.EOMs {
+				prt = prt + fmt.Sprintf(" %7d", eom)
+			}
+			prt = prt + "\n"
+		}
+	}
+	return prt
+}
@@ -61,6 +61,9 @@ var (
 
 	//Which EC transaction paid for this Entry
 	PAID_FOR = []byte("PaidFor")
+
+	//The replay filter, saved so it survives a restart
+	REPLAY = []byte("Replay")
 )
 
 var ConstantNamesMap map[string]string
@@ -99,6 +102,8 @@ func init() {
 	ConstantNamesMap[string(INCLUDED_IN)] = "IncludedIn"
 
 	ConstantNamesMap[string(PAID_FOR)] = "PaidFor"
+
+	ConstantNamesMap[string(REPLAY)] = "Replay"
 }
 
 type Overlay struct {
@@ -0,0 +1,21 @@
+package databaseOverlay
+
+import (
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// There is only ever one replay filter, so it is saved under a fixed key.
+var replayKey = []byte("Replay")
+
+func (db *Overlay) SaveReplay(replay interfaces.BinaryMarshallable) error {
+	if replay == nil {
+		return nil
+	}
+	return db.DB.Put(REPLAY, replayKey, replay)
+}
+
+// FetchReplay unmarshals the saved replay filter into dst.  Returns nil if
+// no filter has been saved.
+func (db *Overlay) FetchReplay(dst interfaces.BinaryMarshallable) (interfaces.BinaryMarshallable, error) {
+	return db.DB.Get(REPLAY, replayKey, dst)
+}
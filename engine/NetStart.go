@@ -8,9 +8,11 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"math"
+	"math/rand"
 
 	"bufio"
 	"github.com/FactomProject/factomd/common/interfaces"
@@ -41,16 +43,25 @@ func NetStart(s *state.State) {
 	cntPtr := flag.Int("count", 1, "The number of nodes to generate")
 	netPtr := flag.String("net", "tree", "The default algorithm to build the network connections")
 	fnetPtr := flag.String("fnet", "", "Read the given file to build the network connections")
+	netDegreePtr := flag.Int("netdegree", 4, "The average number of peers each node has in the random, smallworld and scalefree networks")
+	netRewirePtr := flag.Float64("netrewire", 0.1, "The chance each link in the smallworld network is moved to a random node")
 	dropPtr := flag.Int("drop", 0, "Number of messages to drop out of every thousand")
 	journalPtr := flag.String("journal", "", "Rerun a Journal of messages")
+	journalSpeedPtr := flag.Float64("journalspeed", 0, "Pace of the -journal replay: 0 is as fast as the node takes the messages, 1 the pace they were made, 2 twice that.")
+	journalBreakPtr := flag.String("journalbreak", "", "Pause the -journal replay at these breakpoints, eg type=EOM,hash=1a2b,height=5.  The b commands go on from there.")
+	journalPausedPtr := flag.Bool("journalpaused", false, "If true, the -journal replay starts paused, to step through with the b commands.")
+	journalFromPtr := flag.Int("journalfrom", 0, "Start the -journal replay at this directory block, found by the journal's index.  Binary journals only.")
+	journalSizePtr := flag.Int("journalsize", 64, "Megabytes each file of a node's journal grows to before the journal goes on in the next.  0 is unlimited.")
 	followerPtr := flag.Bool("follower", false, "If true, force node to be a follower.  Only used when replaying a journal.")
 	leaderPtr := flag.Bool("leader", true, "If true, force node to be a leader.  Only used when replaying a journal.")
 	dbPtr := flag.String("db", "", "Override the Database in the Config file and use this Database implementation")
 	cloneDBPtr := flag.String("clonedb", "", "Override the main node and use this database for the clones in a Network.")
+	configPtr := flag.String("config", "", "Read this config file, instead of factomd.conf in ~/.factom/m2")
 	folderPtr := flag.String("folder", "", "Directory in .factom to store nodes. (eg: multiple nodes on one filesystem support)")
 	portOverridePtr := flag.Int("port", 0, "Address to serve WSAPI on")
 	networkNamePtr := flag.String("network", "", "Network to join: MAIN, TEST or LOCAL")
 	networkPortOverridePtr := flag.Int("networkPort", 0, "Address for p2p network to listen on.")
+	networkAddressPtr := flag.String("networkAddress", "", "IP address for the p2p network to listen on, eg 0.0.0.0 or ::.  Default is every IPv4 and IPv6 address.")
 	peersPtr := flag.String("peers", "", "Array of peer addresses. ")
 	blkTimePtr := flag.Int("blktime", 0, "Seconds per block.  Production is 600.")
 	runtimeLogPtr := flag.Bool("runtimeLog", false, "If true, maintain runtime logs of messages passed.")
@@ -61,6 +72,26 @@ func NetStart(s *state.State) {
 	timeOffsetPtr := flag.Int("timedelta", 0, "Maximum timeDelta in milliseconds to offset each node.  Simulates deltas in system clocks over a network.")
 	keepMismatchPtr := flag.Bool("keepmismatch", false, "If true, do not discard DBStates even when a majority of DBSignatures have a different hash")
 	startDelayPtr := flag.Int("startdelay", 10, "Delay to start processing messages, in seconds")
+	dbstateWorkersPtr := flag.Int("dbstateworkers", 4, "Workers checking DBStates ahead of processing during sync.  0 checks them in the main loop.")
+	sendLimitPtr := flag.Int("sendlimit", 0, "KB per second we send to the network, over all peers.  0 is unlimited.  Consensus messages are never held back.")
+	receiveLimitPtr := flag.Int("receivelimit", 0, "KB per second we read from the network, over all peers.  0 is unlimited.")
+	peerSendLimitPtr := flag.Int("peersendlimit", 0, "KB per second we send to any one peer.  0 is unlimited.")
+	peerReceiveLimitPtr := flag.Int("peerreceivelimit", 0, "KB per second we read from any one peer.  0 is unlimited.")
+	netCapturePtr := flag.String("netcapture", "", "Record the traffic we receive from the network to this file, for -netreplay.")
+	netReplayPtr := flag.String("netreplay", "", "Play the network traffic captured in this file (see -netcapture) into the node, instead of joining the network.")
+	netReplaySpeedPtr := flag.Float64("netreplayspeed", 1, "Pace of -netreplay: 1 is the captured pace, 2 twice as fast, 0 as fast as the node can take it.  The node keeps the time of the capture.")
+	simClockPtr := flag.Bool("simclock", false, "If true, the nodes keep virtual time, which moves on as soon as they have nothing left to do.")
+	seedPtr := flag.Int64("seed", 0, "Seed for the simulator's random numbers.  With -simclock, runs with the same seed build the same blocks.")
+	latencyPtr := flag.Duration("latency", 0, "How long messages take between simulated nodes.")
+	jitterPtr := flag.Duration("jitter", 0, "How much the time messages take between simulated nodes varies.")
+	jitterDistPtr := flag.String("jitterdist", "uniform", "How the time messages take varies: uniform, normal or exponential.")
+	bandwidthPtr := flag.Int("bandwidth", 0, "Bytes per second each link between simulated nodes carries.  0 is unlimited.")
+	duplicatePtr := flag.Int("duplicate", 0, "Number of messages out of every thousand simulated nodes receive twice.")
+	reorderPtr := flag.Int("reorder", 0, "Number of messages out of every thousand overtaken by later ones between simulated nodes.")
+	simAPIPortPtr := flag.Int("simapi", 0, "Serve the simulator API (SimControl's commands as JSON over HTTP) on this port of 127.0.0.1.  0 is off.")
+	scenarioPtr := flag.String("scenario", "", "Run the simulator through the steps in this file, then exit with 0 if they passed and 1 if not.")
+	divergencePtr := flag.Bool("divergence", false, "If true, compare the nodes' blocks, balances and authority sets at every height, and report the first divergence.")
+	divergenceHaltPtr := flag.Bool("divergencehalt", false, "If true, take every node off the network at the first divergence, so the nodes can be looked over as they stand.")
 
 	flag.Parse()
 
@@ -68,17 +99,26 @@ func NetStart(s *state.State) {
 	cnt := *cntPtr
 	net := *netPtr
 	fnet := *fnetPtr
+	netDegree := *netDegreePtr
+	netRewire := *netRewirePtr
 	droprate := *dropPtr
 	journal := *journalPtr
+	journalSpeed := *journalSpeedPtr
+	journalBreaks := *journalBreakPtr
+	journalPaused := *journalPausedPtr
+	journalFrom := *journalFromPtr
+	journalSize := *journalSizePtr
 	follower := *followerPtr
 	leader := *leaderPtr
 	db := *dbPtr
 	cloneDB := *cloneDBPtr
+	config := *configPtr
 	folder := *folderPtr
 	portOverride := *portOverridePtr
 	peers := *peersPtr
 	networkName := *networkNamePtr
 	networkPortOverride := *networkPortOverridePtr
+	networkAddress := *networkAddressPtr
 	blkTime := *blkTimePtr
 	runtimeLog := *runtimeLogPtr
 	netdebug := *netdebugPtr
@@ -88,12 +128,41 @@ func NetStart(s *state.State) {
 	timeOffset := *timeOffsetPtr
 	keepMismatch := *keepMismatchPtr
 	startDelay := int64(*startDelayPtr)
+	dbstateWorkers := *dbstateWorkersPtr
+	sendLimit := *sendLimitPtr
+	receiveLimit := *receiveLimitPtr
+	peerSendLimit := *peerSendLimitPtr
+	peerReceiveLimit := *peerReceiveLimitPtr
+	netCapture := *netCapturePtr
+	netReplay := *netReplayPtr
+	netReplaySpeed := *netReplaySpeedPtr
+	scenarioFile := *scenarioPtr
+	simAPIPort := *simAPIPortPtr
+	watchDivergences := *divergencePtr || *divergenceHaltPtr
+	divergenceHalt := *divergenceHaltPtr
+	linkFaults := LinkFaults{
+		Latency:   *latencyPtr,
+		Jitter:    *jitterPtr,
+		Bandwidth: *bandwidthPtr,
+		Duplicate: *duplicatePtr,
+		Reorder:   *reorderPtr,
+	}
+	if err := linkFaults.set("dist=" + *jitterDistPtr); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	simClock := *simClockPtr
+	seed := *seedPtr
 
 	// Must add the prefix before loading the configuration.
 	s.AddPrefix(prefix)
 	FactomConfigFilename := util.GetConfigFilename("m2")
+	if 0 < len(config) {
+		FactomConfigFilename = config
+	}
 	fmt.Println(fmt.Sprintf("factom config: %s", FactomConfigFilename))
 	s.LoadConfig(FactomConfigFilename, folder)
+	s.JournalMaxSize = int64(journalSize) * 1024 * 1024
 	s.OneLeader = rotate
 	s.TimeOffset = primitives.NewTimestampFromMilliseconds(uint64(timeOffset))
 	s.StartDelayLimit = startDelay * 1000
@@ -130,18 +199,9 @@ func NetStart(s *state.State) {
 
 	AddInterruptHandler(func() {
 		fmt.Print("<Break>\n")
-		fmt.Print("Gracefully shutting down the server...\n")
-		for _, fnode := range fnodes {
-			fmt.Print("Shutting Down: ", fnode.State.FactomNodeName, "\r\n")
-			fnode.State.ShutdownChan <- 0
-		}
-		p2pNetwork.NetworkStop()
-		// NODE_TALK_FIX
-		p2pProxy.stopProxy()
-		fmt.Print("Waiting...\r\n")
-		time.Sleep(3 * time.Second)
-		os.Exit(0)
+		shutdown()
 	})
+	wsapi.ShutdownFunc = Interrupt
 
 	if journal != "" {
 		if s.DBType != "Map" {
@@ -164,6 +224,7 @@ func NetStart(s *state.State) {
 	}
 
 	s.KeepMismatch = keepMismatch
+	s.DBStateWorkers = dbstateWorkers
 
 	if len(db) > 0 {
 		s.DBType = db
@@ -191,20 +252,68 @@ func NetStart(s *state.State) {
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "net spec", pnet))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %d\n", "Msgs droped", droprate))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "journal", journal))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %v breaks \"%s\" paused %v from %d\n", "journal replay", journalSpeed, journalBreaks, journalPaused, journalFrom))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %d MB\n", "journal size", journalSize))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "database", db))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "database for clones", cloneDB))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "folder", folder))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%d\"\n", "port", s.PortNumber))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "network", networkName))
+	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "network address", networkAddress))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "peers", peers))
+	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\" degree %d rewire %v\n", "net", net, netDegree, netRewire))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%d\"\n", "netdebug", netdebug))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%t\"\n", "exclusive", exclusive))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %v halt %v\n", "divergence watch", watchDivergences, divergenceHalt))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %d\n", "block time", blkTime))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "runtimeLog", runtimeLog))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "rotate", rotate))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "timeOffset", timeOffset))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "keepMismatch", keepMismatch))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "startDelay", startDelay))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "dbstateWorkers", dbstateWorkers))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "encryptPeers", s.EncryptPeers))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %d/%d KB/s\n", "send limit", sendLimit, peerSendLimit))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %d/%d KB/s\n", "receive limit", receiveLimit, peerReceiveLimit))
+	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "netcapture", netCapture))
+	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\" at %v\n", "netreplay", netReplay, netReplaySpeed))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %s\n", "link faults", linkFaults))
+	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "scenario", scenarioFile))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %d\n", "simapi", simAPIPort))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "simclock", simClock))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %d\n", "seed", seed))
+
+	if 0 != seed {
+		rand.Seed(seed)
+	}
+	if !linkFaults.none() {
+		faults.setLink(anyNode, anyNode, linkFaults)
+	}
+
+	// A replayed capture sets the time, so the messages in it are as fresh as when they were captured.
+	var netReplayer *ReplayTransport
+	if 0 < len(netReplay) {
+		netReplayer = new(ReplayTransport).Init("", "Replay "+netReplay).(*ReplayTransport)
+		if err := netReplayer.Open(netReplay); err != nil {
+			panic(fmt.Sprintf("Could not open the network capture %s: %v", netReplay, err))
+		}
+		if simClock {
+			netReplaySpeed = 0
+		}
+		primitives.SetClock(netReplayClock(netReplayer.CaptureStart(), netReplaySpeed))
+	} else if simClock {
+		primitives.SetClock(primitives.NewSimClock(SimClockStart))
+	}
+	virtualClock, _ := primitives.GetClock().(*primitives.SimClock)
+
+	var sc *scenario
+	if 0 < len(scenarioFile) {
+		var err error
+		if sc, err = loadScenario(scenarioFile); err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("Could not load the scenario: %v\n", err))
+			os.Exit(1)
+		}
+	}
 
 	s.AddPrefix(prefix)
 	s.SetOut(false)
@@ -259,36 +368,65 @@ func NetStart(s *state.State) {
 	default:
 		panic("Invalid Network choice in Config File. Choose MAIN, TEST or LOCAL")
 	}
-	if 0 < networkPortOverride {
-		networkPort = fmt.Sprintf("%d", networkPortOverride)
-	}
 	connectionMetricsChannel := make(chan interface{}, p2p.StandardChannelSize)
-	ci := p2p.ControllerInit{
-		Port:                     networkPort,
-		PeersFile:                peersFile,
-		Network:                  networkID,
-		Exclusive:                exclusive,
-		SeedURL:                  seedURL,
-		SpecialPeers:             specialPeers,
-		ConnectionMetricsChannel: connectionMetricsChannel,
-	}
-	p2pNetwork = new(p2p.Controller).Init(ci)
-	p2pNetwork.StartNetwork()
-	// Setup the proxy (Which translates from network parcels to factom messages, handling addressing for directed messages)
-	p2pProxy = new(P2PProxy).Init(fnodes[0].State.FactomNodeName, "P2P Network").(*P2PProxy)
-	p2pProxy.FromNetwork = p2pNetwork.FromNetwork
-	p2pProxy.ToNetwork = p2pNetwork.ToNetwork
-	fnodes[0].Peers = append(fnodes[0].Peers, p2pProxy)
-	p2pProxy.SetDebugMode(netdebug)
-	if 0 < netdebug {
-		go p2pProxy.PeriodicStatusReport(fnodes)
-		p2pNetwork.StartLogging(uint8(netdebug))
+	if 0 < len(netReplay) {
+		// Drive the node from a capture rather than the network
+		netReplayer.FromName = fnodes[0].State.FactomNodeName
+		fnodes[0].Peers = append(fnodes[0].Peers, netReplayer)
+		netReplayer.Start()
 	} else {
-		p2pNetwork.StartLogging(uint8(0))
+		if 0 < networkPortOverride {
+			networkPort = fmt.Sprintf("%d", networkPortOverride)
+		}
+		ci := p2p.ControllerInit{
+			Port:                     networkPort,
+			ListenAddress:            networkAddress,
+			PeersFile:                peersFile,
+			Network:                  networkID,
+			Exclusive:                exclusive,
+			SeedURL:                  seedURL,
+			SpecialPeers:             specialPeers,
+			Encrypt:                  s.EncryptPeers,
+			IdentityFile:             s.PeerKeyFile,
+			Capabilities:             p2p.CapabilityFullNode | p2p.CapabilityArchive | p2p.CapabilityCompression,
+			DBHeight:                 fnodes[0].State.GetHighestRecordedBlock,
+			SendLimit:                sendLimit * 1024,
+			ReceiveLimit:             receiveLimit * 1024,
+			PeerSendLimit:            peerSendLimit * 1024,
+			PeerReceiveLimit:         peerReceiveLimit * 1024,
+			BanDuration:              s.BanDuration,
+			ConnectionMetricsChannel: connectionMetricsChannel,
+		}
+		p2pNetwork = new(p2p.Controller).Init(ci)
+		wsapi.BanList = p2pNetwork
+		if nil != p2p.NetworkIdentity {
+			fmt.Printf("Network identity: %s\n", p2p.NetworkIdentity.Fingerprint)
+		}
+		p2pNetwork.StartNetwork()
+		// Setup the proxy (Which translates from network parcels to factom messages, handling addressing for directed messages)
+		p2pProxy = new(P2PProxy).Init(fnodes[0].State.FactomNodeName, "P2P Network").(*P2PProxy)
+		p2pProxy.FromNetwork = p2pNetwork.FromNetwork
+		p2pProxy.ToNetwork = p2pNetwork.ToNetwork
+		p2pProxy.router.peerHeights = p2pNetwork.PeerHeights
+		fnodes[0].Peers = append(fnodes[0].Peers, p2pProxy)
+		p2pProxy.SetDebugMode(netdebug)
+		if 0 < netdebug {
+			go p2pProxy.PeriodicStatusReport(fnodes)
+			p2pNetwork.StartLogging(uint8(netdebug))
+		} else {
+			p2pNetwork.StartLogging(uint8(0))
+		}
+		if 0 < len(netCapture) {
+			file, err := os.Create(netCapture)
+			if err != nil {
+				panic(fmt.Sprintf("Could not create the network capture %s: %v", netCapture, err))
+			}
+			p2pProxy.Capture(p2p.NewCaptureWriter(file, primitives.GetClock().Now))
+		}
+		p2pProxy.Start()
+		// Command line peers lets us manually set special peers
+		p2pNetwork.DialSpecialPeersString(peers)
 	}
-	p2pProxy.startProxy()
-	// Command line peers lets us manually set special peers
-	p2pNetwork.DialSpecialPeersString(peers)
 
 	switch net {
 	case "file":
@@ -378,15 +516,49 @@ func NetStart(s *state.State) {
 				break
 			}
 		}
+	case "random":
+		fmt.Println("Using random Network")
+		for _, link := range randomNetwork(len(fnodes), float64(netDegree), topologyRand(seed)) {
+			AddSimPeer(fnodes, link[0], link[1])
+		}
+	case "smallworld":
+		fmt.Println("Using smallworld Network")
+		for _, link := range smallWorldNetwork(len(fnodes), netDegree, netRewire, topologyRand(seed)) {
+			AddSimPeer(fnodes, link[0], link[1])
+		}
+	case "scalefree":
+		fmt.Println("Using scalefree Network")
+		for _, link := range scaleFreeNetwork(len(fnodes), netDegree, topologyRand(seed)) {
+			AddSimPeer(fnodes, link[0], link[1])
+		}
 	default:
-		fmt.Println("Didn't understand network type. Known types: mesh, long, circles, tree, loops.  Using a Long Network")
+		fmt.Println("Didn't understand network type. Known types: mesh, long, circles, tree, loops, random, smallworld, scalefree.  Using a Long Network")
 		for i := 1; i < cnt; i++ {
 			AddSimPeer(fnodes, i-1, i)
 		}
 
 	}
+	os.Stderr.WriteString(fmt.Sprintf("%20s %s\n", "topology", graphStats(simGraph(fnodes))))
+	if watchDivergences {
+		watchDivergence(time.Second, divergenceHalt)
+	}
 	if journal != "" {
-		go LoadJournal(s, journal)
+		replay.setSpeed(journalSpeed)
+		for _, setting := range strings.Split(journalBreaks, ",") {
+			if 0 == len(setting) {
+				continue
+			}
+			b, err := parseJournalBreak(setting)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			replay.addBreak(b)
+		}
+		if journalPaused {
+			replay.pause()
+		}
+		go LoadJournalFrom(s, journal, uint32(journalFrom))
 		startServers(false)
 	} else {
 		startServers(true)
@@ -396,6 +568,15 @@ func NetStart(s *state.State) {
 	go wsapi.Start(fnodes[0].State)
 
 	go controlPanel.ServeControlPanel(fnodes[0].State.ControlPanelChannel, fnodes[0].State, connectionMetricsChannel, p2pNetwork, Build)
+	if nil != virtualClock {
+		go runSimClock(virtualClock)
+	}
+	if 0 < simAPIPort {
+		go ServeSimAPI(simAPIPort)
+	}
+	if nil != sc {
+		go sc.runAndExit()
+	}
 	// Listen for commands:
 	SimControl(listenTo)
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/FactomProject/factomd/common/constants"
 	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
 	"github.com/FactomProject/factomd/log"
 )
 
@@ -25,6 +26,7 @@ func NetworkProcessorNet(fnode *FactomNode) {
 
 func Peers(fnode *FactomNode) {
 	cnt := 0
+	floods := newFloodDetector()
 	for {
 		for i := 0; i < 100 && len(fnode.State.APIQueue()) > 0; i++ {
 			select {
@@ -93,11 +95,14 @@ func Peers(fnode *FactomNode) {
 
 				} else {
 					fnode.MLog.add2(fnode, false, peer.GetNameTo(), "PeerIn", false, msg)
+					if floods.duplicate(msg.GetNetworkOrigin()) {
+						scorePeer(msg, ScoreDuplicateFlood)
+					}
 				}
 			}
 		}
 		if cnt == 0 {
-			time.Sleep(50 * time.Millisecond)
+			primitives.IdleSleep(50 * time.Millisecond)
 		}
 		cnt = 0
 	}
@@ -156,14 +161,17 @@ func NetworkOutputs(fnode *FactomNode) {
 	}
 }
 
-// Just throw away the trash
+// Just throw away the trash, marking down the peers that sent it.  Peers that sent us data we asked for
+// are marked up.
 func InvalidOutputs(fnode *FactomNode) {
 	for {
 		time.Sleep(1 * time.Millisecond)
-		invalidMsg := <-fnode.State.NetworkInvalidMsgQueue()
-		//fmt.Println(invalidMsg)
-		if len(invalidMsg.GetNetworkOrigin()) > 0 {
-			p2pNetwork.AdjustPeerQuality(invalidMsg.GetNetworkOrigin(), -2)
+		select {
+		case invalidMsg := <-fnode.State.NetworkInvalidMsgQueue():
+			//fmt.Println(invalidMsg)
+			scorePeer(invalidMsg, invalidMessageScore(invalidMsg))
+		case usefulMsg := <-fnode.State.NetworkUsefulMsgQueue():
+			scorePeer(usefulMsg, ScoreUsefulData)
 		}
 	}
 }
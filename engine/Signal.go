@@ -80,3 +80,15 @@ func AddInterruptHandler(handler func()) {
 
 	addHandlerChannel <- handler
 }
+
+// Interrupt invokes the registered interrupt handlers just as if a SIGINT
+// (Ctrl+C) had been received.  Used to shut down from the API.
+func Interrupt() {
+	if interruptChannel == nil {
+		return
+	}
+	select {
+	case interruptChannel <- os.Interrupt:
+	default:
+	}
+}
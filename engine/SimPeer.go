@@ -7,6 +7,10 @@ package engine
 import (
 	"bytes"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/messages"
 )
@@ -21,6 +25,19 @@ type SimPeer struct {
 	// Channels that define the connection:
 	BroadcastOut chan []byte
 	BroadcastIn  chan []byte
+
+	// The nodes at either end, and the messages on their way across the link, for the network faults
+	fromNode   int
+	toNode     int
+	flightLock sync.Mutex
+	flight     []inFlight // In the order they arrive
+	lastDue    time.Time  // When the last message kept in order arrives
+	busyUntil  time.Time  // When the link has finished sending, under a bandwidth cap
+
+	// What has gone over the link, for the topology export.  Updated atomically.
+	sent    int64
+	bytes   int64
+	dropped int64
 }
 
 var _ interfaces.IPeer = (*SimPeer)(nil)
@@ -54,6 +71,14 @@ func (f *SimPeer) Init(fromName, toName string) interfaces.IPeer {
 	return f
 }
 
+// Start does nothing; AddSimPeer wires the channels up.
+func (f *SimPeer) Start() {
+}
+
+// Stop does nothing; simulated nodes stop with the process.
+func (f *SimPeer) Stop() {
+}
+
 func (f *SimPeer) GetNameFrom() string {
 	return f.FromName
 }
@@ -68,7 +93,11 @@ func (f *SimPeer) Send(msg interfaces.IMsg) error {
 		return err
 	}
 	if len(f.BroadcastOut) < 9000 {
-		f.BroadcastOut <- data
+		atomic.AddInt64(&f.sent, 1)
+		atomic.AddInt64(&f.bytes, int64(len(data)))
+		f.transmit(data)
+	} else {
+		atomic.AddInt64(&f.dropped, 1)
 	}
 	return nil
 }
@@ -122,6 +151,8 @@ func AddSimPeer(fnodes []*FactomNode, i1 int, i2 int) {
 	peer21 := new(SimPeer).Init(f2.State.FactomNodeName, f1.State.FactomNodeName).(*SimPeer)
 	peer12.BroadcastIn = peer21.BroadcastOut
 	peer21.BroadcastIn = peer12.BroadcastOut
+	peer12.fromNode, peer12.toNode = i1, i2
+	peer21.fromNode, peer21.toNode = i2, i1
 
 	f1.Peers = append(f1.Peers, peer12)
 	f2.Peers = append(f2.Peers, peer21)
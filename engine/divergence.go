@@ -0,0 +1,209 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factomd/state"
+)
+
+// Watching a simulation for the nodes disagreeing.  Each node fingerprints the blocks it processes (see
+// state.BlockFingerprint), and the watch compares the fingerprints of all the nodes at every height.  At the
+// first difference it reports which nodes differ, in what, and the messages each executed last before that
+// block was done.  It can halt the simulation there, taking every node off the network and pausing any journal
+// replay, so the nodes can be looked over with SimControl's commands as they stand.
+
+// fingerprinted is what the watch needs of a node.  *state.State is one.
+type fingerprinted interface {
+	GetFactomNodeName() string
+	GetFingerprint(dbheight uint32) *state.BlockFingerprint
+	GetFingerprintHeight() (uint32, bool)
+}
+
+// The parts of a fingerprint compared, by name.
+var divergenceFields = []string{"dblock", "ablock", "balances", "authorities"}
+
+func fingerprintValues(f *state.BlockFingerprint) []string {
+	return []string{f.DBKeyMR.String(), f.ABHash.String(), f.Balances.String(), f.Authorities.String()}
+}
+
+// divergenceField is a part of the fingerprint the nodes disagree on.
+type divergenceField struct {
+	Field  string              `json:"field"`
+	Values map[string][]string `json:"values"` // Each value, and the nodes with it
+}
+
+type divergenceNode struct {
+	Name        string   `json:"name"`
+	DBKeyMR     string   `json:"dblock"`
+	ABHash      string   `json:"ablock"`
+	Balances    string   `json:"balances"`
+	Authorities string   `json:"authorities"`
+	Recent      []string `json:"recent"` // The messages the node executed last before the block, oldest first
+}
+
+type divergenceReport struct {
+	DBHeight uint32            `json:"dbheight"`
+	Fields   []divergenceField `json:"fields"`
+	Nodes    []divergenceNode  `json:"nodes"`
+}
+
+// compareFingerprints returns a report if the nodes' fingerprints of the block at dbheight differ, or nil if
+// they agree.
+func compareFingerprints(dbheight uint32, nodes []fingerprinted, fingerprints []*state.BlockFingerprint) *divergenceReport {
+	report := &divergenceReport{DBHeight: dbheight}
+	for i, field := range divergenceFields {
+		values := make(map[string][]string)
+		for j, f := range fingerprints {
+			v := fingerprintValues(f)[i]
+			values[v] = append(values[v], nodes[j].GetFactomNodeName())
+		}
+		if 1 < len(values) {
+			report.Fields = append(report.Fields, divergenceField{field, values})
+		}
+	}
+	if 0 == len(report.Fields) {
+		return nil
+	}
+	for j, f := range fingerprints {
+		v := fingerprintValues(f)
+		report.Nodes = append(report.Nodes, divergenceNode{nodes[j].GetFactomNodeName(), v[0], v[1], v[2], v[3], f.Recent})
+	}
+	return report
+}
+
+func (r *divergenceReport) String() string {
+	out := fmt.Sprintf("The nodes diverged at directory block %d, on %d of %d fields\n", r.DBHeight, len(r.Fields), len(divergenceFields))
+	for _, f := range r.Fields {
+		out += fmt.Sprintf("  %s:\n", f.Field)
+		values := make([]string, 0, len(f.Values))
+		for v := range f.Values {
+			values = append(values, v)
+		}
+		sort.Strings(values)
+		for _, v := range values {
+			out += fmt.Sprintf("    %s  %s\n", v, strings.Join(f.Values[v], " "))
+		}
+	}
+	for _, n := range r.Nodes {
+		out += fmt.Sprintf("  %s executed last before block %d:\n", n.Name, r.DBHeight)
+		for _, m := range n.Recent {
+			out += "    " + m + "\n"
+		}
+	}
+	return out
+}
+
+type divergenceWatch struct {
+	sync.Mutex
+	on     bool
+	next   uint32 // Every node has been compared at the heights below
+	high   uint32 // The highest height compared
+	report *divergenceReport
+}
+
+// divergence is the watch over the nodes of this simulation.
+var divergence = new(divergenceWatch)
+
+// check compares the nodes at the heights some have processed since the last check, and returns the report
+// of the first divergence.  Once there has been one, the nodes are no longer compared.
+func (w *divergenceWatch) check(nodes []fingerprinted) *divergenceReport {
+	w.Lock()
+	defer w.Unlock()
+	if nil != w.report {
+		return nil
+	}
+	var high uint32
+	heights := make([]uint32, len(nodes))
+	reached := make([]bool, len(nodes))
+	for i, n := range nodes {
+		heights[i], reached[i] = n.GetFingerprintHeight()
+		if reached[i] && heights[i] > high {
+			high = heights[i]
+		}
+	}
+	if high >= state.FingerprintHistory && w.next < high-state.FingerprintHistory {
+		w.next = high - state.FingerprintHistory // Fallen out of the history of the nodes that are ahead
+	}
+	for h := w.next; h <= high; h++ {
+		var have []fingerprinted
+		var fingerprints []*state.BlockFingerprint
+		all := true
+		for i, n := range nodes {
+			if f := n.GetFingerprint(h); nil != f {
+				have = append(have, n)
+				fingerprints = append(fingerprints, f)
+			} else if !reached[i] || heights[i] < h {
+				all = false // Not there yet.  A node past h without it, eg one started later, isn't waited on.
+			}
+		}
+		if 1 < len(have) {
+			if w.report = compareFingerprints(h, have, fingerprints); nil != w.report {
+				return w.report
+			}
+			if h > w.high {
+				w.high = h
+			}
+		}
+		if all && h == w.next {
+			w.next++
+		}
+	}
+	return nil
+}
+
+func (w *divergenceWatch) String() string {
+	w.Lock()
+	defer w.Unlock()
+	if !w.on {
+		return "The divergence watch is off.  Run with -divergence to turn it on.\n"
+	}
+	if nil != w.report {
+		return w.report.String()
+	}
+	return fmt.Sprintf("No divergence.  All nodes compared below directory block %d, some up to %d.\n", w.next, w.high)
+}
+
+// haltSimulation takes every node off the network and pauses any journal replay.
+func haltSimulation() {
+	for _, fnode := range fnodes {
+		fnode.State.SetNetStateOff(true)
+	}
+	replay.pause()
+	os.Stderr.WriteString("Halted the simulation: every node is off the network.  x brings a node back.\n")
+}
+
+// watchDivergence has every node fingerprint its blocks, then compares them every so often, until the first
+// divergence.  Call it before the nodes start.
+func watchDivergence(every time.Duration, halt bool) {
+	divergence.Lock()
+	divergence.on = true
+	divergence.Unlock()
+	nodes := []fingerprinted{}
+	for _, fnode := range fnodes {
+		fnode.State.Fingerprinting = true
+		nodes = append(nodes, fnode.State)
+	}
+	go divergence.watch(nodes, every, halt)
+}
+
+func (w *divergenceWatch) watch(nodes []fingerprinted, every time.Duration, halt bool) {
+	for {
+		time.Sleep(every)
+		if report := w.check(nodes); nil != report {
+			os.Stderr.WriteString(report.String())
+			if halt {
+				haltSimulation()
+			}
+			return
+		}
+	}
+}
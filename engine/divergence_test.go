@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/state"
+)
+
+type testFingerprinted struct {
+	name         string
+	fingerprints []*state.BlockFingerprint
+}
+
+func (n *testFingerprinted) GetFactomNodeName() string { return n.name }
+
+func (n *testFingerprinted) GetFingerprint(dbheight uint32) *state.BlockFingerprint {
+	for _, f := range n.fingerprints {
+		if f.DBHeight == dbheight {
+			return f
+		}
+	}
+	return nil
+}
+
+func (n *testFingerprinted) GetFingerprintHeight() (uint32, bool) {
+	if 0 == len(n.fingerprints) {
+		return 0, false
+	}
+	return n.fingerprints[len(n.fingerprints)-1].DBHeight, true
+}
+
+// process adds the fingerprint of a block, with the given balances.
+func (n *testFingerprinted) process(balances string) {
+	h := uint32(len(n.fingerprints))
+	f := &state.BlockFingerprint{DBHeight: h, Balances: primitives.Sha([]byte(balances)), Authorities: primitives.NewZeroHash()}
+	f.Recent = []string{fmt.Sprintf("%s EOM %d", n.name, h)}
+	f.DBKeyMR = primitives.Sha([]byte{byte(h)})
+	f.ABHash = primitives.Sha([]byte{byte(h), 1})
+	n.fingerprints = append(n.fingerprints, f)
+}
+
+func TestDivergence(t *testing.T) {
+	a, b, c := &testFingerprinted{name: "FNode0"}, &testFingerprinted{name: "FNode1"}, &testFingerprinted{name: "FNode2"}
+	nodes := []fingerprinted{a, b, c}
+	w := new(divergenceWatch)
+	w.on = true
+	if nil != w.check(nodes) {
+		t.Fatalf("A divergence before any blocks")
+	}
+
+	// The nodes agree, though FNode2 is behind.
+	for i := 0; i < 3; i++ {
+		a.process("same")
+		b.process("same")
+	}
+	c.process("same")
+	if nil != w.check(nodes) || 1 != w.next || 2 != w.high {
+		t.Fatalf("Expected no divergence, all nodes compared below 1 and some to 2, got below %d and %d", w.next, w.high)
+	}
+	if !strings.Contains(w.String(), "No divergence") {
+		t.Errorf("Watch: %s", w.String())
+	}
+
+	// FNode2 catches up, with different balances at height 2.
+	// By the time the watch looks, it has gone on to another block, but the report is of the messages
+	// before the one that diverged.
+	c.process("same")
+	c.process("different")
+	c.process("different")
+	report := w.check(nodes)
+	if nil == report || 2 != report.DBHeight || 1 != len(report.Fields) || "balances" != report.Fields[0].Field {
+		t.Fatalf("Expected the balances to diverge at 2, got %+v", report)
+	}
+	if 2 != len(report.Fields[0].Values) || 3 != len(report.Nodes) || "FNode2 EOM 2" != report.Nodes[2].Recent[0] {
+		t.Errorf("Report %+v", report)
+	}
+	out := report.String()
+	for _, want := range []string{"directory block 2", "balances:", "FNode0 FNode1", "FNode2 executed last before block 2:", "FNode2 EOM 2"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("The report lacks %q:\n%s", want, out)
+		}
+	}
+
+	// Only the first divergence is reported.
+	a.process("x")
+	b.process("y")
+	c.process("z")
+	if nil != w.check(nodes) || !strings.Contains(w.String(), "directory block 2") {
+		t.Errorf("Expected the first divergence to stand: %s", w.String())
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// Control over a journal replay, for debugging.  The replay can run as fast as the node takes the messages,
+// at the pace they were made (by their timestamps), or some multiple of it.  It can be paused and stepped a
+// message at a time, and breakpoints pause it before a message of a type or hash, or once the node is building
+// a directory block.  While it is paused, SimControl's commands inspect the node as usual.
+
+// journalBreak is a breakpoint.  Kind is type, hash or height.
+type journalBreak struct {
+	Kind  string
+	Value string
+}
+
+func (b journalBreak) String() string {
+	return b.Kind + "=" + b.Value
+}
+
+// hits returns true if the breakpoint stops the replay before the message is fed to the node.  A height
+// breakpoint hits once the node is building that directory block, and is then cleared.
+func (b journalBreak) hits(s interfaces.IState, msg interfaces.IMsg) bool {
+	switch b.Kind {
+	case "type":
+		return journalTypeName(messages.MessageName(msg.Type())) == b.Value || strconv.Itoa(int(msg.Type())) == b.Value
+	case "hash":
+		for _, h := range []interfaces.IHash{msg.GetMsgHash(), msg.GetHash()} {
+			if nil != h && strings.HasPrefix(h.String(), b.Value) {
+				return true
+			}
+		}
+	case "height":
+		height, _ := strconv.Atoi(b.Value)
+		return int(s.GetLeaderHeight()) >= height
+	}
+	return false
+}
+
+// journalTypeName makes a message type name easy to type, eg "Fed Server Fault" is fedserverfault.
+func journalTypeName(name string) string {
+	return strings.ToLower(strings.Replace(name, " ", "", -1))
+}
+
+// parseJournalBreak reads a breakpoint, eg type=EOM, hash=1a2b or height=5.
+func parseJournalBreak(setting string) (journalBreak, error) {
+	kv := strings.SplitN(setting, "=", 2)
+	if 2 != len(kv) || 0 == len(kv[1]) {
+		return journalBreak{}, fmt.Errorf("Breakpoint %q is not type=T, hash=H or height=N", setting)
+	}
+	b := journalBreak{Kind: strings.ToLower(kv[0]), Value: kv[1]}
+	switch b.Kind {
+	case "type":
+		b.Value = journalTypeName(b.Value)
+	case "hash":
+		b.Value = strings.ToLower(b.Value)
+	case "height":
+		if _, err := strconv.ParseUint(b.Value, 10, 32); err != nil {
+			return journalBreak{}, fmt.Errorf("Breakpoint height %q is not a block height", b.Value)
+		}
+	default:
+		return journalBreak{}, fmt.Errorf("Breakpoint %q is not type=T, hash=H or height=N", setting)
+	}
+	return b, nil
+}
+
+type journalReplay struct {
+	sync.Mutex
+	resume *sync.Cond
+
+	speed  float64 // 0 is as fast as the node takes them, 1 the pace they were made, 2 twice that...
+	paused bool
+	steps  int // Messages to feed before pausing again
+	breaks []journalBreak
+
+	replaying bool
+	fed       int
+	last      string // The last message fed
+	why       string // Why the replay is paused
+	lastTime  int64  // Timestamp of the latest message fed, in milliseconds
+}
+
+// replay controls the journal replay of this process.
+var replay = newJournalReplay()
+
+func newJournalReplay() *journalReplay {
+	r := new(journalReplay)
+	r.resume = sync.NewCond(r)
+	return r
+}
+
+func (r *journalReplay) setReplaying(replaying bool) {
+	r.Lock()
+	defer r.Unlock()
+	r.replaying = replaying
+}
+
+func (r *journalReplay) setSpeed(speed float64) {
+	r.Lock()
+	defer r.Unlock()
+	r.speed = speed
+}
+
+func (r *journalReplay) addBreak(b journalBreak) {
+	r.Lock()
+	defer r.Unlock()
+	r.breaks = append(r.breaks, b)
+}
+
+func (r *journalReplay) clearBreaks() {
+	r.Lock()
+	defer r.Unlock()
+	r.breaks = nil
+}
+
+func (r *journalReplay) pause() {
+	r.Lock()
+	defer r.Unlock()
+	r.paused = true
+	r.why = "paused"
+}
+
+// step feeds n more messages, then pauses.
+func (r *journalReplay) step(n int) {
+	r.Lock()
+	defer r.Unlock()
+	r.paused = true
+	r.steps += n
+	r.resume.Broadcast()
+}
+
+func (r *journalReplay) cont() {
+	r.Lock()
+	defer r.Unlock()
+	r.paused = false
+	r.steps = 0
+	r.why = ""
+	r.resume.Broadcast()
+}
+
+// wait holds a message until the replay is ready to feed it: until any pause is lifted, and until it is due, at
+// the replay's speed.
+func (r *journalReplay) wait(s interfaces.IState, msg interfaces.IMsg) {
+	r.Lock()
+	for i := 0; i < len(r.breaks); {
+		b := r.breaks[i]
+		if !b.hits(s, msg) {
+			i++
+			continue
+		}
+		if !r.paused {
+			fmt.Printf("Journal replay: breakpoint %s before %s\n", b, msg.String())
+			r.paused = true
+		}
+		r.why = "at breakpoint " + b.String()
+		if "height" == b.Kind {
+			// The node stays at or past the height, so the breakpoint would go on hitting
+			r.breaks = append(r.breaks[:i], r.breaks[i+1:]...)
+			continue
+		}
+		i++
+	}
+	for r.paused && 0 == r.steps {
+		r.resume.Wait()
+	}
+	if 0 < r.steps {
+		r.steps--
+	}
+	var delay time.Duration
+	if ts := msg.GetTimestamp(); nil != ts {
+		now := ts.GetTimeMilli()
+		if 0 < r.speed && 0 < r.lastTime && now > r.lastTime {
+			delay = time.Duration(float64(time.Duration(now-r.lastTime)*time.Millisecond) / r.speed)
+		}
+		if now > r.lastTime {
+			r.lastTime = now
+		}
+	}
+	r.Unlock()
+	if 0 < delay {
+		primitives.GetClock().Sleep(delay)
+	}
+}
+
+// feed records the message was fed to the node.
+func (r *journalReplay) feed(msg interfaces.IMsg) {
+	r.Lock()
+	defer r.Unlock()
+	r.fed++
+	r.last = msg.String()
+}
+
+func (r *journalReplay) String() string {
+	r.Lock()
+	defer r.Unlock()
+	state := "running"
+	if !r.replaying {
+		state = "not replaying"
+	} else if r.paused {
+		state = r.why
+	}
+	speed := "as fast as the node takes them"
+	if 0 < r.speed {
+		speed = fmt.Sprintf("%vx the pace they were made", r.speed)
+	}
+	out := fmt.Sprintf("Journal replay %s, %d messages fed, %s\n", state, r.fed, speed)
+	for _, b := range r.breaks {
+		out += fmt.Sprintf("  break %s\n", b)
+	}
+	if 0 < len(r.last) {
+		out += "  last message: " + r.last + "\n"
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/state"
+)
+
+func testEOM(milli uint64) *messages.EOM {
+	eom := new(messages.EOM)
+	eom.Timestamp = primitives.NewTimestampFromMilliseconds(milli)
+	eom.ChainID = primitives.NewZeroHash()
+	return eom
+}
+
+// fed waits for a message to get past the replay, and returns false if it is still held after a while.
+func fed(done chan bool) bool {
+	select {
+	case <-done:
+		return true
+	case <-time.After(50 * time.Millisecond):
+		return false
+	}
+}
+
+func replayOne(r *journalReplay, s interfaces.IState, msg interfaces.IMsg) chan bool {
+	done := make(chan bool)
+	go func() {
+		r.wait(s, msg)
+		r.feed(msg)
+		close(done)
+	}()
+	return done
+}
+
+func TestJournalBreaks(t *testing.T) {
+	for _, bad := range []string{"type", "type=", "height=x", "minute=3"} {
+		if _, err := parseJournalBreak(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+	b, err := parseJournalBreak("type=Fed Server Fault")
+	if err != nil || (journalBreak{"type", "fedserverfault"}) != b {
+		t.Errorf("Got %v %v", b, err)
+	}
+
+	r := newJournalReplay()
+	s := new(state.State)
+	eom := testEOM(0)
+
+	// A type breakpoint holds every message of the type, until stepped past or continued.
+	r.addBreak(journalBreak{"type", "eom"})
+	done := replayOne(r, s, eom)
+	if fed(done) {
+		t.Fatalf("The breakpoint did not hold the EOM")
+	}
+	r.step(1)
+	if !fed(done) {
+		t.Fatalf("Stepping did not feed the EOM")
+	}
+	if done = replayOne(r, s, eom); fed(done) {
+		t.Fatalf("The replay went on after a step")
+	}
+	r.cont()
+	if !fed(done) {
+		t.Fatalf("Continuing did not feed the EOM")
+	}
+	if done = replayOne(r, s, eom); fed(done) {
+		t.Fatalf("The breakpoint did not hold the next EOM")
+	}
+	r.clearBreaks()
+	r.cont()
+	fed(done)
+
+	// A hash breakpoint.
+	r.addBreak(journalBreak{"hash", eom.GetMsgHash().String()[:6]})
+	if done = replayOne(r, s, eom); fed(done) {
+		t.Fatalf("The hash breakpoint did not hold the EOM")
+	}
+	r.clearBreaks()
+	r.cont()
+	fed(done)
+
+	// A height breakpoint hits once the node gets there, then is done.
+	r.addBreak(journalBreak{"height", "3"})
+	if done = replayOne(r, s, eom); !fed(done) {
+		t.Fatalf("The height breakpoint held the replay short of the height")
+	}
+	s.LLeaderHeight = 3
+	if done = replayOne(r, s, eom); fed(done) {
+		t.Fatalf("The height breakpoint did not hold the replay")
+	}
+	r.cont()
+	if !fed(done) || 0 != len(r.breaks) {
+		t.Fatalf("The height breakpoint was not cleared")
+	}
+	if 6 != r.fed {
+		t.Errorf("Fed %d messages, expected 6", r.fed)
+	}
+}
+
+func TestJournalSpeed(t *testing.T) {
+	defer primitives.SetClock(primitives.GetClock())
+	clock := primitives.NewSimClock(SimClockStart)
+	primitives.SetClock(clock)
+
+	r := newJournalReplay()
+	r.setSpeed(2)
+	s := new(state.State)
+	if !fed(replayOne(r, s, testEOM(10000))) {
+		t.Fatalf("The first message was held")
+	}
+
+	// A second later, at twice the pace, is half a second later.
+	done := replayOne(r, s, testEOM(11000))
+	for 0 == clock.Sleepers() {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance()
+	if !fed(done) {
+		t.Fatalf("The second message was not fed")
+	}
+	if !clock.Now().Equal(SimClockStart.Add(500 * time.Millisecond)) {
+		t.Errorf("Fed at %s, expected half a second on", clock.Now())
+	}
+
+	// Messages out of order go at once.
+	if !fed(replayOne(r, s, testEOM(10500))) {
+		t.Errorf("A message older than the last was held")
+	}
+}
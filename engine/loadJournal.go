@@ -6,26 +6,36 @@ package engine
 
 import (
 	"bufio"
-	"encoding/hex"
 	"fmt"
-	"os"
+	"io"
 	"strings"
 	"time"
 
 	"github.com/FactomProject/factomd/common/interfaces"
-	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/state"
 )
 
+// LoadJournal replays a journal, binary or in the old text format.
 func LoadJournal(s interfaces.IState, journal string) {
-	f, err := os.Open(journal)
+	LoadJournalFrom(s, journal, 0)
+}
+
+// LoadJournalFrom replays a binary journal from the first directory block at or after height, found by the
+// journal's index.  With a height of 0 it replays the whole journal, which may also be in the old text format.
+func LoadJournalFrom(s interfaces.IState, journal string, height uint32) {
+	var j *state.JournalReader
+	var err error
+	if 0 < height {
+		j, err = state.SeekJournal(journal, height)
+	} else {
+		j, err = state.OpenJournalReader(journal)
+	}
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	defer f.Close()
-	r := bufio.NewReaderSize(f, 4*1024)
-
-	LoadJournalFromReader(s, r)
+	defer j.Close()
+	loadJournal(s, j)
 }
 
 func LoadJournalFromString(s interfaces.IState, journalStr string) {
@@ -35,8 +45,19 @@ func LoadJournalFromString(s interfaces.IState, journalStr string) {
 }
 
 func LoadJournalFromReader(s interfaces.IState, r *bufio.Reader) {
+	j, err := state.NewJournalReader(r)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	loadJournal(s, j)
+}
+
+func loadJournal(s interfaces.IState, j *state.JournalReader) {
 	s.SetIsReplaying()
 	defer s.SetIsDoneReplaying()
+	replay.setReplaying(true)
+	defer replay.setReplaying(false)
 
 	fmt.Println("Replaying Journal")
 	time.Sleep(time.Second * 5)
@@ -47,42 +68,26 @@ func LoadJournalFromReader(s interfaces.IState, r *bufio.Reader) {
 		t++
 		fmt.Println("total: ", t, " processed: ", p, "            \r")
 
-		// line is empty if no more data
-		line, err := r.ReadBytes('\n')
-		if len(line) == 0 || err != nil {
+		record, err := j.Next()
+		if err == io.EOF {
 			break
 		}
-
-		// Get the next word.  If not MsgHex:, then go to next line.
-		adv, word, err := bufio.ScanWords(line, true)
-		if string(word) != "MsgHex:" {
-			continue // Go to next line.
-		}
-		line = line[adv:] // Remove "MsgHex:" from the line.
-
-		// Remove spaces.
-		adv, data, err := bufio.ScanWords(line, true)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		// Decode the hex
-		binary, err := hex.DecodeString(string(data))
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 
 		// Unmarshal the message.
-		msg, err := messages.UnmarshalMessage(binary)
+		msg, err := record.Message()
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 
-		// Process the message.
+		// Process the message, when the replay is ready for it.
+		replay.wait(s, msg)
 		s.InMsgQueue() <- msg
+		replay.feed(msg)
 		p++
 		if len(s.InMsgQueue()) > 200 {
 			for len(s.InMsgQueue()) > 50 {
@@ -0,0 +1,400 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// Network faults.  The links between simulated nodes can be given latency, jitter, a bandwidth cap, and can
+// drop, duplicate and reorder messages.  Links can be set one at a time, from or to a node, or all at once,
+// and the most specific setting wins.  Groups of nodes can also be partitioned from each other, for a time
+// or until healed.  All times are on the clock, so with -simclock they are virtual.
+//
+// The faults are set with flags (the defaults for every link), with j at the sim control prompt, and with
+// the faults, partition and heal steps of a scenario:
+//
+//	faults 0 * latency=2s              Everything node 0 sends takes 2 seconds to arrive
+//	faults * * jitter=50ms dist=normal Every link varies by about 50ms
+//	faults 1 2 bandwidth=10000 drop=5  1 to 2 carries 10000 bytes a second, and drops 5 messages in 1000
+//	partition 0,1/2,3,4 30s            Cut 0 and 1 off from 2, 3 and 4 for 30 seconds
+//	heal                               End every partition
+
+var ReorderDelay = 100 * time.Millisecond // How far a reordered message falls behind the ones sent after it
+
+// LinkFaults are the faults on a link between two simulated nodes.
+type LinkFaults struct {
+	Latency      time.Duration // How long a message takes to arrive
+	Jitter       time.Duration // How much the latency varies
+	Distribution string        // How the latency varies: uniform (+/- Jitter), normal or exponential
+	Bandwidth    int           // Bytes a second the link carries.  0 is unlimited
+	Drop         int           // Messages dropped, per thousand
+	Duplicate    int           // Messages delivered twice, per thousand
+	Reorder      int           // Messages overtaken by those sent after them, per thousand
+}
+
+// none returns true if the link is perfect, so messages can go straight through.
+func (lf LinkFaults) none() bool {
+	return 0 == lf.Latency && 0 == lf.Jitter && 0 == lf.Bandwidth && 0 == lf.Drop && 0 == lf.Duplicate &&
+		0 == lf.Reorder
+}
+
+// set sets one of the faults, from a key=value setting.
+func (lf *LinkFaults) set(setting string) error {
+	kv := strings.SplitN(setting, "=", 2)
+	if 2 != len(kv) {
+		return fmt.Errorf("expected key=value, found %q", setting)
+	}
+	key, value := kv[0], kv[1]
+	var err error
+	switch key {
+	case "latency":
+		lf.Latency, err = time.ParseDuration(value)
+	case "jitter":
+		lf.Jitter, err = time.ParseDuration(value)
+	case "dist":
+		switch value {
+		case "uniform", "normal", "exponential":
+			lf.Distribution = value
+		default:
+			err = fmt.Errorf("unknown distribution %q, use uniform, normal or exponential", value)
+		}
+	case "bandwidth":
+		lf.Bandwidth, err = faultNumber(value, 0)
+	case "drop":
+		lf.Drop, err = faultNumber(value, 1000)
+	case "duplicate":
+		lf.Duplicate, err = faultNumber(value, 1000)
+	case "reorder":
+		lf.Reorder, err = faultNumber(value, 1000)
+	default:
+		err = fmt.Errorf("unknown fault %q", key)
+	}
+	return err
+}
+
+func faultNumber(value string, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || (0 < max && n > max) {
+		return 0, fmt.Errorf("%q is out of range", value)
+	}
+	return n, nil
+}
+
+// delay returns how long a message takes to cross the link, not counting the bandwidth.
+func (lf LinkFaults) delay() time.Duration {
+	d := lf.Latency
+	if 0 < lf.Jitter {
+		switch lf.Distribution {
+		case "normal":
+			d += time.Duration(rand.NormFloat64() * float64(lf.Jitter))
+		case "exponential":
+			d += time.Duration(rand.ExpFloat64() * float64(lf.Jitter))
+		default:
+			d += time.Duration(rand.Int63n(2*int64(lf.Jitter)+1)) - lf.Jitter
+		}
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+func (lf LinkFaults) String() string {
+	s := fmt.Sprintf("latency=%s jitter=%s", lf.Latency, lf.Jitter)
+	if 0 < len(lf.Distribution) {
+		s += " dist=" + lf.Distribution
+	}
+	return s + fmt.Sprintf(" bandwidth=%d drop=%d duplicate=%d reorder=%d", lf.Bandwidth, lf.Drop, lf.Duplicate, lf.Reorder)
+}
+
+// netPartition cuts groups of nodes off from each other.
+type netPartition struct {
+	groups map[int]int // Node to group
+	until  time.Time   // When the partition heals; never if zero
+}
+
+// cuts returns true if the partition stands between two nodes.
+func (p netPartition) cuts(from, to int) bool {
+	gFrom, okFrom := p.groups[from]
+	gTo, okTo := p.groups[to]
+	return okFrom && okTo && gFrom != gTo
+}
+
+// anyNode stands for every node in a link.
+const anyNode = -1
+
+type netFaults struct {
+	sync.RWMutex
+	links      map[[2]int]LinkFaults // From node to node, either of which may be anyNode
+	partitions []netPartition
+}
+
+// faults are the faults on the simulated network.
+var faults = newNetFaults()
+
+func newNetFaults() *netFaults {
+	n := new(netFaults)
+	n.links = make(map[[2]int]LinkFaults)
+	return n
+}
+
+// setLink sets the faults on the links from one node to another, either of which may be anyNode.
+func (n *netFaults) setLink(from, to int, lf LinkFaults) {
+	n.Lock()
+	defer n.Unlock()
+	n.links[[2]int{from, to}] = lf
+}
+
+// link returns the faults on the link from one node to another.
+func (n *netFaults) link(from, to int) LinkFaults {
+	n.RLock()
+	defer n.RUnlock()
+	for _, key := range [][2]int{{from, to}, {from, anyNode}, {anyNode, to}, {anyNode, anyNode}} {
+		if lf, ok := n.links[key]; ok {
+			return lf
+		}
+	}
+	return LinkFaults{}
+}
+
+// partition cuts groups of nodes off from each other, for a time, or until healed if the time is 0.
+func (n *netFaults) partition(groups [][]int, d time.Duration) {
+	p := netPartition{groups: make(map[int]int)}
+	for g, group := range groups {
+		for _, node := range group {
+			p.groups[node] = g
+		}
+	}
+	if 0 < d {
+		p.until = primitives.GetClock().Now().Add(d)
+	}
+	n.Lock()
+	defer n.Unlock()
+	n.partitions = append(n.partitions, p)
+}
+
+// heal ends every partition.
+func (n *netFaults) heal() {
+	n.Lock()
+	defer n.Unlock()
+	n.partitions = nil
+}
+
+// partitioned returns true if a partition stands between two nodes.
+func (n *netFaults) partitioned(from, to int) bool {
+	now := primitives.GetClock().Now()
+	n.Lock()
+	defer n.Unlock()
+	standing := n.partitions[:0]
+	cut := false
+	for _, p := range n.partitions {
+		if !p.until.IsZero() && !now.Before(p.until) {
+			continue
+		}
+		standing = append(standing, p)
+		cut = cut || p.cuts(from, to)
+	}
+	n.partitions = standing
+	return cut
+}
+
+func (n *netFaults) String() string {
+	n.RLock()
+	defer n.RUnlock()
+	node := func(i int) string {
+		if anyNode == i {
+			return "*"
+		}
+		return strconv.Itoa(i)
+	}
+	keys := [][2]int{}
+	for key := range n.links {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+	s := ""
+	for _, key := range keys {
+		s += fmt.Sprintf("%3s -> %-3s %s\n", node(key[0]), node(key[1]), n.links[key])
+	}
+	for _, p := range n.partitions {
+		groups := map[int][]string{}
+		for member, g := range p.groups {
+			groups[g] = append(groups[g], strconv.Itoa(member))
+		}
+		parts := []string{}
+		for g := 0; g < len(groups); g++ {
+			sort.Strings(groups[g])
+			parts = append(parts, strings.Join(groups[g], ","))
+		}
+		until := "until healed"
+		if !p.until.IsZero() {
+			until = "until " + p.until.Format("15:04:05")
+		}
+		s += fmt.Sprintf("partition %s %s\n", strings.Join(parts, "/"), until)
+	}
+	if 0 == len(s) {
+		return "No network faults\n"
+	}
+	return s
+}
+
+// parseFaultNode parses a node in a link, where * is every node.
+func parseFaultNode(s string) (int, error) {
+	if "*" == s {
+		return anyNode, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a node or *, found %q", s)
+	}
+	return n, nil
+}
+
+// parseFaults parses the arguments of a faults command: <from> <to> key=value...  The settings are
+// applied over the faults the links have now.
+func parseFaults(args []string) (from, to int, settings []string, err error) {
+	if len(args) < 3 {
+		return 0, 0, nil, fmt.Errorf("expected: faults <from|*> <to|*> key=value...")
+	}
+	if from, err = parseFaultNode(args[0]); err != nil {
+		return
+	}
+	if to, err = parseFaultNode(args[1]); err != nil {
+		return
+	}
+	var lf LinkFaults
+	for _, setting := range args[2:] {
+		if err = lf.set(setting); err != nil {
+			return
+		}
+	}
+	return from, to, args[2:], nil
+}
+
+// applyFaults applies settings parsed by parseFaults.
+func applyFaults(from, to int, settings []string) {
+	lf := faults.link(from, to)
+	for _, setting := range settings {
+		lf.set(setting)
+	}
+	faults.setLink(from, to, lf)
+}
+
+// parsePartition parses the arguments of a partition command: <nodes>/<nodes>... [duration]
+func parsePartition(args []string) (groups [][]int, d time.Duration, err error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, 0, fmt.Errorf("expected: partition <nodes>/<nodes>... [duration]")
+	}
+	for _, group := range strings.Split(args[0], "/") {
+		nodes := []int{}
+		for _, member := range strings.Split(group, ",") {
+			n, err := strconv.Atoi(member)
+			if err != nil || n < 0 {
+				return nil, 0, fmt.Errorf("expected a node, found %q", member)
+			}
+			nodes = append(nodes, n)
+		}
+		groups = append(groups, nodes)
+	}
+	if len(groups) < 2 {
+		return nil, 0, fmt.Errorf("a partition needs at least two groups of nodes")
+	}
+	if 2 == len(args) {
+		if d, err = time.ParseDuration(args[1]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return groups, d, nil
+}
+
+// inFlight is a message on its way across a link with faults.
+type inFlight struct {
+	due  time.Time
+	data []byte
+}
+
+// transmit sends a message across the link, suffering whatever faults it has.
+func (f *SimPeer) transmit(data []byte) {
+	if faults.partitioned(f.fromNode, f.toNode) {
+		atomic.AddInt64(&f.dropped, 1)
+		return
+	}
+	lf := faults.link(f.fromNode, f.toNode)
+	if lf.none() {
+		f.BroadcastOut <- data
+		return
+	}
+	if rand.Intn(1000) < lf.Drop {
+		atomic.AddInt64(&f.dropped, 1)
+		return
+	}
+	f.schedule(data, lf)
+	if rand.Intn(1000) < lf.Duplicate {
+		f.schedule(data, lf)
+	}
+}
+
+// schedule works out when a message arrives, and sets it to be delivered then.
+func (f *SimPeer) schedule(data []byte, lf LinkFaults) {
+	clock := primitives.GetClock()
+	f.flightLock.Lock()
+	now := clock.Now()
+	sent := now
+	if 0 < lf.Bandwidth {
+		if f.busyUntil.After(sent) {
+			sent = f.busyUntil
+		}
+		sent = sent.Add(time.Duration(len(data)) * time.Second / time.Duration(lf.Bandwidth))
+		f.busyUntil = sent
+	}
+	due := sent.Add(lf.delay())
+	if rand.Intn(1000) < lf.Reorder {
+		due = due.Add(lf.Latency + lf.Jitter + ReorderDelay)
+	} else {
+		// Jitter changes how long messages take, but like a real connection the link keeps them in order.
+		if due.Before(f.lastDue) {
+			due = f.lastDue
+		}
+		f.lastDue = due
+	}
+	message := inFlight{due: due, data: data}
+	i := sort.Search(len(f.flight), func(i int) bool { return message.due.Before(f.flight[i].due) })
+	f.flight = append(f.flight, inFlight{})
+	copy(f.flight[i+1:], f.flight[i:])
+	f.flight[i] = message
+	f.flightLock.Unlock()
+
+	go func() {
+		clock.Sleep(due.Sub(now))
+		f.deliverDue(clock.Now())
+	}()
+}
+
+// deliverDue delivers the messages that have arrived by now, in the order they arrived.
+func (f *SimPeer) deliverDue(now time.Time) {
+	f.flightLock.Lock()
+	defer f.flightLock.Unlock()
+	i := 0
+	for ; i < len(f.flight) && !now.Before(f.flight[i].due); i++ {
+		if len(f.BroadcastOut) < 9000 {
+			f.BroadcastOut <- f.flight[i].data
+		} else {
+			atomic.AddInt64(&f.dropped, 1)
+		}
+	}
+	f.flight = f.flight[i:]
+}
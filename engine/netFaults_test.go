@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// testLink returns a link from node 0 to node 1, and a virtual clock for it to keep time with.
+func testLink(t *testing.T) (*SimPeer, *primitives.SimClock) {
+	faults = newNetFaults()
+	clock := primitives.NewSimClock(SimClockStart)
+	primitives.SetClock(clock)
+	peer := new(SimPeer).Init("FNode0", "FNode1").(*SimPeer)
+	peer.fromNode, peer.toNode = 0, 1
+	return peer, clock
+}
+
+// arrived waits for the messages in flight to be delivered, and returns how many have been.
+func arrived(peer *SimPeer, want int) int {
+	for i := 0; i < 1000 && len(peer.BroadcastOut) < want; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	return len(peer.BroadcastOut)
+}
+
+func TestLinkFaults(t *testing.T) {
+	defer primitives.SetClock(primitives.GetClock())
+	peer, clock := testLink(t)
+
+	// A perfect link delivers at once.
+	peer.transmit([]byte{1})
+	if 1 != len(peer.BroadcastOut) {
+		t.Fatalf("A link without faults held the message")
+	}
+	<-peer.BroadcastOut
+
+	from, to, settings, err := parseFaults([]string{"0", "*", "latency=1s", "duplicate=1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyFaults(from, to, settings)
+	peer.transmit([]byte{2})
+	for clock.Sleepers() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if 0 != len(peer.BroadcastOut) {
+		t.Errorf("Delivered before the latency was up")
+	}
+	clock.Advance()
+	if 2 != arrived(peer, 2) {
+		t.Errorf("Expected the message twice once the latency was up, got %d", len(peer.BroadcastOut))
+	}
+	if !clock.Now().Equal(SimClockStart.Add(time.Second)) {
+		t.Errorf("Clock at %s, expected it to move on by the latency", clock.Now())
+	}
+
+	// A more specific setting wins, and settings add to those the link has.
+	applyFaults(0, 1, []string{"drop=1000"})
+	if lf := faults.link(0, 1); time.Second != lf.Latency || 1000 != lf.Drop {
+		t.Errorf("Link faults %s", lf)
+	}
+	if lf := faults.link(2, 1); !lf.none() {
+		t.Errorf("Faults on an unrelated link %s", lf)
+	}
+	peer.transmit([]byte{3})
+	if 0 != clock.Sleepers() {
+		t.Errorf("Dropped message went on its way")
+	}
+}
+
+func TestLinkCongestion(t *testing.T) {
+	defer primitives.SetClock(primitives.GetClock())
+	peer, clock := testLink(t)
+
+	// A message that arrives to a full queue is lost, and counted as dropped.
+	for i := 0; i < 9000; i++ {
+		peer.BroadcastOut <- []byte{0}
+	}
+	peer.flight = []inFlight{{due: clock.Now(), data: []byte{1}}}
+	peer.deliverDue(clock.Now())
+	if 9000 != len(peer.BroadcastOut) || 0 != len(peer.flight) {
+		t.Errorf("%d queued and %d in flight, expected the message gone", len(peer.BroadcastOut), len(peer.flight))
+	}
+	if 1 != atomic.LoadInt64(&peer.dropped) {
+		t.Errorf("%d dropped, expected 1", atomic.LoadInt64(&peer.dropped))
+	}
+}
+
+func TestLinkBandwidth(t *testing.T) {
+	defer primitives.SetClock(primitives.GetClock())
+	peer, clock := testLink(t)
+	applyFaults(anyNode, anyNode, []string{"bandwidth=100"})
+
+	// 100 bytes a second: the first message takes a second to send, and the second one waits for it.
+	peer.transmit(make([]byte, 100))
+	peer.transmit(make([]byte, 100))
+	for clock.Sleepers() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance()
+	if 1 != arrived(peer, 1) {
+		t.Errorf("Expected one message after a second, got %d", len(peer.BroadcastOut))
+	}
+	clock.Advance()
+	if 2 != arrived(peer, 2) || !clock.Now().Equal(SimClockStart.Add(2*time.Second)) {
+		t.Errorf("Expected the second message after two seconds, got %d at %s", len(peer.BroadcastOut), clock.Now())
+	}
+}
+
+func TestLinkOrder(t *testing.T) {
+	defer primitives.SetClock(primitives.GetClock())
+	peer, clock := testLink(t)
+
+	// Jitter alone never reorders messages.
+	applyFaults(anyNode, anyNode, []string{"latency=100ms", "jitter=90ms"})
+	for i := byte(0); i < 50; i++ {
+		peer.transmit([]byte{i})
+	}
+	for clock.Sleepers() < 50 {
+		time.Sleep(time.Millisecond)
+	}
+	for 0 < clock.Sleepers() {
+		clock.Advance()
+	}
+	arrived(peer, 50)
+	for i := byte(0); i < 50; i++ {
+		if data := <-peer.BroadcastOut; i != data[0] {
+			t.Fatalf("Message %d arrived in place of %d", data[0], i)
+		}
+	}
+
+	// Reordered messages are overtaken.
+	applyFaults(anyNode, anyNode, []string{"reorder=1000"})
+	peer.transmit([]byte{1})
+	applyFaults(anyNode, anyNode, []string{"reorder=0"})
+	peer.transmit([]byte{2})
+	for clock.Sleepers() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	for 0 < clock.Sleepers() {
+		clock.Advance()
+	}
+	arrived(peer, 2)
+	if first := <-peer.BroadcastOut; 2 != first[0] {
+		t.Errorf("The reordered message wasn't overtaken")
+	}
+}
+
+func TestPartition(t *testing.T) {
+	defer primitives.SetClock(primitives.GetClock())
+	peer, clock := testLink(t)
+
+	groups, d, err := parsePartition([]string{"0,2/1", "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	faults.partition(groups, d)
+	if !faults.partitioned(0, 1) || !faults.partitioned(1, 2) || faults.partitioned(0, 2) || faults.partitioned(0, 3) {
+		t.Errorf("Partition cut the wrong links")
+	}
+	peer.transmit([]byte{1})
+	if 0 != len(peer.BroadcastOut) {
+		t.Errorf("Message crossed the partition")
+	}
+	clock.AdvanceBy(5 * time.Second)
+	if faults.partitioned(0, 1) {
+		t.Errorf("Partition outlasted its time")
+	}
+
+	faults.partition(groups, 0)
+	faults.heal()
+	if faults.partitioned(0, 1) {
+		t.Errorf("Partition outlasted the heal")
+	}
+
+	for _, bad := range [][]string{{"0,1"}, {"0/x"}, {"0/1", "soon"}, {"0/1", "5s", "more"}} {
+		if _, _, err := parsePartition(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+	for _, bad := range [][]string{{"0", "1"}, {"x", "1", "drop=1"}, {"0", "1", "drop"}, {"0", "1", "drop=1001"},
+		{"0", "1", "dist=odd"}, {"0", "1", "color=red"}} {
+		if _, _, _, err := parseFaults(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
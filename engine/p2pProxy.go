@@ -10,6 +10,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/FactomProject/factomd/common/constants"
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/messages"
 	"github.com/FactomProject/factomd/p2p"
@@ -34,11 +35,29 @@ type P2PProxy struct {
 	logWriter bufio.Writer
 	debugMode int
 	logging   chan interface{} // NODE_TALK_FIX
+
+	router  *requestRouter     // Picks the peers requests go to
+	capture *p2p.CaptureWriter // Records the parcels we receive, if set
 }
 
 type factomMessage struct {
 	message  []byte
 	peerHash string
+	priority uint8
+}
+
+// messagePriority picks the p2p priority for a message.  Consensus messages go out ahead of everything,
+// and catch up traffic waits behind everything else when bandwidth is short.
+func messagePriority(msg interfaces.IMsg) uint8 {
+	switch msg.Type() {
+	case constants.ACK_MSG, constants.EOM_MSG, constants.DIRECTORY_BLOCK_SIGNATURE_MSG,
+		constants.FED_SERVER_FAULT_MSG, constants.MISSING_MSG, constants.MISSING_MSG_RESPONSE:
+		return p2p.PriorityHigh
+	case constants.DBSTATE_MSG, constants.DBSTATE_MISSING_MSG, constants.DATA_RESPONSE:
+		return p2p.PriorityBulk
+	default:
+		return p2p.PriorityNormal
+	}
 }
 
 var _ interfaces.IPeer = (*P2PProxy)(nil)
@@ -49,6 +68,7 @@ func (f *P2PProxy) Init(fromName, toName string) interfaces.IPeer {
 	f.BroadcastOut = make(chan interface{}, p2p.StandardChannelSize)
 	f.BroadcastIn = make(chan interface{}, p2p.StandardChannelSize)
 	f.logging = make(chan interface{}, p2p.StandardChannelSize)
+	f.router = newRequestRouter(nil)
 	return f
 }
 func (f *P2PProxy) SetDebugMode(netdebug int) {
@@ -70,9 +90,14 @@ func (f *P2PProxy) Send(msg interfaces.IMsg) error {
 		fmt.Println("ERROR on Send: ", err)
 		return err
 	}
-	message := factomMessage{message: data, peerHash: msg.GetNetworkOrigin()}
+	message := factomMessage{message: data, peerHash: msg.GetNetworkOrigin(), priority: messagePriority(msg)}
 	if !msg.IsPeer2Peer() {
 		message.peerHash = ""
+	} else if "" == message.peerHash {
+		// A request of our own, rather than a reply to a peer.
+		if key, height, ok := requestKey(msg); ok {
+			message.peerHash = f.router.route(key, height, message)
+		}
 	}
 	p2p.BlockFreeChannelSend(f.BroadcastOut, message)
 	return nil
@@ -89,6 +114,7 @@ func (f *P2PProxy) Recieve() (interfaces.IMsg, error) {
 				msg, err := messages.UnmarshalMessage(fmessage.message)
 				if nil == err {
 					msg.SetNetworkOrigin(fmessage.peerHash)
+					f.router.observe(msg)
 				}
 				if 1 < f.debugMode {
 					f.logMessage(msg, true) // NODE_TALK_FIX
@@ -129,19 +155,28 @@ func (f *P2PProxy) Len() int {
 //////////////////////////////////////////////////////////////////////////////////////////////////
 //////////////////////////////////////////////////////////////////////////////////////////////////
 
-func (p *P2PProxy) startProxy() {
+func (p *P2PProxy) Start() {
 	if 1 < p.debugMode {
 		go p.ManageLogging()
 	}
 	go p.ManageOutChannel() // Bridges between network format Parcels and factomd messages (incl. addressing to peers)
 	go p.ManageInChannel()
+	go p.ManageRequests()
 }
 
-// NODE_TALK_FIX
-func (p *P2PProxy) stopProxy() {
+func (p *P2PProxy) Stop() {
+	// NODE_TALK_FIX
 	if 0 < p.debugMode {
 		p2p.BlockFreeChannelSend(p.logging, "stop")
 	}
+	if nil != p.capture {
+		p.capture.Close()
+	}
+}
+
+// Capture records the parcels we receive from the network to a capture, for ReplayTransport.
+func (p *P2PProxy) Capture(capture *p2p.CaptureWriter) {
+	p.capture = capture
 }
 
 type messageLog struct {
@@ -202,6 +237,7 @@ func (f *P2PProxy) ManageOutChannel() {
 			parcel := p2p.NewParcel(p2p.CurrentNetwork, fmessage.message)
 			parcel.Header.Type = p2p.TypeMessage
 			parcel.Header.TargetPeer = fmessage.peerHash
+			parcel.SetPriority(fmessage.priority)
 			p2p.BlockFreeChannelSend(f.ToNetwork, *parcel)
 		default:
 			fmt.Printf("Garbage on f.BrodcastOut. %+v", data)
@@ -209,12 +245,27 @@ func (f *P2PProxy) ManageOutChannel() {
 	}
 }
 
+// ManageRequests sends requests that weren't answered in time to another peer.
+func (f *P2PProxy) ManageRequests() {
+	for {
+		time.Sleep(RequestTimeout / 4)
+		for _, message := range f.router.expired() {
+			p2p.BlockFreeChannelSend(f.BroadcastOut, message)
+		}
+	}
+}
+
 // manageInChannel takes messages from the network and stuffs it in the f.BroadcastIn channel
 func (f *P2PProxy) ManageInChannel() {
 	for data := range f.FromNetwork {
 		switch data.(type) {
 		case p2p.Parcel:
 			parcel := data.(p2p.Parcel)
+			if nil != f.capture {
+				if err := f.capture.Write(parcel); nil != err {
+					fmt.Printf("Error writing to the network capture. %v", err)
+				}
+			}
 			message := factomMessage{message: parcel.Payload, peerHash: parcel.Header.TargetPeer}
 			p2p.BlockFreeChannelSend(f.BroadcastIn, message)
 		default:
@@ -0,0 +1,83 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// Peer scoring.  The p2p network can only judge a peer by its parcels; whether the messages in them are any
+// good is up to us.  We tell the network what we thought of each message that came from a peer, and the
+// p2p.Controller disconnects, and then bans, peers whose score drops too far.
+
+// Adjustments to a peer's score for the messages it sends us
+var (
+	ScoreInvalidSignature int32 = -50 // A message whose signature doesn't check out
+	ScoreInvalidMessage   int32 = -2  // A message that failed Validate
+	ScoreDuplicateFlood   int32 = -20 // Too many messages we have already seen, each time DuplicateFloodLimit is passed
+	ScoreUsefulData       int32 = 1   // A DataResponse that gave us something we asked for
+)
+
+// A peer that sends more than DuplicateFloodLimit duplicate (or out of date) messages within
+// DuplicateFloodWindow is flooding us.  Every peer relays what its other peers send, so some duplicates
+// are normal.
+var (
+	DuplicateFloodLimit  = 2000
+	DuplicateFloodWindow = time.Minute
+)
+
+// signedMessage is a message that can check its own signature.
+type signedMessage interface {
+	VerifySignature() (bool, error)
+}
+
+// scorePeer passes an adjustment for the peer msg came from to the p2p network.  Messages from the API, or
+// from simulated peers, have no network origin and are not scored.
+func scorePeer(msg interfaces.IMsg, adjustment int32) {
+	if p2pNetwork == nil || len(msg.GetNetworkOrigin()) == 0 {
+		return
+	}
+	p2pNetwork.AdjustPeerQuality(msg.GetNetworkOrigin(), adjustment)
+}
+
+// invalidMessageScore returns how hard to mark down the peer that sent an invalid message.  A bad signature
+// is either an attack or a broken node, where a failed Validate can just be a peer that's behind.
+func invalidMessageScore(msg interfaces.IMsg) int32 {
+	if signed, ok := msg.(signedMessage); ok {
+		if valid, _ := signed.VerifySignature(); !valid {
+			return ScoreInvalidSignature
+		}
+	}
+	return ScoreInvalidMessage
+}
+
+// floodDetector counts the duplicate messages from each peer over a window.
+type floodDetector struct {
+	windowStart time.Time
+	duplicates  map[string]int
+}
+
+func newFloodDetector() *floodDetector {
+	f := new(floodDetector)
+	f.windowStart = time.Now()
+	f.duplicates = make(map[string]int)
+	return f
+}
+
+// duplicate counts a duplicate from origin, and returns true each time the peer passes DuplicateFloodLimit
+// within the window.
+func (f *floodDetector) duplicate(origin string) bool {
+	if len(origin) == 0 {
+		return false
+	}
+	if time.Since(f.windowStart) > DuplicateFloodWindow {
+		f.windowStart = time.Now()
+		f.duplicates = make(map[string]int)
+	}
+	f.duplicates[origin]++
+	return f.duplicates[origin]%DuplicateFloodLimit == 0
+}
@@ -0,0 +1,191 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/p2p"
+)
+
+// ReplayTransport drives a node from traffic captured off the network by P2PProxy (see -netcapture),
+// delivering each message at the time it originally arrived, by the node's clock (primitives.GetClock).  The
+// messages keep the timestamps they were captured with, so the clock must keep the time of the capture, from
+// CaptureStart, or the node will refuse them as replays once the capture is a few hours old; see
+// netReplayClock.  The node's own messages go nowhere.  Messages keep the network origin they were captured
+// with, so replies and peer scoring see the same peers.
+type ReplayTransport struct {
+	FromName string
+	ToName   string
+
+	BroadcastIn chan interface{} // factomMessages that are due
+	Done        chan bool        // Closed when the capture has been played
+
+	capture *p2p.CaptureReader
+	closer  io.Closer
+	stop    chan bool
+	sent    int64 // Messages from the node, dropped
+}
+
+var _ interfaces.IPeer = (*ReplayTransport)(nil)
+
+func (f *ReplayTransport) Init(fromName, toName string) interfaces.IPeer {
+	f.FromName = fromName
+	f.ToName = toName
+	f.BroadcastIn = make(chan interface{}, p2p.StandardChannelSize)
+	f.Done = make(chan bool)
+	f.stop = make(chan bool)
+	return f
+}
+
+// Open sets the capture file to replay.
+func (f *ReplayTransport) Open(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if err := f.SetCapture(file); err != nil {
+		file.Close()
+		return err
+	}
+	return nil
+}
+
+// SetCapture sets the capture to replay.  It is closed, if it can be, when the replay ends.
+func (f *ReplayTransport) SetCapture(r io.Reader) error {
+	capture, err := p2p.NewCaptureReader(r)
+	if err != nil {
+		return err
+	}
+	f.capture = capture
+	f.closer, _ = r.(io.Closer)
+	return nil
+}
+
+// CaptureStart returns when the capture being replayed started.
+func (f *ReplayTransport) CaptureStart() time.Time {
+	return f.capture.Start()
+}
+
+func (f *ReplayTransport) Start() {
+	go f.replay()
+}
+
+func (f *ReplayTransport) Stop() {
+	select {
+	case <-f.stop:
+	default:
+		close(f.stop)
+	}
+}
+
+// replay feeds the capture into BroadcastIn, waiting for each message's time to come.  It blocks rather
+// than drop messages if the node falls behind, so a replay always delivers the same messages in the same
+// order.
+func (f *ReplayTransport) replay() {
+	defer close(f.Done)
+	if f.closer != nil {
+		defer f.closer.Close()
+	}
+	clock := primitives.GetClock()
+	for {
+		at, parcel, err := f.capture.Next()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println("ReplayTransport: error reading the capture:", err)
+			}
+			fmt.Printf("ReplayTransport: capture played, %d messages from the node dropped\n", atomic.LoadInt64(&f.sent))
+			return
+		}
+		if wait := f.capture.Start().Add(at).Sub(clock.Now()); 0 < wait && !f.sleep(clock, wait) {
+			return
+		}
+		if parcel.Header.Type != p2p.TypeMessage {
+			continue
+		}
+		select {
+		case f.BroadcastIn <- factomMessage{message: parcel.Payload, peerHash: parcel.Header.TargetPeer}:
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// sleep sleeps on the clock for d, and returns false if the replay is stopped first.
+func (f *ReplayTransport) sleep(clock interfaces.IClock, d time.Duration) bool {
+	woke := make(chan bool)
+	go func() {
+		clock.Sleep(d)
+		close(woke)
+	}()
+	select {
+	case <-woke:
+		return true
+	case <-f.stop:
+		return false
+	}
+}
+
+// netReplayClock returns the clock a node replaying a capture from start at speed keeps: the time of the
+// capture, at speed times the pace it was captured at, or if speed is 0, a SimClock that moves on as fast as
+// the node can take the messages.
+func netReplayClock(start time.Time, speed float64) interfaces.IClock {
+	if speed <= 0 {
+		return primitives.NewSimClock(start)
+	}
+	return primitives.NewScaledClock(start, speed)
+}
+
+func (f *ReplayTransport) GetNameFrom() string {
+	return f.FromName
+}
+
+func (f *ReplayTransport) GetNameTo() string {
+	return f.ToName
+}
+
+// Send drops the message; there is nobody to send it to.
+func (f *ReplayTransport) Send(msg interfaces.IMsg) error {
+	atomic.AddInt64(&f.sent, 1)
+	return nil
+}
+
+// Non-blocking return value from channel.
+func (f *ReplayTransport) Recieve() (interfaces.IMsg, error) {
+	select {
+	case data, ok := <-f.BroadcastIn:
+		if ok {
+			fmessage := data.(factomMessage)
+			msg, err := messages.UnmarshalMessage(fmessage.message)
+			if nil == err {
+				msg.SetNetworkOrigin(fmessage.peerHash)
+			}
+			return msg, err
+		}
+	default:
+	}
+	return nil, nil
+}
+
+// Is this connection equal to parm connection
+func (f *ReplayTransport) Equals(ff interfaces.IPeer) bool {
+	f2, ok := ff.(*ReplayTransport)
+	if !ok {
+		return false
+	}
+	return f.FromName == f2.FromName && f.ToName == f2.ToName
+}
+
+// Returns the number of messages waiting to be read
+func (f *ReplayTransport) Len() int {
+	return len(f.BroadcastIn)
+}
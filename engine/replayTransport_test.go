@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/constants"
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/p2p"
+	"github.com/FactomProject/factomd/state"
+)
+
+func TestReplayTransport(t *testing.T) {
+	request := new(messages.DBStateMissing)
+	request.Timestamp = primitives.NewTimestampNow()
+	request.DBHeightStart = 10
+	request.DBHeightEnd = 12
+	payload, err := request.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	capture := p2p.NewCaptureWriter(&buf, time.Now)
+	parcel := p2p.NewParcel(p2p.CurrentNetwork, payload)
+	parcel.Header.TargetPeer = "peer"
+	capture.Write(*parcel)
+	capture.Close()
+
+	replay := new(ReplayTransport).Init("node", "replay").(*ReplayTransport)
+	if err := replay.SetCapture(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	replay.Start()
+	defer replay.Stop()
+
+	select {
+	case <-replay.Done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("The replay did not finish")
+	}
+	msg, err := replay.Recieve()
+	if err != nil || msg == nil {
+		t.Fatalf("Recieve() = %v, %v", msg, err)
+	}
+	missing, ok := msg.(*messages.DBStateMissing)
+	if !ok || 10 != missing.DBHeightStart || 12 != missing.DBHeightEnd {
+		t.Errorf("Replayed %+v, expected the captured request", msg)
+	}
+	if "peer" != msg.GetNetworkOrigin() {
+		t.Errorf("Replayed from %q, expected the captured origin", msg.GetNetworkOrigin())
+	}
+	if msg, _ := replay.Recieve(); msg != nil {
+		t.Errorf("Replayed %+v after the end of the capture", msg)
+	}
+	if err := replay.Send(request); err != nil {
+		t.Errorf("Send() = %v", err)
+	}
+}
+
+// A capture replayed long after it was taken keeps its time, so the node doesn't refuse the messages in it as
+// too old.
+func TestReplayOldCapture(t *testing.T) {
+	captured := time.Now().Add(-6 * time.Hour)
+	captureClock := primitives.NewSimClock(captured)
+	var buf bytes.Buffer
+	capture := p2p.NewCaptureWriter(&buf, captureClock.Now)
+	captureClock.AdvanceBy(time.Minute)
+	request := new(messages.DBStateMissing)
+	request.Timestamp = primitives.NewTimestampFromMilliseconds(uint64(captureClock.Now().UnixNano() / 1e6))
+	request.DBHeightStart = 10
+	request.DBHeightEnd = 12
+	payload, err := request.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	capture.Write(*p2p.NewParcel(p2p.CurrentNetwork, payload))
+	capture.Close()
+
+	replay := new(ReplayTransport).Init("node", "replay").(*ReplayTransport)
+	if err := replay.SetCapture(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !captured.Equal(replay.CaptureStart()) {
+		t.Fatalf("Capture started at %s, expected %s", replay.CaptureStart(), captured)
+	}
+
+	// As fast as the node can take it, on a SimClock at the time of the capture.
+	clock, ok := netReplayClock(replay.CaptureStart(), 0).(*primitives.SimClock)
+	if !ok {
+		t.Fatalf("Expected a SimClock to replay as fast as the node can take it")
+	}
+	defer primitives.SetClock(primitives.GetClock())
+	primitives.SetClock(clock)
+	replay.Start()
+	defer replay.Stop()
+	for deadline := time.Now().Add(5 * time.Second); 0 == replay.Len(); {
+		if time.Now().After(deadline) {
+			t.Fatal("The replay did not deliver the message")
+		}
+		clock.Advance() // The minute into the capture the message came
+		time.Sleep(time.Millisecond)
+	}
+	msg, err := replay.Recieve()
+	if err != nil || msg == nil {
+		t.Fatalf("Recieve() = %v, %v", msg, err)
+	}
+	if !captured.Add(time.Minute).Equal(clock.Now()) {
+		t.Errorf("Delivered at %s, expected a minute into the capture", clock.Now())
+	}
+
+	// The node takes the message by the replay's clock, where by the wall clock it is hours old.
+	if !new(state.Replay).IsTSValid_(constants.NETWORK_REPLAY, msg.GetRepeatHash().Fixed(), msg.GetTimestamp(), primitives.NewTimestampNow()) {
+		t.Errorf("Refused the replayed message by the time of the capture")
+	}
+	if new(state.Replay).IsTSValid_(constants.NETWORK_REPLAY, msg.GetRepeatHash().Fixed(), msg.GetTimestamp(), primitives.NewTimestampFromMilliseconds(uint64(time.Now().UnixNano()/1e6))) {
+		t.Errorf("Took a message six hours old by the wall clock")
+	}
+
+	// At a pace, the time of the capture moves on with the real time.
+	scaled := netReplayClock(replay.CaptureStart(), 2)
+	if now := scaled.Now(); now.Before(captured) || now.After(captured.Add(time.Minute)) {
+		t.Errorf("Replaying at %s, expected the time of the capture %s", now, captured)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+)
+
+// Directed requests.  Rather than asking every peer for missing messages, DBStates and data, the P2PProxy
+// sends each request to one peer that has shown it is at or past the height the request is for, either in
+// its handshake or in the consensus messages it sends us.  If no answer comes back within RequestTimeout the
+// peer is marked slow, and the request goes to another peer.  Slow peers are passed over for
+// SlowPeerTimeout.  When no peer is known to have the data, the request is broadcast as it always was.
+
+var (
+	RequestTimeout  = time.Second * 4 // How long a peer has to answer a request
+	SlowPeerTimeout = time.Minute     // How long a peer that let a request time out is passed over
+	MaxRequestTries = 3               // How many peers we ask before leaving it to the state to ask again
+)
+
+// pendingRequest is a request we've sent to a peer and not yet had answered.
+type pendingRequest struct {
+	message factomMessage   // The request, for resending
+	height  uint32          // The height a peer must have reached to answer it
+	asked   map[string]bool // The peers we've asked
+	peer    string          // The peer we asked last
+	sent    time.Time       // When we asked it
+	tries   int             // How many times it has timed out
+}
+
+// requestRouter picks the peers requests go to.  The proxy's send, receive and retry goroutines all use it.
+type requestRouter struct {
+	sync.Mutex
+	peerHeights func() map[string]uint32   // The connected peers, with the heights from their handshakes
+	heights     map[string]uint32          // The highest height each peer has shown us since
+	slow        map[string]time.Time       // When each slow peer last let a request time out
+	pending     map[string]*pendingRequest // Indexed by requestKey
+}
+
+func newRequestRouter(peerHeights func() map[string]uint32) *requestRouter {
+	r := new(requestRouter)
+	r.peerHeights = peerHeights
+	r.heights = make(map[string]uint32)
+	r.slow = make(map[string]time.Time)
+	r.pending = make(map[string]*pendingRequest)
+	return r
+}
+
+// requestKey returns the key that matches a request to its answer, and the height a peer must have reached
+// to answer it.  ok is false for messages that aren't requests.
+func requestKey(msg interfaces.IMsg) (key string, height uint32, ok bool) {
+	switch m := msg.(type) {
+	case *messages.DBStateMissing:
+		return fmt.Sprintf("dbstate %d", m.DBHeightStart), m.DBHeightStart, true
+	case *messages.MissingMsg:
+		// Anyone working on the process list at DBHeight has saved the block before it.
+		if 0 < m.DBHeight {
+			height = m.DBHeight - 1
+		}
+		return fmt.Sprintf("msg %d/%d/%d", m.DBHeight, m.VMIndex, m.ProcessListHeight), height, true
+	case *messages.MissingData:
+		if m.RequestHash == nil {
+			return "", 0, false
+		}
+		return fmt.Sprintf("data %x", m.RequestHash.Bytes()), 0, true
+	}
+	return "", 0, false
+}
+
+// responseKey returns the key of the request a message answers.
+func responseKey(msg interfaces.IMsg) (string, bool) {
+	switch m := msg.(type) {
+	case *messages.DBStateMsg:
+		if m.DirectoryBlock != nil {
+			return fmt.Sprintf("dbstate %d", m.DirectoryBlock.GetHeader().GetDBHeight()), true
+		}
+	case *messages.MissingMsgResponse:
+		if ack, ok := m.AckResponse.(*messages.Ack); ok {
+			return fmt.Sprintf("msg %d/%d/%d", ack.DBHeight, ack.VMIndex, ack.Height), true
+		}
+	case *messages.DataResponse:
+		if m.DataHash != nil {
+			return fmt.Sprintf("data %x", m.DataHash.Bytes()), true
+		}
+	}
+	return "", false
+}
+
+// shownHeight returns the saved height a message from a peer shows the peer has reached.
+func shownHeight(msg interfaces.IMsg) (uint32, bool) {
+	var working uint32
+	switch m := msg.(type) {
+	case *messages.DBStateMsg:
+		if m.DirectoryBlock == nil {
+			return 0, false
+		}
+		return m.DirectoryBlock.GetHeader().GetDBHeight(), true
+	case *messages.Ack:
+		working = m.DBHeight
+	case *messages.EOM:
+		working = m.DBHeight
+	case *messages.DirectoryBlockSignature:
+		working = m.DBHeight
+	default:
+		return 0, false
+	}
+	if 0 == working {
+		return 0, false
+	}
+	return working - 1, true
+}
+
+// observe notes what a message from the network tells us about the peer that sent it, and clears the
+// request it answers.
+func (r *requestRouter) observe(msg interfaces.IMsg) {
+	origin := msg.GetNetworkOrigin()
+	r.Lock()
+	defer r.Unlock()
+	if height, ok := shownHeight(msg); ok && 0 < len(origin) && height > r.heights[origin] {
+		r.heights[origin] = height
+	}
+	if key, ok := responseKey(msg); ok {
+		if request, present := r.pending[key]; present {
+			delete(r.pending, key)
+			if origin == request.peer {
+				delete(r.slow, origin)
+			}
+		}
+	}
+}
+
+// route picks the peer a request goes to, and remembers the request so it can be retried.  It returns ""
+// if the request should be broadcast.
+func (r *requestRouter) route(key string, height uint32, message factomMessage) string {
+	r.Lock()
+	defer r.Unlock()
+	request, present := r.pending[key]
+	if !present {
+		request = &pendingRequest{height: height, asked: make(map[string]bool)}
+	}
+	request.message = message
+	request.peer = r.choose(request)
+	if "" == request.peer {
+		delete(r.pending, key)
+		return ""
+	}
+	request.asked[request.peer] = true
+	request.sent = time.Now()
+	r.pending[key] = request
+	return request.peer
+}
+
+// choose picks a peer at random from those that should have what the request is for, haven't been asked
+// for it already, and aren't slow.  Call with the lock held.
+func (r *requestRouter) choose(request *pendingRequest) string {
+	if nil == r.peerHeights {
+		return ""
+	}
+	candidates := []string{}
+	for peer, height := range r.peerHeights() {
+		if r.heights[peer] > height {
+			height = r.heights[peer]
+		}
+		if height < request.height || request.asked[peer] {
+			continue
+		}
+		if when, slow := r.slow[peer]; slow && time.Since(when) < SlowPeerTimeout {
+			continue
+		}
+		candidates = append(candidates, peer)
+	}
+	if 0 == len(candidates) {
+		return ""
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// expired marks the peers sitting on timed out requests as slow, and returns the requests that should be
+// sent to another peer, addressed to that peer.
+func (r *requestRouter) expired() []factomMessage {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	resend := []factomMessage{}
+	for key, request := range r.pending {
+		if now.Sub(request.sent) < RequestTimeout {
+			continue
+		}
+		r.slow[request.peer] = now
+		request.tries++
+		if MaxRequestTries <= request.tries {
+			delete(r.pending, key)
+			continue
+		}
+		request.peer = r.choose(request)
+		if "" == request.peer { // Nobody else to ask; the state will ask again.
+			delete(r.pending, key)
+			continue
+		}
+		request.asked[request.peer] = true
+		request.sent = now
+		message := request.message
+		message.peerHash = request.peer
+		resend = append(resend, message)
+	}
+	for peer, when := range r.slow {
+		if SlowPeerTimeout < now.Sub(when) {
+			delete(r.slow, peer)
+		}
+	}
+	if nil != r.peerHeights {
+		connected := r.peerHeights()
+		for peer := range r.heights {
+			if _, present := connected[peer]; !present {
+				delete(r.heights, peer)
+			}
+		}
+	}
+	return resend
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+func TestRequestRouting(t *testing.T) {
+	peers := map[string]uint32{"behind": 5, "ahead": 20}
+	r := newRequestRouter(func() map[string]uint32 { return peers })
+
+	request := new(messages.DBStateMissing)
+	request.DBHeightStart = 10
+	request.DBHeightEnd = 12
+	key, height, ok := requestKey(request)
+	if !ok || 10 != height {
+		t.Fatalf("requestKey() = %s %d %v", key, height, ok)
+	}
+	if peer := r.route(key, height, factomMessage{}); "ahead" != peer {
+		t.Errorf("Routed to %q, expected the peer that has the height", peer)
+	}
+
+	// A peer shows it has caught up through the messages it sends.
+	ack := new(messages.Ack)
+	ack.DBHeight = 15
+	ack.SetNetworkOrigin("behind")
+	r.observe(ack)
+	if 14 != r.heights["behind"] {
+		t.Errorf("Height from an ack %d, expected 14", r.heights["behind"])
+	}
+
+	// The request times out, so it goes to the other peer, and the first is slow.
+	r.pending[key].sent = time.Now().Add(-RequestTimeout)
+	resend := r.expired()
+	if 1 != len(resend) || "behind" != resend[0].peerHash {
+		t.Errorf("Expected a resend to the other peer, got %+v", resend)
+	}
+	if _, slow := r.slow["ahead"]; !slow {
+		t.Errorf("Peer that timed out not marked slow")
+	}
+
+	// Nobody left to ask.
+	r.pending[key].sent = time.Now().Add(-RequestTimeout)
+	if resend = r.expired(); 0 != len(resend) {
+		t.Errorf("Resent %+v with nobody left to ask", resend)
+	}
+	if _, present := r.pending[key]; present {
+		t.Errorf("Request still pending with nobody left to ask")
+	}
+
+	// Slow peers are passed over, so a new request is broadcast.
+	if peer := r.route(key, height, factomMessage{}); "" != peer {
+		t.Errorf("Routed to slow peer %q", peer)
+	}
+}
+
+func TestRequestAnswered(t *testing.T) {
+	r := newRequestRouter(func() map[string]uint32 { return map[string]uint32{"peer": 0} })
+
+	hash := primitives.Sha([]byte("entry"))
+	request := new(messages.MissingData)
+	request.RequestHash = hash
+	key, height, _ := requestKey(request)
+	if peer := r.route(key, height, factomMessage{}); "peer" != peer {
+		t.Fatalf("Routed to %q", peer)
+	}
+
+	response := new(messages.DataResponse)
+	response.DataHash = hash
+	response.SetNetworkOrigin("peer")
+	r.observe(response)
+	if _, present := r.pending[key]; present {
+		t.Errorf("Answered request still pending")
+	}
+}
+
+func TestRequestRoutingWithoutNetwork(t *testing.T) {
+	r := newRequestRouter(nil)
+	if peer := r.route("dbstate 1", 1, factomMessage{}); "" != peer {
+		t.Errorf("Routed to %q without a network", peer)
+	}
+	r.expired()
+}
@@ -0,0 +1,445 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// Scenarios.  A scenario is a script for the simulator, run with -scenario, so a consensus test can be
+// repeated without anyone typing at the console.  Each line is a step, and the steps run in order.  A #
+// starts a comment.
+//
+//	timeout 5m            How long any wait after this may take, in real time (10m to begin with)
+//	wait 30s              Wait a while (on the virtual clock, with -simclock)
+//	wait height 10        Wait until every node on the network has saved block 10
+//	wait agree 10         Wait until every node on the network has saved the same block 10
+//	identities 10         Make 10 identities for the nodes to take (SimControl's g10)
+//	leader 4              Make node 4 a leader, with the next identity if it has none (lt on node 4)
+//	audit 4               Make node 4 an audit server, with the next identity (on on node 4)
+//	remove 4              Remove node 4 as a server (z on node 4)
+//	offline 3             Take node 3 off the network
+//	online 3              Bring node 3 back onto the network
+//	sim 2 <command>       Run any SimControl command on node 2
+//	faults 0 * <k=v>...   Set faults on the links from node 0 to every node (see netFaults.go)
+//	partition 0,1/2,3 30s Cut nodes 0 and 1 off from 2 and 3 for 30s, or until healed if no time is given
+//	heal                  End every partition
+//	assert height 10      Every node on the network has saved block 10
+//	assert agree 10       Every node on the network has saved the same block 10
+//	assert leaders 3      Every node on the network has 3 leaders
+//	assert audits 1       Every node on the network has 1 audit server
+//	assert leader 4       Every node on the network has node 4 as a leader
+//	assert audit 4        Every node on the network has node 4 as an audit server
+//
+// Any step can be held until the network gets to a height:
+//
+//	at height 5 offline 3 Once a node has saved block 5, take node 3 off the network
+//
+// A failed assertion fails the scenario, but the rest of it still runs so every failure is reported.  Any
+// other step that fails, like a wait that times out, fails the scenario and ends it.  Once the scenario ends
+// the simulator shuts down, and exits with 0 if it passed and 1 if it failed.
+
+var (
+	ScenarioTimeout = 10 * time.Minute       // How long a wait may take, until the scenario sets a timeout
+	scenarioPoll    = 250 * time.Millisecond // How often a wait checks on the nodes
+)
+
+type scenario struct {
+	name    string
+	steps   []scenarioStep
+	timeout time.Duration // How long a wait may take
+}
+
+type scenarioStep struct {
+	line   int    // Where the step is in the scenario
+	text   string // The step, as written
+	assert bool   // The scenario carries on when an assertion fails
+	run    func(sc *scenario) error
+}
+
+// loadScenario reads a scenario from a file.
+func loadScenario(path string) (*scenario, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseScenario(path, file)
+}
+
+// parseScenario reads a scenario, and checks every step in it before any of it runs.
+func parseScenario(name string, r io.Reader) (*scenario, error) {
+	sc := &scenario{name: name, timeout: ScenarioTimeout}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); 0 <= i {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if 0 == len(fields) {
+			continue
+		}
+		step, err := parseScenarioStep(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		step.line = line
+		step.text = strings.Join(fields, " ")
+		sc.steps = append(sc.steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func parseScenarioStep(fields []string) (step scenarioStep, err error) {
+	args := fields[1:]
+	switch fields[0] {
+	case "at":
+		if len(args) < 3 || "height" != args[0] {
+			return step, fmt.Errorf("expected: at height <block> <step>")
+		}
+		height, err := scenarioNumber(args[1])
+		if err != nil {
+			return step, err
+		}
+		then, err := parseScenarioStep(args[2:])
+		if err != nil {
+			return step, err
+		}
+		step.run = func(sc *scenario) error {
+			if err := sc.waitFor(func() error { return reachedHeight(uint32(height)) }); err != nil {
+				return err
+			}
+			return then.run(sc)
+		}
+		step.assert = then.assert
+	case "timeout":
+		if 1 != len(args) {
+			return step, fmt.Errorf("expected: timeout <duration>")
+		}
+		timeout, err := time.ParseDuration(args[0])
+		if err != nil {
+			return step, err
+		}
+		step.run = func(sc *scenario) error {
+			sc.timeout = timeout
+			return nil
+		}
+	case "wait":
+		if 1 == len(args) {
+			wait, err := time.ParseDuration(args[0])
+			if err != nil {
+				return step, err
+			}
+			step.run = func(sc *scenario) error {
+				primitives.GetClock().Sleep(wait)
+				return nil
+			}
+			break
+		}
+		condition, err := scenarioCondition("wait", args)
+		if err != nil {
+			return step, err
+		}
+		step.run = func(sc *scenario) error { return sc.waitFor(condition) }
+	case "assert":
+		condition, err := scenarioCondition("assert", args)
+		if err != nil {
+			return step, err
+		}
+		step.assert = true
+		step.run = func(sc *scenario) error { return condition() }
+	case "identities":
+		if 1 != len(args) {
+			return step, fmt.Errorf("expected: identities <count>")
+		}
+		count, err := scenarioNumber(args[0])
+		if err != nil {
+			return step, err
+		}
+		step.run = func(sc *scenario) error { return simOn(0, fmt.Sprintf("g%d", count)) }
+	case "leader", "audit", "remove", "offline", "online":
+		if 1 != len(args) {
+			return step, fmt.Errorf("expected: %s <node>", fields[0])
+		}
+		node, err := scenarioNumber(args[0])
+		if err != nil {
+			return step, err
+		}
+		action := fields[0]
+		step.run = func(sc *scenario) error {
+			switch action {
+			case "leader":
+				return simOn(node, "lt")
+			case "audit":
+				return simOn(node, "on")
+			case "remove":
+				return simOn(node, "z")
+			}
+			fnode, err := scenarioNode(node)
+			if err != nil {
+				return err
+			}
+			fnode.State.SetNetStateOff("offline" == action)
+			return nil
+		}
+	case "sim":
+		if len(args) < 2 {
+			return step, fmt.Errorf("expected: sim <node> <command>")
+		}
+		node, err := scenarioNumber(args[0])
+		if err != nil {
+			return step, err
+		}
+		command := strings.Join(args[1:], " ")
+		step.run = func(sc *scenario) error { return simOn(node, command) }
+	case "faults":
+		from, to, settings, err := parseFaults(args)
+		if err != nil {
+			return step, err
+		}
+		step.run = func(sc *scenario) error {
+			applyFaults(from, to, settings)
+			return nil
+		}
+	case "partition":
+		groups, d, err := parsePartition(args)
+		if err != nil {
+			return step, err
+		}
+		step.run = func(sc *scenario) error {
+			faults.partition(groups, d)
+			return nil
+		}
+	case "heal":
+		if 0 != len(args) {
+			return step, fmt.Errorf("expected: heal")
+		}
+		step.run = func(sc *scenario) error {
+			faults.heal()
+			return nil
+		}
+	default:
+		return step, fmt.Errorf("unknown step %q", fields[0])
+	}
+	return step, nil
+}
+
+// scenarioCondition parses the condition of a wait or an assert.
+func scenarioCondition(verb string, args []string) (func() error, error) {
+	if 2 != len(args) {
+		return nil, fmt.Errorf("expected: %s <condition> <number>", verb)
+	}
+	n, err := scenarioNumber(args[1])
+	if err != nil {
+		return nil, err
+	}
+	switch args[0] {
+	case "height":
+		return func() error { return savedHeight(uint32(n)) }, nil
+	case "agree":
+		return func() error { return agreeOnHeight(uint32(n)) }, nil
+	}
+	if "assert" == verb {
+		switch args[0] {
+		case "leaders":
+			return func() error { return serverCount(false, n) }, nil
+		case "audits":
+			return func() error { return serverCount(true, n) }, nil
+		case "leader":
+			return func() error { return isServer(false, n) }, nil
+		case "audit":
+			return func() error { return isServer(true, n) }, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown condition %q", args[0])
+}
+
+func scenarioNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a number, found %q", s)
+	}
+	return n, nil
+}
+
+func scenarioNode(node int) (*FactomNode, error) {
+	if node >= len(fnodes) {
+		return nil, fmt.Errorf("there is no node %d, only %d nodes", node, len(fnodes))
+	}
+	return fnodes[node], nil
+}
+
+// run plays the scenario, and returns true if it passed.
+func (sc *scenario) run() bool {
+	failures := 0
+	for _, step := range sc.steps {
+		os.Stderr.WriteString(fmt.Sprintf("Scenario %s:%d: %s\n", sc.name, step.line, step.text))
+		if err := step.run(sc); err != nil {
+			failures++
+			os.Stderr.WriteString(fmt.Sprintf("Scenario %s:%d: FAILED %s: %v\n", sc.name, step.line, step.text, err))
+			if !step.assert {
+				break
+			}
+		}
+	}
+	if 0 < failures {
+		os.Stderr.WriteString(fmt.Sprintf("Scenario %s FAILED, %d failures\n", sc.name, failures))
+		return false
+	}
+	os.Stderr.WriteString(fmt.Sprintf("Scenario %s PASSED\n", sc.name))
+	return true
+}
+
+// runAndExit plays the scenario, then shuts the simulator down with an exit code saying how it went.
+func (sc *scenario) runAndExit() {
+	if !sc.run() {
+		exitCode = 1
+	}
+	Interrupt()
+}
+
+// waitFor checks a condition until it holds, or the timeout runs out.
+func (sc *scenario) waitFor(condition func() error) error {
+	deadline := time.Now().Add(sc.timeout)
+	for {
+		err := condition()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s, %v", sc.timeout, err)
+		}
+		time.Sleep(scenarioPoll)
+	}
+}
+
+// simOn runs a SimControl command on a node, as if it were typed at the console, and waits for it to be done.
+func simOn(node int, command string) error {
+	if _, err := scenarioNode(node); err != nil {
+		return err
+	}
+	simRun(strconv.Itoa(node), command)
+	return nil
+}
+
+// onNetwork returns the nodes that haven't been taken off the network.
+func onNetwork() []*FactomNode {
+	nodes := []*FactomNode{}
+	for _, fnode := range fnodes {
+		if !fnode.State.GetNetStateOff() {
+			nodes = append(nodes, fnode)
+		}
+	}
+	return nodes
+}
+
+// reachedHeight checks that some node has saved the block at a height.
+func reachedHeight(height uint32) error {
+	var highest uint32
+	for _, fnode := range fnodes {
+		if saved := fnode.State.GetHighestRecordedBlock(); saved > highest {
+			highest = saved
+		}
+	}
+	if highest < height {
+		return fmt.Errorf("the highest block saved is %d", highest)
+	}
+	return nil
+}
+
+// savedHeight checks that every node on the network has saved the block at a height.
+func savedHeight(height uint32) error {
+	for _, fnode := range onNetwork() {
+		if saved := fnode.State.GetHighestRecordedBlock(); saved < height {
+			return fmt.Errorf("%s has only saved block %d", fnode.State.FactomNodeName, saved)
+		}
+	}
+	return nil
+}
+
+// agreeOnHeight checks that every node on the network has saved the same block at a height.
+func agreeOnHeight(height uint32) error {
+	if err := savedHeight(height); err != nil {
+		return err
+	}
+	var keyMR interfaces.IHash
+	var first string
+	for _, fnode := range onNetwork() {
+		dblock, err := fnode.State.DB.FetchDBlockByHeight(height)
+		if err != nil || dblock == nil {
+			return fmt.Errorf("%s can't load block %d, %v", fnode.State.FactomNodeName, height, err)
+		}
+		if keyMR == nil {
+			keyMR, first = dblock.GetKeyMR(), fnode.State.FactomNodeName
+		} else if !keyMR.IsSameAs(dblock.GetKeyMR()) {
+			return fmt.Errorf("%s has block %d %x, but %s has %x", first, height, keyMR.Bytes()[:4],
+				fnode.State.FactomNodeName, dblock.GetKeyMR().Bytes()[:4])
+		}
+	}
+	return nil
+}
+
+// servers returns a node's leaders, or audit servers, for the block it is building.
+func servers(fnode *FactomNode, audit bool) []interfaces.IFctServer {
+	pl := fnode.State.LeaderPL
+	if pl == nil {
+		return nil
+	}
+	if audit {
+		return pl.AuditServers
+	}
+	return pl.FedServers
+}
+
+func serverKind(audit bool) string {
+	if audit {
+		return "audit servers"
+	}
+	return "leaders"
+}
+
+// serverCount checks that every node on the network has a number of leaders, or audit servers.
+func serverCount(audit bool, want int) error {
+	for _, fnode := range onNetwork() {
+		if have := len(servers(fnode, audit)); have != want {
+			return fmt.Errorf("%s has %d %s", fnode.State.FactomNodeName, have, serverKind(audit))
+		}
+	}
+	return nil
+}
+
+// isServer checks that every node on the network has a node as a leader, or an audit server.
+func isServer(audit bool, node int) error {
+	server, err := scenarioNode(node)
+	if err != nil {
+		return err
+	}
+	for _, fnode := range onNetwork() {
+		found := false
+		for _, s := range servers(fnode, audit) {
+			if s.GetChainID().IsSameAs(server.State.IdentityChainID) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s doesn't have %s among its %s", fnode.State.FactomNodeName,
+				server.State.FactomNodeName, serverKind(audit))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScenario(t *testing.T) {
+	sc, err := parseScenario("test", strings.NewReader(`
+# Take a node off the network part way, and check the others carry on
+timeout 2m
+identities 4
+leader 1     # comments can follow a step
+at height 5 offline 3
+wait agree 10
+online 3
+sim 2 s
+assert leaders 2
+assert audit 4
+faults 0 * latency=2s jitter=100ms
+partition 0,1/2,3 30s
+heal
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if 12 != len(sc.steps) {
+		t.Fatalf("Parsed %d steps, expected 12", len(sc.steps))
+	}
+	if 6 != sc.steps[3].line || "at height 5 offline 3" != sc.steps[3].text {
+		t.Errorf("Step at line %d is %q", sc.steps[3].line, sc.steps[3].text)
+	}
+	if sc.steps[3].assert || !sc.steps[7].assert {
+		t.Errorf("Only assertions should let the scenario carry on when they fail")
+	}
+	if at, err := parseScenario("test", strings.NewReader("at height 5 assert leaders 2\n")); err != nil || !at.steps[0].assert {
+		t.Errorf("An assertion at a height should let the scenario carry on when it fails")
+	}
+
+	for _, bad := range []string{
+		"jump 3",
+		"wait",
+		"wait soon",
+		"wait leaders 2",
+		"at 5 offline 3",
+		"at height 5 explode",
+		"offline three",
+		"leader -1",
+		"sim 2",
+		"assert height",
+		"timeout 5",
+		"faults 0 * latency",
+		"partition 0,1",
+		"heal now",
+	} {
+		if _, err := parseScenario("test", strings.NewReader("wait 1s\n"+bad)); err == nil {
+			t.Errorf("%q parsed", bad)
+		} else if !strings.HasPrefix(err.Error(), "test:2: ") {
+			t.Errorf("%q: error %q doesn't say where it is", bad, err)
+		}
+	}
+}
+
+func TestScenarioRun(t *testing.T) {
+	defer func(poll time.Duration) { scenarioPoll = poll }(scenarioPoll)
+	scenarioPoll = time.Millisecond
+
+	// With no nodes, every node agrees on everything, but nothing ever gets to a height.
+	sc, err := parseScenario("test", strings.NewReader("timeout 10ms\nassert agree 3\nassert leader 1\nwait height 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.run() {
+		t.Errorf("Passed asserting on a node that doesn't exist")
+	}
+
+	sc, _ = parseScenario("test", strings.NewReader("timeout 10ms\nat height 1 assert height 1\nassert height 1\n"))
+	start := time.Now()
+	if sc.run() {
+		t.Errorf("Passed waiting for a height nothing reached")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("The wait ignored the timeout")
+	}
+
+	sc, _ = parseScenario("test", strings.NewReader("wait 1ms\nwait agree 2\nassert audits 0\n"))
+	if !sc.run() {
+		t.Errorf("Failed with nothing to fail on")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+var _ = fmt.Print
+
+// ShutdownTimeout is how long the orderly shutdown may take before we give up
+// and force the process to exit.
+var ShutdownTimeout = 30 * time.Second
+
+// exitCode is what the process exits with once the shutdown is complete.  A failed scenario sets it.
+var exitCode int
+
+// shutdown takes the nodes down in order, so nothing in flight is lost.  We
+// stop taking submissions from the API, let each ValidatorLoop finish what it
+// is doing (including any save to the database), flush the journals, save our
+// peers and stop the network, then close the databases.
+func shutdown() {
+	fmt.Print("Gracefully shutting down the server...\r\n")
+
+	go func() {
+		time.Sleep(ShutdownTimeout)
+		fmt.Print("Shutdown timed out after ", ShutdownTimeout.String(), ".  Forcing exit.\r\n")
+		os.Exit(1)
+	}()
+
+	fmt.Print("Shutdown: Refusing new API submissions\r\n")
+	for _, fnode := range fnodes {
+		fnode.State.SetShuttingDown()
+	}
+
+	for _, fnode := range fnodes {
+		fmt.Print("Shutdown: Stopping ", fnode.State.FactomNodeName, "\r\n")
+		fnode.State.ShutdownChan <- 0
+	}
+	for _, fnode := range fnodes {
+		<-fnode.State.ShutdownDone
+		fmt.Print("Shutdown: ", fnode.State.FactomNodeName, " stopped\r\n")
+	}
+
+	for _, fnode := range fnodes {
+		if err := fnode.State.FlushJournal(); err != nil {
+			fmt.Print("Shutdown: Error flushing the journal on ", fnode.State.FactomNodeName, ": ", err.Error(), "\r\n")
+		} else {
+			fmt.Print("Shutdown: Journal flushed on ", fnode.State.FactomNodeName, "\r\n")
+		}
+	}
+
+	if p2pNetwork != nil {
+		fmt.Print("Shutdown: Saving peers and stopping the network\r\n")
+		p2pNetwork.NetworkStop()
+	}
+	fmt.Print("Shutdown: Stopping the transports\r\n")
+	stopTransports(fnodes)
+
+	for _, fnode := range fnodes {
+		fmt.Print("Shutdown: Closing the Database on ", fnode.State.FactomNodeName, "\r\n")
+		fnode.State.DB.Close()
+	}
+
+	fmt.Print("Shutdown: Waiting...\r\n")
+	time.Sleep(3 * time.Second)
+	fmt.Print("Shutdown: Complete\r\n")
+	os.Exit(exitCode)
+}
@@ -0,0 +1,375 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// The simulator API.  SimControl's commands over HTTP, on this machine only, for when there is no console to
+// type them at (eg under a process manager).  Requests and responses are JSON.  Every request must carry the
+// AdminPassword from the config file as its HTTP basic authentication password (any user name will do), and
+// without an AdminPassword the API isn't served.
+//
+//	GET  /status                                 The focus node, and the node the WSAPI talks to
+//	GET  /nodes                                  Every node: heights, role, identity, peers, and if it is online
+//	GET  /identities?node=N                      The identities node N knows of
+//	GET  /processlist?node=N                     The process list of the block node N is building
+//	GET  /topology                               The links between the nodes, and what has gone over each
+//	GET  /divergence                             Where the nodes diverged, or null (see -divergence)
+//	POST /focus     {"node":N}                   Focus on node N
+//	POST /server    {"node":N, "role":R}         Make node N a "leader" or "audit" server, or "remove" it
+//	POST /offline   {"node":N, "offline":B}      Take node N off the network, or bring it back
+//	POST /droprate  {"node":N, "rate":R}         Node N drops R messages in 1000 it sends (every node, if no N)
+//	POST /wsapi     {"node":N} or {"rotate":B}   Point the WSAPI at node N, or rotate it around the nodes
+//
+// A failed request gets a 4xx status and {"error": "..."}.
+
+type simNode struct {
+	Node         int    `json:"node"`
+	Name         string `json:"name"`
+	Identity     string `json:"identity"`
+	Role         string `json:"role"` // leader, audit or follower
+	SavedHeight  uint32 `json:"savedheight"`
+	LeaderHeight uint32 `json:"leaderheight"`
+	Offline      bool   `json:"offline"`
+	DropRate     int    `json:"droprate"`
+	Peers        int    `json:"peers"` // Simulated peers, and peers on the p2p network
+}
+
+type simIdentity struct {
+	Status            string         `json:"status"`
+	IdentityChainID   string         `json:"identitychainid"`
+	ManagementChainID string         `json:"managementchainid"`
+	MatryoshkaHash    string         `json:"matryoshkahash"`
+	Keys              []string       `json:"keys"`
+	SigningKey        string         `json:"signingkey"`
+	AnchorKeys        []simAnchorKey `json:"anchorkeys"`
+}
+
+type simAnchorKey struct {
+	BlockChain string `json:"blockchain"`
+	KeyLevel   byte   `json:"keylevel"`
+	KeyType    byte   `json:"keytype"`
+	SigningKey string `json:"signingkey"`
+}
+
+type simProcessList struct {
+	DBHeight     uint32   `json:"dbheight"`
+	FedServers   []string `json:"fedservers"`
+	AuditServers []string `json:"auditservers"`
+	VMs          []simVM  `json:"vms"`
+}
+
+type simVM struct {
+	Index          int  `json:"index"`
+	Length         int  `json:"length"` // Messages in the list
+	Height         int  `json:"height"` // Messages processed
+	LeaderMinute   int  `json:"leaderminute"`
+	MinuteComplete int  `json:"minutecomplete"`
+	Synced         bool `json:"synced"`
+}
+
+// simRequest is the body of a POST.  Fields are pointers so we can tell the ones left out.
+type simRequest struct {
+	Node    *int    `json:"node"`
+	Role    *string `json:"role"`
+	Offline *bool   `json:"offline"`
+	Rate    *int    `json:"rate"`
+	Rotate  *bool   `json:"rotate"`
+}
+
+// simAPIError is an error with the HTTP status to send it with.
+type simAPIError struct {
+	status  int
+	message string
+}
+
+func (e *simAPIError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return &simAPIError{http.StatusBadRequest, fmt.Sprintf(format, a...)}
+}
+
+// ServeSimAPI serves the simulator API on a port of the loopback interface.
+func ServeSimAPI(port int) {
+	if 0 == len(fnodes[0].State.GetAdminPassword()) {
+		fmt.Println("The simulator API needs an AdminPassword in the config file, and will not be served")
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", simAPI("GET", simAPIStatus))
+	mux.HandleFunc("/nodes", simAPI("GET", simAPINodes))
+	mux.HandleFunc("/identities", simAPI("GET", simAPIIdentities))
+	mux.HandleFunc("/processlist", simAPI("GET", simAPIProcessList))
+	mux.HandleFunc("/topology", simAPI("GET", simAPITopology))
+	mux.HandleFunc("/divergence", simAPI("GET", simAPIDivergence))
+	mux.HandleFunc("/focus", simAPI("POST", simAPIFocus))
+	mux.HandleFunc("/server", simAPI("POST", simAPIServer))
+	mux.HandleFunc("/offline", simAPI("POST", simAPIOffline))
+	mux.HandleFunc("/droprate", simAPI("POST", simAPIDropRate))
+	mux.HandleFunc("/wsapi", simAPI("POST", simAPIWSAPI))
+
+	address := "127.0.0.1:" + strconv.Itoa(port)
+	fmt.Println("Starting the simulator API on http://" + address + "/")
+	if err := http.ListenAndServe(address, mux); err != nil {
+		fmt.Println("Simulator API:", err)
+	}
+}
+
+// simAPI wraps a handler with the checks on the method and the password, and writes what it returns as JSON.
+func simAPI(method string, handle func(req *simRequest, r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		result, err := func() (interface{}, error) {
+			password := fnodes[0].State.GetAdminPassword()
+			_, given, ok := r.BasicAuth()
+			if !ok || 0 == len(password) || 1 != subtle.ConstantTimeCompare([]byte(given), []byte(password)) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="factomd simulator"`)
+				return nil, &simAPIError{http.StatusUnauthorized, "unauthorized"}
+			}
+			if method != r.Method {
+				return nil, &simAPIError{http.StatusMethodNotAllowed, "use " + method}
+			}
+			req := new(simRequest)
+			if "POST" == method {
+				if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+					return nil, badRequest("bad request body: %v", err)
+				}
+			}
+			return handle(req, r)
+		}()
+		if err != nil {
+			status := http.StatusBadRequest
+			if apiErr, ok := err.(*simAPIError); ok {
+				status = apiErr.status
+			}
+			w.WriteHeader(status)
+			result = map[string]string{"error": err.Error()}
+		}
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// simAPINode returns the node a request is for, given in its body or its query.
+func simAPINode(req *simRequest, r *http.Request) (int, error) {
+	if nil == req.Node {
+		query := r.URL.Query().Get("node")
+		if 0 == len(query) {
+			return 0, badRequest("no node given")
+		}
+		node, err := strconv.Atoi(query)
+		if err != nil {
+			return 0, badRequest("bad node %q", query)
+		}
+		req.Node = &node
+	}
+	if *req.Node < 0 || *req.Node >= len(fnodes) {
+		return 0, &simAPIError{http.StatusNotFound, fmt.Sprintf("there is no node %d", *req.Node)}
+	}
+	return *req.Node, nil
+}
+
+func simAPIStatus(req *simRequest, r *http.Request) (interface{}, error) {
+	return simRun(), nil
+}
+
+func simAPINodes(req *simRequest, r *http.Request) (interface{}, error) {
+	nodes := []simNode{}
+	for i := range fnodes {
+		nodes = append(nodes, simNodeInfo(i))
+	}
+	return nodes, nil
+}
+
+func simNodeInfo(i int) simNode {
+	s := fnodes[i].State
+	node := simNode{
+		Node:         i,
+		Name:         s.FactomNodeName,
+		Identity:     hashString(s.IdentityChainID),
+		Role:         "follower",
+		SavedHeight:  s.GetHighestRecordedBlock(),
+		LeaderHeight: s.GetLeaderHeight(),
+		Offline:      s.GetNetStateOff(),
+		DropRate:     s.GetDropRate(),
+	}
+	for _, peer := range fnodes[i].Peers {
+		if proxy, ok := peer.(*P2PProxy); ok {
+			if nil != proxy.router.peerHeights {
+				node.Peers += len(proxy.router.peerHeights())
+			}
+		} else {
+			node.Peers++
+		}
+	}
+	for _, role := range []string{"leader", "audit"} {
+		for _, server := range servers(fnodes[i], "audit" == role) {
+			if server.GetChainID().IsSameAs(s.IdentityChainID) {
+				node.Role = role
+			}
+		}
+	}
+	return node
+}
+
+func hashString(h interfaces.IHash) string {
+	if nil == h {
+		return ""
+	}
+	return h.String()
+}
+
+func simAPIIdentities(req *simRequest, r *http.Request) (interface{}, error) {
+	node, err := simAPINode(req, r)
+	if err != nil {
+		return nil, err
+	}
+	identities := []simIdentity{}
+	for _, id := range fnodes[node].State.Identities {
+		identity := simIdentity{
+			Status:            returnStatString(id.Status),
+			IdentityChainID:   hashString(id.IdentityChainID),
+			ManagementChainID: hashString(id.ManagementChainID),
+			MatryoshkaHash:    hashString(id.MatryoshkaHash),
+			Keys:              []string{hashString(id.Key1), hashString(id.Key2), hashString(id.Key3), hashString(id.Key4)},
+			SigningKey:        hashString(id.SigningKey),
+			AnchorKeys:        []simAnchorKey{},
+		}
+		for _, a := range id.AnchorKeys {
+			identity.AnchorKeys = append(identity.AnchorKeys, simAnchorKey{a.BlockChain, a.KeyLevel, a.KeyType, hex.EncodeToString(a.SigningKey)})
+		}
+		identities = append(identities, identity)
+	}
+	return identities, nil
+}
+
+func simAPIProcessList(req *simRequest, r *http.Request) (interface{}, error) {
+	node, err := simAPINode(req, r)
+	if err != nil {
+		return nil, err
+	}
+	pl := fnodes[node].State.LeaderPL
+	if nil == pl {
+		return nil, &simAPIError{http.StatusNotFound, "the node has no process list yet"}
+	}
+	list := simProcessList{DBHeight: pl.DBHeight, FedServers: []string{}, AuditServers: []string{}, VMs: []simVM{}}
+	for _, server := range pl.FedServers {
+		list.FedServers = append(list.FedServers, hashString(server.GetChainID()))
+	}
+	for _, server := range pl.AuditServers {
+		list.AuditServers = append(list.AuditServers, hashString(server.GetChainID()))
+	}
+	for i, vm := range pl.VMs {
+		list.VMs = append(list.VMs, simVM{i, len(vm.List), vm.Height, vm.LeaderMinute, vm.MinuteComplete, vm.Synced})
+	}
+	return list, nil
+}
+
+func simAPITopology(req *simRequest, r *http.Request) (interface{}, error) {
+	return simTopology(fnodes), nil
+}
+
+func simAPIDivergence(req *simRequest, r *http.Request) (interface{}, error) {
+	divergence.Lock()
+	defer divergence.Unlock()
+	return divergence.report, nil
+}
+
+func simAPIFocus(req *simRequest, r *http.Request) (interface{}, error) {
+	node, err := simAPINode(req, r)
+	if err != nil {
+		return nil, err
+	}
+	return simRun(strconv.Itoa(node)), nil
+}
+
+func simAPIServer(req *simRequest, r *http.Request) (interface{}, error) {
+	node, err := simAPINode(req, r)
+	if err != nil {
+		return nil, err
+	}
+	if nil == req.Role {
+		return nil, badRequest("no role given")
+	}
+	var command string
+	switch *req.Role {
+	case "leader":
+		command = "lt"
+	case "audit":
+		command = "on"
+	case "remove":
+		command = "z"
+	default:
+		return nil, badRequest("unknown role %q, use leader, audit or remove", *req.Role)
+	}
+	simRun(strconv.Itoa(node), command)
+	// The node's role changes once the network has agreed to it, so this is likely still the old one.
+	return simNodeInfo(node), nil
+}
+
+func simAPIOffline(req *simRequest, r *http.Request) (interface{}, error) {
+	node, err := simAPINode(req, r)
+	if err != nil {
+		return nil, err
+	}
+	if nil == req.Offline {
+		return nil, badRequest("no offline given")
+	}
+	fnodes[node].State.SetNetStateOff(*req.Offline)
+	return simNodeInfo(node), nil
+}
+
+func simAPIDropRate(req *simRequest, r *http.Request) (interface{}, error) {
+	if nil == req.Rate || *req.Rate < 0 || *req.Rate > 1000 {
+		return nil, badRequest("rate must be from 0 to 1000")
+	}
+	nodes := []int{}
+	if nil == req.Node {
+		for i := range fnodes {
+			nodes = append(nodes, i)
+		}
+	} else {
+		node, err := simAPINode(req, r)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	result := []simNode{}
+	for _, node := range nodes {
+		fnodes[node].State.SetDropRate(*req.Rate)
+		result = append(result, simNodeInfo(node))
+	}
+	return result, nil
+}
+
+func simAPIWSAPI(req *simRequest, r *http.Request) (interface{}, error) {
+	if nil != req.Rotate {
+		status := simRun()
+		if *req.Rotate != status.Rotating {
+			status = simRun("r")
+		}
+		return status, nil
+	}
+	node, err := simAPINode(req, r)
+	if err != nil {
+		return nil, err
+	}
+	status := simRun()
+	if status.Rotating {
+		simRun("r")
+	}
+	return simRun(strconv.Itoa(node), "w"), nil
+}
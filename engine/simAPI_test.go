@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/factomd/state"
+)
+
+func testSimAPI(t *testing.T, method, path, body, password string, handle func(*simRequest, *http.Request) (interface{}, error)) (int, map[string]interface{}) {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if 0 < len(password) {
+		r.SetBasicAuth("admin", password)
+	}
+	w := httptest.NewRecorder()
+	simAPI("POST", handle)(w, r)
+	var result interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%s %s: %v in %s", method, path, err, w.Body.String())
+	}
+	if list, ok := result.([]interface{}); ok && 1 == len(list) {
+		result = list[0] // The nodes a request changed
+	}
+	object, _ := result.(map[string]interface{})
+	return w.Code, object
+}
+
+func TestSimAPI(t *testing.T) {
+	defer func(nodes []*FactomNode) { fnodes = nodes }(fnodes)
+	s := new(state.State)
+	s.AdminPassword = "secret"
+	s.FactomNodeName = "FNode0"
+	s.DBStates = new(state.DBStateList)
+	fnodes = []*FactomNode{{State: s}}
+
+	if code, _ := testSimAPI(t, "POST", "/offline", `{"node":0,"offline":true}`, "", simAPIOffline); http.StatusUnauthorized != code {
+		t.Errorf("No password got %d", code)
+	}
+	if code, _ := testSimAPI(t, "POST", "/offline", `{"node":0,"offline":true}`, "guess", simAPIOffline); http.StatusUnauthorized != code {
+		t.Errorf("Wrong password got %d", code)
+	}
+	if code, _ := testSimAPI(t, "GET", "/offline", ``, "secret", simAPIOffline); http.StatusMethodNotAllowed != code {
+		t.Errorf("Wrong method got %d", code)
+	}
+	if code, _ := testSimAPI(t, "POST", "/offline", `{"node":1,"offline":true}`, "secret", simAPIOffline); http.StatusNotFound != code {
+		t.Errorf("Missing node got %d", code)
+	}
+	if code, result := testSimAPI(t, "POST", "/offline", `{"node":0}`, "secret", simAPIOffline); http.StatusBadRequest != code || nil == result["error"] {
+		t.Errorf("Incomplete request got %d %v", code, result)
+	}
+
+	code, result := testSimAPI(t, "POST", "/offline", `{"node":0,"offline":true}`, "secret", simAPIOffline)
+	if http.StatusOK != code || true != result["offline"] || "follower" != result["role"] || !s.GetNetStateOff() {
+		t.Errorf("Taking the node offline got %d %v", code, result)
+	}
+
+	if code, _ := testSimAPI(t, "POST", "/droprate", `{"rate":1001}`, "secret", simAPIDropRate); http.StatusBadRequest != code {
+		t.Errorf("Bad drop rate got %d", code)
+	}
+	if code, _ := testSimAPI(t, "POST", "/droprate", `{"rate":50}`, "secret", simAPIDropRate); http.StatusOK != code || 50 != s.GetDropRate() {
+		t.Errorf("Drop rate got %d, rate %d", code, s.GetDropRate())
+	}
+
+	// Without a password configured, nothing gets in.
+	s.AdminPassword = ""
+	if code, _ := testSimAPI(t, "POST", "/offline", `{"node":0,"offline":false}`, "secret", simAPIOffline); http.StatusUnauthorized != code {
+		t.Errorf("No configured password got %d", code)
+	}
+}
@@ -78,8 +78,30 @@ var (
 )
 
 func fundWallet(st *state.State, amt uint64) error {
-	inSec, _ := primitives.HexToHash("FB3B471B1DCDADFEB856BD0B02D8BF49ACE0EDD372A3D9F2A95B78EC12A324D6")
 	outEC, _ := primitives.HexToHash("3B6A27BCCEB6A42D62A3A8D02A6F0D73653215771DE243A63AC048A18B59DA29")
+	trans, err := SimFactoidTransaction(outEC.Bytes(), amt, true, st.GetFactoshisPerEC())
+	if err != nil {
+		return err
+	}
+
+	t := new(wsapi.TransactionRequest)
+	data, _ := trans.MarshalBinary()
+	t.Transaction = hex.EncodeToString(data)
+	j := primitives.NewJSON2Request("factoid-submit", 0, t)
+	_, err = V2Request(j, st.GetPort())
+	//_, err = wsapi.HandleV2Request(st, j)
+	if err != nil {
+		return err
+	}
+	_ = err
+
+	return nil
+}
+
+// SimFactoidTransaction spends amt factoshis, plus the fee, from the simulator's funded factoid address to out;
+// an entry credit address if ec.
+func SimFactoidTransaction(out []byte, amt uint64, ec bool, factoshisPerEC uint64) (*factoid.Transaction, error) {
+	inSec, _ := primitives.HexToHash("FB3B471B1DCDADFEB856BD0B02D8BF49ACE0EDD372A3D9F2A95B78EC12A324D6")
 	inHash, _ := primitives.HexToHash("646F3E8750C550E4582ECA5047546FFEF89C13A175985E320232BACAC81CC428")
 	var sec [64]byte
 	copy(sec[:32], inSec.Bytes())
@@ -89,45 +111,37 @@ func fundWallet(st *state.State, amt uint64) error {
 
 	rcd := factoid.NewRCD_1(pub[:])
 	inAdd := factoid.NewAddress(inHash.Bytes())
-	outAdd := factoid.NewAddress(outEC.Bytes())
+	outAdd := factoid.NewAddress(out)
 
 	trans := new(factoid.Transaction)
 	trans.AddInput(inAdd, amt)
-	trans.AddECOutput(outAdd, amt)
+	if ec {
+		trans.AddECOutput(outAdd, amt)
+	} else {
+		trans.AddOutput(outAdd, amt)
+	}
 
 	trans.AddRCD(rcd)
 	trans.AddAuthorization(rcd)
 	trans.SetTimestamp(primitives.NewTimestampNow())
 
-	fee, err := trans.CalculateFee(st.GetFactoshisPerEC())
+	fee, err := trans.CalculateFee(factoshisPerEC)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	input, err := trans.GetInput(0)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	input.SetAmount(amt + fee)
 
 	dataSig, err := trans.MarshalBinarySig()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	sig := factoid.NewSingleSignatureBlock(inSec.Bytes(), dataSig)
 	trans.SetSignatureBlock(0, sig)
-
-	t := new(wsapi.TransactionRequest)
-	data, _ := trans.MarshalBinary()
-	t.Transaction = hex.EncodeToString(data)
-	j := primitives.NewJSON2Request("factoid-submit", 0, t)
-	_, err = v2Request(j, st.GetPort())
-	//_, err = wsapi.HandleV2Request(st, j)
-	if err != nil {
-		return err
-	}
-	_ = err
-
-	return nil
+	return trans, nil
 }
 
 func setUpAuthorites(st *state.State, buildMain bool) []hardCodedAuthority {
@@ -154,7 +168,7 @@ func buildMainChain(port int) {
 	e.ExtIDs = make([][]byte, 0)
 	c := factom.NewChain(e)
 
-	com, rev := getMessageStringChain(c, ec)
+	com, rev := GetMessageStringChain(c, ec)
 	paramsRev := new(wsapi.EntryRequest)
 	paramsCom := new(wsapi.MessageRequest)
 
@@ -163,23 +177,23 @@ func buildMainChain(port int) {
 	jCommit := primitives.NewJSON2Request("commit-chain", 0, paramsCom)
 	jRev := primitives.NewJSON2Request("reveal-chain", 0, paramsRev)
 
-	_, err := v2Request(jCommit, port)
+	_, err := V2Request(jCommit, port)
 	if err != nil {
 		log.Println("Error in making identities: " + err.Error())
 	}
-	_, err = v2Request(jRev, port)
+	_, err = V2Request(jRev, port)
 	if err != nil {
 		log.Println("Error in making identities: " + err.Error())
 	}
 	/*mC := new(wsapi.MessageRequest)
 	mC.Message = "0001553ba74d8faa6ac2d4961882f42a345c7615f4133dde8e6d6e7c1b6b40ae4ff6ee52c393d024cbe2e7f360baad36a66b4f063f1f1b9f57f25deb35aad8fba8905cf2893eec1be40ce17636636117d9469de0f027cd74754e0e1871d249dfefac958d0f91de0b3b6a27bcceb6a42d62a3a8d02a6f0d73653215771de243a63ac048a18b59da299999aa8cfd722db62c61e53c7dbf9fa4de1a64b9891844f1d53b78a4cea3294fb6b88e5b53e5f132e32e1b1176335ead8ed351787457b9219f7743cc51b42803"
 	j := primitives.NewJSON2Request("commit-chain", 0, mC)
-	_, _ = v2Request(j, port)
+	_, _ = V2Request(j, port)
 
 	mR := new(wsapi.EntryRequest)
 	mR.Entry = "00e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b85500004d61696e204964656e74697479204c697374"
 	j = primitives.NewJSON2Request("reveal-chain", 1, mR)
-	_, _ = v2Request(j, port)*/
+	_, _ = V2Request(j, port)*/
 }
 
 func authorityToBlockchain(total int, st *state.State) ([]hardCodedAuthority, int, error) {
@@ -220,7 +234,7 @@ func authorityToBlockchain(total int, st *state.State) ([]hardCodedAuthority, in
 		/*m := new(wsapi.MessageRequest)
 		m.Message = mes
 		j := primitives.NewJSON2Request("commit-chain", i, m)
-		_, err := v2Request(j, st.GetPort())
+		_, err := V2Request(j, st.GetPort())
 		if err != nil {
 			log.Println("Error in making identities: " + err.Error())
 		}
@@ -235,19 +249,19 @@ func authorityToBlockchain(total int, st *state.State) ([]hardCodedAuthority, in
 			paramsCom := new(wsapi.MessageRequest)
 
 			chain := factom.NewChain(entry)
-			com, rev := getMessageStringChain(chain, ec)
+			com, rev := GetMessageStringChain(chain, ec)
 			paramsCom.Message = com
 			paramsRev.Entry = rev
 			jCommit := primitives.NewJSON2Request("commit-chain", i, paramsCom)
 			jRev := primitives.NewJSON2Request("reveal-chain", i, paramsRev)
 
-			_, err = v2Request(jCommit, st.GetPort())
+			_, err = V2Request(jCommit, st.GetPort())
 			//_, err = wsapi.HandleV2Request(st, jCommit)
 
 			if err != nil {
 				log.Println("Error in making identities: " + err.Error())
 			}
-			_, err = v2Request(jRev, st.GetPort())
+			_, err = V2Request(jRev, st.GetPort())
 			//_, err = wsapi.HandleV2Request(st, jRev)
 			if err != nil {
 				log.Println("Error in making identities: " + err.Error())
@@ -257,7 +271,7 @@ func authorityToBlockchain(total int, st *state.State) ([]hardCodedAuthority, in
 			/*m := new(wsapi.EntryRequest)
 			m.Entry = mes
 			j := primitives.NewJSON2Request("reveal-chain", i, m)
-			_, err := v2Request(j, st.GetPort())
+			_, err := V2Request(j, st.GetPort())
 			if err != nil {
 				log.Println("Error in making identities: " + err.Error())
 			}
@@ -269,7 +283,7 @@ func authorityToBlockchain(total int, st *state.State) ([]hardCodedAuthority, in
 		/*m := new(wsapi.EntryRequest)
 		m.Entry = mes
 		j := primitives.NewJSON2Request("commit-entry", i, m)
-		_, err := v2Request(j, st.GetPort())
+		_, err := V2Request(j, st.GetPort())
 		if err != nil {
 			log.Println("Error in making identities: " + err.Error())
 		}*/
@@ -282,18 +296,18 @@ func authorityToBlockchain(total int, st *state.State) ([]hardCodedAuthority, in
 			paramsRev := new(wsapi.EntryRequest)
 			paramsCom := new(wsapi.EntryRequest)
 
-			com, rev := getMessageStringEntry(entry, ec)
+			com, rev := GetMessageStringEntry(entry, ec)
 			paramsCom.Entry = com
 			paramsRev.Entry = rev
 			jCommit := primitives.NewJSON2Request("commit-entry", i, paramsCom)
 			jRev := primitives.NewJSON2Request("reveal-entry", i, paramsRev)
 
-			_, err = v2Request(jCommit, st.GetPort())
+			_, err = V2Request(jCommit, st.GetPort())
 			//_, err = wsapi.HandleV2Request(st, jCommit)
 			if err != nil {
 				log.Println("Error in making identities: " + err.Error())
 			}
-			_, err = v2Request(jRev, st.GetPort())
+			_, err = V2Request(jRev, st.GetPort())
 			//_, err = wsapi.HandleV2Request(st, jRev)
 			if err != nil {
 				log.Println("Error in making identities: " + err.Error())
@@ -303,7 +317,7 @@ func authorityToBlockchain(total int, st *state.State) ([]hardCodedAuthority, in
 			/*m := new(wsapi.EntryRequest)
 			m.Entry = mes
 			j := primitives.NewJSON2Request("reveal-entry", i, m)
-			_, err := v2Request(j, st.GetPort())
+			_, err := V2Request(j, st.GetPort())
 			if err != nil {
 				log.Println("Error in making identities: " + err.Error())
 			}*/
@@ -314,39 +328,39 @@ func authorityToBlockchain(total int, st *state.State) ([]hardCodedAuthority, in
 		m := new(wsapi.EntryRequest)
 		m.Entry = com
 		j := primitives.NewJSON2Request("commit-entry", 0, m)
-		_, _ = v2Request(j, st.GetPort())
+		_, _ = V2Request(j, st.GetPort())
 		//_, _ = wsapi.HandleV2Request(st, j)
 
 		m = new(wsapi.EntryRequest)
 		m.Entry = rev
 		j = primitives.NewJSON2Request("reveal-entry", 0, m)
-		_, _ = v2Request(j, st.GetPort())
+		_, _ = V2Request(j, st.GetPort())
 		//_, _ = wsapi.HandleV2Request(st, j)
 
 		com, rev, _ = makeMHash(ele, ec)
 		m = new(wsapi.EntryRequest)
 		m.Entry = com
 		j = primitives.NewJSON2Request("commit-entry", 0, m)
-		_, _ = v2Request(j, st.GetPort())
+		_, _ = V2Request(j, st.GetPort())
 		//_, _ = wsapi.HandleV2Request(st, j)
 
 		m = new(wsapi.EntryRequest)
 		m.Entry = rev
 		j = primitives.NewJSON2Request("reveal-entry", 0, m)
-		_, _ = v2Request(j, st.GetPort())
+		_, _ = V2Request(j, st.GetPort())
 		//_, _ = wsapi.HandleV2Request(st, j)
 
 		com, rev, _ = makeBTCKey(ele, ec)
 		m = new(wsapi.EntryRequest)
 		m.Entry = com
 		j = primitives.NewJSON2Request("commit-entry", 0, m)
-		_, _ = v2Request(j, st.GetPort())
+		_, _ = V2Request(j, st.GetPort())
 		//_, _ = wsapi.HandleV2Request(st, j)
 
 		m = new(wsapi.EntryRequest)
 		m.Entry = rev
 		j = primitives.NewJSON2Request("reveal-entry", 0, m)
-		_, _ = v2Request(j, st.GetPort())
+		_, _ = V2Request(j, st.GetPort())
 		//_, _ = wsapi.HandleV2Request(st, j)
 
 		madeAuths = append(madeAuths, ele)
@@ -362,7 +376,7 @@ func makeBlockKey(ele hardCodedAuthority, ec *factom.ECAddress, random bool) (st
 	}
 	entry := blockKey.GetEntry()
 	entry.Content = []byte(primitives.NewTimestampNow().String())
-	str1, str2 := getMessageStringEntry(entry, ec)
+	str1, str2 := GetMessageStringEntry(entry, ec)
 	return str1, str2, hex.EncodeToString(key), entry
 }
 
@@ -373,7 +387,7 @@ func makeMHash(ele hardCodedAuthority, ec *factom.ECAddress) (string, string, *f
 	}
 	entry := mHash.GetEntry()
 	entry.ChainID = ele.ManageChain.String()
-	str1, str2 := getMessageStringEntry(entry, ec)
+	str1, str2 := GetMessageStringEntry(entry, ec)
 	return str1, str2, entry
 }
 
@@ -384,11 +398,13 @@ func makeBTCKey(ele hardCodedAuthority, ec *factom.ECAddress) (string, string, *
 	}
 	entry := btcKey.GetEntry()
 	entry.ChainID = ele.ManageChain.String()
-	str1, str2 := getMessageStringEntry(entry, ec)
+	str1, str2 := GetMessageStringEntry(entry, ec)
 	return str1, str2, entry
 }
 
-func getMessageStringEntry(e *factom.Entry, ec *factom.ECAddress) (string, string) {
+// GetMessageStringEntry returns the commit and reveal messages of an entry paid for by ec, as hex, or empty
+// strings if they can't be composed.
+func GetMessageStringEntry(e *factom.Entry, ec *factom.ECAddress) (string, string) {
 	j, err := factom.ComposeEntryCommit(e, ec)
 	if err != nil {
 		return "", ""
@@ -411,7 +427,9 @@ func getMessageStringEntry(e *factom.Entry, ec *factom.ECAddress) (string, strin
 	return tC.Params.Message, tR.Params.Message
 }
 
-func getMessageStringChain(c *factom.Chain, ec *factom.ECAddress) (string, string) {
+// GetMessageStringChain returns the commit and reveal messages of a new chain paid for by ec, as hex, or
+// empty strings if they can't be composed.
+func GetMessageStringChain(c *factom.Chain, ec *factom.ECAddress) (string, string) {
 	j, err := factom.ComposeChainCommit(c, ec)
 	if err != nil {
 		return "", ""
@@ -447,7 +465,7 @@ func changeSigningKey(auth interfaces.IHash, st *state.State) (*primitives.Priva
 			m := new(wsapi.EntryRequest)
 			m.Entry = com
 			j := primitives.NewJSON2Request("commit-entry", 0, m)
-			_, err := v2Request(j, st.GetPort())
+			_, err := V2Request(j, st.GetPort())
 			//wsapi.HandleV2Request(st, j)
 			if err != nil {
 				return nil, err
@@ -456,7 +474,7 @@ func changeSigningKey(auth interfaces.IHash, st *state.State) (*primitives.Priva
 			m.Entry = rev
 			j = primitives.NewJSON2Request("reveal-entry", 0, m)
 			//wsapi.HandleV2Request(st, j)
-			_, err = v2Request(j, st.GetPort())
+			_, err = V2Request(j, st.GetPort())
 			if err != nil {
 				return nil, err
 			}
@@ -606,7 +624,8 @@ func getFactomPackageEntryFromString(message string) (*factom.Entry, error) {
 	}
 }
 
-func v2Request(req *primitives.JSON2Request, port int) (*primitives.JSON2Response, error) {
+// V2Request makes a request of the V2 API of the factomd on this machine at port, and returns its response.
+func V2Request(req *primitives.JSON2Request, port int) (*primitives.JSON2Response, error) {
 	j, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
@@ -630,21 +649,11 @@ func v2Request(req *primitives.JSON2Request, port int) (*primitives.JSON2Respons
 	if err := json.Unmarshal(body, r); err != nil {
 		return nil, err
 	}
-	return nil, nil
+	return r, nil
 }
 
 func modifyLoadIdentities() {
-	chainIDList := strings.Split(chainIDs, "#")
-	list := make([]interfaces.IHash, 0)
-	for i := 0; i < len(chainIDList); i = i + 2 {
-		next, err := primitives.HexToHash(chainIDList[i+1])
-		if err != nil {
-			continue
-		}
-		list = append(list, next)
-		//list = append([]interfaces.IHash{next}, list...)
-	}
-
+	list := SimIdentityChainIDs()
 	if len(list) == 0 {
 		fmt.Println("Error when loading up identities for fnodes")
 	}
@@ -661,15 +670,7 @@ func modifyLoadIdentities() {
 			}
 			fnodes[i].State.IdentityChainID = list[index]
 
-			buf := new(bytes.Buffer)
-			buf.WriteString(list[index].String())
-			pub, priv, err := ed.GenerateKey(buf)
-			if err != nil {
-				continue
-			}
-			_ = pub
-
-			privkey := primitives.NewPrivateKeyFromHexBytes(priv[:])
+			privkey, err := SimIdentityKey(list[index])
 			if err != nil {
 				continue
 			}
@@ -679,6 +680,33 @@ func modifyLoadIdentities() {
 	}
 }
 
+// SimIdentityChainIDs returns the hard coded identities the simulator gives its nodes, after the first.  A
+// local cluster gives them to its nodes the same way.
+func SimIdentityChainIDs() []interfaces.IHash {
+	chainIDList := strings.Split(chainIDs, "#")
+	list := make([]interfaces.IHash, 0)
+	for i := 0; i+1 < len(chainIDList); i = i + 2 {
+		next, err := primitives.HexToHash(chainIDList[i+1])
+		if err != nil {
+			continue
+		}
+		list = append(list, next)
+		//list = append([]interfaces.IHash{next}, list...)
+	}
+	return list
+}
+
+// SimIdentityKey returns the server key of one of the simulator's identities, made from its chain ID.
+func SimIdentityKey(chainID interfaces.IHash) (*primitives.PrivateKey, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(chainID.String())
+	_, priv, err := ed.GenerateKey(buf)
+	if err != nil {
+		return nil, err
+	}
+	return primitives.NewPrivateKeyFromHexBytes(priv[:]), nil
+}
+
 func shad(data []byte) []byte {
 	h1 := sha256.Sum256(data)
 	h2 := sha256.Sum256(h1[:])
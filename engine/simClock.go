@@ -0,0 +1,57 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"time"
+
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// Virtual time.  With -simclock the nodes keep time with a primitives.SimClock instead of the wall clock.
+// Whenever every node has done all it can with the messages it has, the clock jumps to when the next thing
+// waiting on it (usually a node's Timer, for the next minute) is due.  A simulated block takes as long as the
+// nodes need to build it, not the block time, and a run with the same -seed sees the same times.
+
+var (
+	SimClockStart = time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC) // Where the virtual clock starts
+	SimClockQuiet = 10 * time.Millisecond                                  // How long the nodes must be idle before the clock moves on
+)
+
+// runSimClock moves the virtual clock on each time the nodes go quiet.
+func runSimClock(clock *primitives.SimClock) {
+	quietSince := time.Now()
+	for {
+		time.Sleep(time.Millisecond)
+		if !nodesIdle() {
+			quietSince = time.Now()
+			continue
+		}
+		if time.Since(quietSince) < SimClockQuiet {
+			continue
+		}
+		clock.Advance()
+		quietSince = time.Now()
+	}
+}
+
+// nodesIdle returns true if no node has messages waiting to be handled, by itself or by its peers.
+func nodesIdle() bool {
+	for _, fnode := range fnodes {
+		s := fnode.State
+		waiting := len(s.TickerQueue()) + len(s.TimerMsgQueue()) + len(s.InMsgQueue()) + len(s.APIQueue()) +
+			len(s.AckQueue()) + len(s.MsgQueue()) + len(s.NetworkOutMsgQueue()) + len(s.NetworkInvalidMsgQueue()) +
+			s.DBStateValidator.Pending()
+		if 0 < waiting {
+			return false
+		}
+		for _, peer := range fnode.Peers {
+			if 0 < peer.Len() {
+				return false
+			}
+		}
+	}
+	return true
+}
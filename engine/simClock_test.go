@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/state"
+)
+
+// The simulation run by TestSimClockSameSeed, each time in a process of its own, as the nodes can't be stopped.
+const (
+	simClockTestNodes  = 3
+	simClockTestBlocks = 100
+)
+
+// runSimClockTest runs a simulation of simClockTestNodes nodes on the virtual clock, the first the leader, to
+// simClockTestBlocks blocks, and prints the KeyMR of each node's directory blocks.
+func runSimClockTest(seed int64) {
+	rand.Seed(seed)
+	clock := primitives.NewSimClock(SimClockStart)
+	primitives.SetClock(clock)
+
+	s := new(state.State)
+	s.LoadConfig("", "")
+	s.DBType = "Map"
+	s.CloneDBType = "Map"
+	s.DirectoryBlockInSeconds = 60
+	s.SetIdentityChainID(primitives.Sha([]byte("FNode0")))
+	s.NodeMode = "SERVER"
+	s.StartDelayLimit = 10 * 1000
+	s.SetOut(false)
+	s.Init()
+	mLog.init(false, simClockTestNodes)
+	setupBlankAuthority(s)
+	for i := 0; i < simClockTestNodes; i++ {
+		makeServer(s)
+	}
+	for i := 1; i < simClockTestNodes; i++ {
+		AddSimPeer(fnodes, i-1, i)
+	}
+	startServers(true)
+	go runSimClock(clock)
+
+	for {
+		done := true
+		for _, fnode := range fnodes {
+			if fnode.State.GetHighestRecordedBlock() < simClockTestBlocks {
+				done = false
+			}
+		}
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i, fnode := range fnodes {
+		for h := uint32(0); h <= simClockTestBlocks; h++ {
+			dblock, err := fnode.State.DB.FetchDBlockByHeight(h)
+			if err != nil || dblock == nil {
+				fmt.Printf("dblock %d %d missing %v\n", i, h, err)
+				continue
+			}
+			fmt.Printf("dblock %d %d %s\n", i, h, dblock.GetKeyMR().String())
+		}
+	}
+	os.Exit(0)
+}
+
+// simClockTestRun runs the simulation in a new process, and returns the KeyMRs of each node's directory
+// blocks, by node and height.
+func simClockTestRun(t *testing.T, seed int64) [][]string {
+	dir, err := ioutil.TempDir("", "simclock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The databases and journals go in the scratch directory.  Under -race, the races the nodes are known to
+	// have mustn't fail the run; this test is about what they build.
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSimClockSameSeed$")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "FACTOMD_SIMCLOCK_TEST_SEED="+strconv.FormatInt(seed, 10), "GORACE=exitcode=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("The simulation failed: %v\n%s\n%s", err, out, stderr.String())
+	}
+	keymrs := make([][]string, simClockTestNodes)
+	for i := range keymrs {
+		keymrs[i] = make([]string, simClockTestBlocks+1)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		var node, height int
+		var keymr string
+		if n, _ := fmt.Sscanf(scanner.Text(), "dblock %d %d %s", &node, &height, &keymr); 3 == n {
+			keymrs[node][height] = keymr
+		}
+	}
+	return keymrs
+}
+
+func TestSimClockSameSeed(t *testing.T) {
+	if seed := os.Getenv("FACTOMD_SIMCLOCK_TEST_SEED"); "" != seed {
+		n, _ := strconv.ParseInt(seed, 10, 64)
+		runSimClockTest(n)
+		return
+	}
+	if testing.Short() {
+		t.Skip("Runs two simulations of 100 blocks")
+	}
+
+	start := time.Now()
+	first := simClockTestRun(t, 42)
+	t.Logf("%d blocks of %d nodes in %s", simClockTestBlocks, simClockTestNodes, time.Since(start))
+	second := simClockTestRun(t, 42)
+
+	for h := 0; h <= simClockTestBlocks; h++ {
+		for i := 0; i < simClockTestNodes; i++ {
+			if "" == first[i][h] || strings.HasPrefix(first[i][h], "missing") {
+				t.Fatalf("Node %d has no block %d", i, h)
+			}
+			if first[0][h] != first[i][h] {
+				t.Errorf("Nodes 0 and %d differ at block %d: %s %s", i, h, first[0][h], first[i][h])
+			}
+			if first[i][h] != second[i][h] {
+				t.Errorf("Node %d built block %d as %s, then as %s", i, h, first[i][h], second[i][h])
+			}
+		}
+	}
+}
@@ -21,6 +21,53 @@ import (
 
 var _ = fmt.Print
 
+// simCommand is a command for SimControl, as typed at the console.  done, if set, is closed once the
+// command has been carried out, and status, if set, is filled in first.
+type simCommand struct {
+	line   string
+	done   chan bool
+	status *simStatus
+}
+
+// simStatus is where SimControl stands after a command.
+type simStatus struct {
+	Focus     int  `json:"focus"`     // The node commands apply to
+	WSAPINode int  `json:"wsapinode"` // The node the WSAPI talks to, unless it rotates
+	Rotating  bool `json:"rotating"`  // The WSAPI rotates around the nodes
+}
+
+// simRun runs commands through SimControl, one after another, and returns where it stands after the last.
+// Without any commands, it just returns where SimControl stands.
+func simRun(lines ...string) simStatus {
+	if 0 == len(lines) {
+		lines = []string{""}
+	}
+	var status simStatus
+	for _, line := range lines {
+		command := simCommand{line: line, done: make(chan bool), status: &status}
+		simCommands <- command
+		<-command.done
+	}
+	return status
+}
+
+// simCommands carries the commands typed at the console, and those run by a scenario, to SimControl.
+var simCommands = make(chan simCommand)
+
+// readSimCommands passes the commands typed at the console to SimControl.
+func readSimCommands() {
+	for {
+		l := make([]byte, 100)
+		// When running as a detatched process, this routine becomes a very tight loop and starves other goroutines.
+		// So, we will sleep before letting it check to see if Stdin has been reconnected
+		if _, err := os.Stdin.Read(l); err != nil {
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		simCommands <- simCommand{line: string(l)}
+	}
+}
+
 func SimControl(listenTo int) {
 	var _ = time.Sleep
 	var summary int
@@ -29,24 +76,24 @@ func SimControl(listenTo int) {
 	var rotate int
 	var wsapiNode int
 
+	go readSimCommands()
+
 	for {
-		l := make([]byte, 100)
+		command := <-simCommands
 		var err error
-		// When running as a detatched process, this routine becomes a very tight loop and starves other goroutines.
-		// So, we will sleep before letting it check to see if Stdin has been reconnected
-		if _, err = os.Stdin.Read(l); err != nil {
-			time.Sleep(2 * time.Second)
-			continue
-		}
 
 		// This splits up the command at anycodepoint that is not a letter, number of punctuation, so usually by spaces.
 		parseFunc := func(c rune) bool {
 			return !unicode.IsLetter(c) && !unicode.IsNumber(c) && !unicode.IsPunct(c)
 		}
 		// cmd is not a list of the parameters, much like command line args show up in args[]
-		cmd := strings.FieldsFunc(string(l), parseFunc)
+		cmd := strings.FieldsFunc(command.line, parseFunc)
 		if 0 == len(cmd) {
-			cmd = []string{"h"}
+			if nil == command.done {
+				cmd = []string{"h"}
+			} else {
+				cmd = []string{"-"} // Nothing to do; the sender just wants the status
+			}
 		}
 		b := string(cmd[0])
 		v, err := strconv.Atoi(string(b))
@@ -299,6 +346,87 @@ func SimControl(listenTo int) {
 					f.State.SetNetStateOff(!v)
 				}
 
+			case 'j' == b[0]: // Network faults
+				// Split on spaces alone, as the settings are key=value
+				args := strings.FieldsFunc(command.line, func(c rune) bool { return unicode.IsSpace(c) || 0 == c })[1:]
+				switch b {
+				case "jf":
+					from, to, settings, err := parseFaults(args)
+					if err != nil {
+						os.Stderr.WriteString(fmt.Sprintf("%v\n", err))
+						break
+					}
+					applyFaults(from, to, settings)
+				case "jp":
+					groups, d, err := parsePartition(args)
+					if err != nil {
+						os.Stderr.WriteString(fmt.Sprintf("%v\n", err))
+						break
+					}
+					faults.partition(groups, d)
+				case "jh":
+					faults.heal()
+				}
+				os.Stderr.WriteString(faults.String())
+
+			case 'b' == b[0]: // Journal replay
+				switch b {
+				case "bp":
+					replay.pause()
+				case "bc":
+					replay.cont()
+				case "bs":
+					n := 1
+					if 1 < len(cmd) {
+						if n, err = strconv.Atoi(cmd[1]); err != nil || n < 1 {
+							os.Stderr.WriteString("Step a number of messages, eg bs 10\n")
+							break
+						}
+					}
+					replay.step(n)
+				case "br":
+					if len(cmd) < 2 {
+						os.Stderr.WriteString("Give the speed, eg br 2\n")
+						break
+					}
+					speed, err := strconv.ParseFloat(cmd[1], 64)
+					if err != nil || speed < 0 {
+						os.Stderr.WriteString("The speed is a number, 0 or more\n")
+						break
+					}
+					replay.setSpeed(speed)
+				case "bt", "bh", "bd":
+					if len(cmd) < 2 {
+						os.Stderr.WriteString("Give the message type, hash or height to break at\n")
+						break
+					}
+					kind := map[string]string{"bt": "type", "bh": "hash", "bd": "height"}[b]
+					bp, err := parseJournalBreak(kind + "=" + cmd[1])
+					if err != nil {
+						os.Stderr.WriteString(fmt.Sprintf("%v\n", err))
+						break
+					}
+					replay.addBreak(bp)
+				case "bx":
+					replay.clearBreaks()
+				}
+				os.Stderr.WriteString(replay.String())
+
+			case 'v' == b[0]: // Topology
+				format := map[string]string{"vd": "dot", "vj": "json"}[b]
+				if 0 < len(format) {
+					if len(cmd) < 2 {
+						os.Stderr.WriteString("Give the file to write the topology to\n")
+						break
+					}
+					if err := exportTopology(cmd[1], format); err != nil {
+						os.Stderr.WriteString(fmt.Sprintf("%v\n", err))
+						break
+					}
+					os.Stderr.WriteString("Wrote the topology to " + cmd[1] + "\n")
+				}
+				os.Stderr.WriteString(graphStats(simGraph(fnodes)).String() + "\n")
+
 			case 'y' == b[0]:
 				if listenTo >= 0 && listenTo < len(fnodes) {
 					f := fnodes[listenTo]
@@ -393,6 +521,10 @@ func SimControl(listenTo int) {
 				fnodes[listenTo].State.SetOut(true)
 				os.Stderr.WriteString(fmt.Sprint("\r\nSwitching to Node ", listenTo, "\r\n"))
 			case 'c' == b[0]:
+				if "cv" == b {
+					os.Stderr.WriteString(divergence.String())
+					break
+				}
 				c := !fnodes[0].State.DebugConsensus
 				for _, n := range fnodes {
 					n.State.DebugConsensus = fnodes[0].State.DebugConsensus
@@ -651,6 +783,7 @@ func SimControl(listenTo int) {
 				os.Stderr.WriteString("y             Dump what is in the Holding Map.  Can crash, but oh well.\n")
 				os.Stderr.WriteString("m             Show Messages as they are passed through the simulator.\n")
 				os.Stderr.WriteString("c             Trace the Consensus Process\n")
+				os.Stderr.WriteString("cv            Show how far the nodes have been compared, or where they diverged (see -divergence).\n")
 				os.Stderr.WriteString("s             Show the state of all nodes as their state changes in the simulator.\n")
 				os.Stderr.WriteString("p             Show the process lists and directory block states as they change.\n")
 				os.Stderr.WriteString("n             Change the focus to the next node.\n")
@@ -660,6 +793,19 @@ func SimControl(listenTo int) {
 				os.Stderr.WriteString("za            Attempt to remove focused node as a audit server\n")
 				os.Stderr.WriteString("o             Make focused an audit server.\n")
 				os.Stderr.WriteString("x             Take the given node out of the netork or bring an offline node back in.\n")
+				os.Stderr.WriteString("j             Show the faults on the network between the nodes.\n")
+				os.Stderr.WriteString("jf F T k=v    Set faults on the links from node F to node T (either may be *).  Keys are latency,\n")
+				os.Stderr.WriteString("                 jitter, dist (uniform, normal, exponential), bandwidth, drop, duplicate and reorder.\n")
+				os.Stderr.WriteString("jp 0,1/2,3 D  Partition nodes 0 and 1 from 2 and 3 for duration D (or until healed, if no D).\n")
+				os.Stderr.WriteString("jh            Heal all partitions.\n")
+				os.Stderr.WriteString("b             Show how the journal replay is going.  bp pauses it, bc continues it.\n")
+				os.Stderr.WriteString("bs N          Step the paused journal replay on N messages (1 if no N).\n")
+				os.Stderr.WriteString("br S          Replay the journal at speed S: 0 is as fast as possible, 1 the pace it was made.\n")
+				os.Stderr.WriteString("bt T, bh H    Pause the replay before every message of type T (eg EOM), or with a hash starting H.\n")
+				os.Stderr.WriteString("bd N          Pause the replay once the node is building directory block N.  bx clears breakpoints.\n")
+				os.Stderr.WriteString("v             Show the number of links, degrees and diameter of the network between the nodes.\n")
+				os.Stderr.WriteString("vd FILE       Write the network, and what has gone over each link, to FILE as Graphviz DOT.\n")
+				os.Stderr.WriteString("vj FILE       Write the network, and what has gone over each link, to FILE as JSON.\n")
 				os.Stderr.WriteString("w             Point the WSAPI to send API calls to the current node.\n")
 				os.Stderr.WriteString("iH            To learn about identity control through simulator.\n")
 				os.Stderr.WriteString("gN            Adds 'N' identities to your identity pool. (Cannot add identities already taken)\n")
@@ -676,6 +822,12 @@ func SimControl(listenTo int) {
 			default:
 			}
 		}
+		if nil != command.status {
+			*command.status = simStatus{Focus: listenTo, WSAPINode: wsapiNode, Rotating: 1 == rotate%2}
+		}
+		if nil != command.done {
+			close(command.done)
+		}
 	}
 }
 func returnStatString(i int) string {
@@ -826,6 +978,26 @@ func printSummary(summary *int, value int, listenTo *int) {
 		}
 		prt = prt + fmt.Sprintf(fmtstr, "NetworkInvalidMsgQueue", list)
 
+		prt = prt + "\n"
+
+		list = ""
+		for _, f := range fnodes {
+			list = list + fmt.Sprintf(" %3d", f.State.DBStateValidator.Pending())
+		}
+		prt = prt + fmt.Sprintf(fmtstr, "DBStates Pending", list)
+
+		list = ""
+		for _, f := range fnodes {
+			list = list + fmt.Sprintf(" %3d", f.State.DBStateValidator.Count())
+		}
+		prt = prt + fmt.Sprintf(fmtstr, "DBStates Checked", list)
+
+		list = ""
+		for _, f := range fnodes {
+			list = list + fmt.Sprintf(" %3d", f.State.DBStateValidator.AvgCheck()/time.Microsecond)
+		}
+		prt = prt + fmt.Sprintf(fmtstr, "DBState Check (us)", list)
+
 		prt = prt + "===SummaryEnd===\n"
 
 		if prt != out {
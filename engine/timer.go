@@ -9,30 +9,34 @@ import (
 	"time"
 
 	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
 	s "github.com/FactomProject/factomd/state"
 )
 
 var _ = (*s.State)(nil)
 
+// Timer sends the node a tick each tenth of a block.  It keeps time with the clock, so under the simulator's
+// virtual clock the minutes pass as fast as the nodes can get through them.
 func Timer(state interfaces.IState) {
+	clock := primitives.GetClock()
 
-	time.Sleep(2 * time.Second)
+	clock.Sleep(2 * time.Second)
 
 	billion := int64(1000000000)
 	period := int64(state.GetDirectoryBlockInSeconds()) * billion
 	tenthPeriod := period / 10
 
-	now := time.Now().UnixNano() // Time in billionths of a second
+	now := clock.Now().UnixNano() // Time in billionths of a second
 
 	wait := tenthPeriod - (now % tenthPeriod)
 
 	next := now + wait + tenthPeriod
 
 	if state.GetOut() {
-		state.Print(fmt.Sprintf("Time: %v\r\n", time.Now()))
+		state.Print(fmt.Sprintf("Time: %v\r\n", clock.Now()))
 	}
 
-	time.Sleep(time.Duration(wait))
+	clock.Sleep(time.Duration(wait))
 
 	for {
 
@@ -43,7 +47,7 @@ func Timer(state interfaces.IState) {
 				time.Sleep(time.Millisecond * 10)
 			}
 
-			now = time.Now().UnixNano()
+			now = clock.Now().UnixNano()
 			if now > next {
 				wait = 1
 				for next < now {
@@ -54,13 +58,13 @@ func Timer(state interfaces.IState) {
 				wait = next - now
 				next += tenthPeriod
 			}
-			time.Sleep(time.Duration(wait))
+			clock.Sleep(time.Duration(wait))
 			for len(state.InMsgQueue()) > 5000 {
 				time.Sleep(100 * time.Millisecond)
 			}
 
 			// Delay some number of milliseconds.
-			time.Sleep(time.Duration(state.GetTimeOffset().GetTimeMilli()) * time.Millisecond)
+			clock.Sleep(time.Duration(state.GetTimeOffset().GetTimeMilli()) * time.Millisecond)
 
 			state.TickerQueue() <- i
 
@@ -0,0 +1,395 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Random networks for the simulator, the statistics of a network, and exporting the network as Graphviz DOT
+// or JSON.  The generators return the links to make as pairs of node indices, and take their random numbers
+// from the given source, so the same seed builds the same network.
+
+// topologyRand returns the source of random numbers for building a network.  0 is a different network each run.
+func topologyRand(seed int64) *rand.Rand {
+	if 0 == seed {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// links collects the links of a network, ignoring links to self and links already made.
+type links struct {
+	made  map[[2]int]bool
+	pairs [][2]int
+}
+
+func newLinks() *links {
+	l := new(links)
+	l.made = make(map[[2]int]bool)
+	return l
+}
+
+func (l *links) has(a, b int) bool {
+	if b < a {
+		a, b = b, a
+	}
+	return l.made[[2]int{a, b}]
+}
+
+func (l *links) add(a, b int) bool {
+	if a == b || l.has(a, b) {
+		return false
+	}
+	if b < a {
+		a, b = b, a
+	}
+	l.made[[2]int{a, b}] = true
+	l.pairs = append(l.pairs, [2]int{a, b})
+	return true
+}
+
+func (l *links) remove(a, b int) {
+	if b < a {
+		a, b = b, a
+	}
+	delete(l.made, [2]int{a, b})
+	for i, pair := range l.pairs {
+		if pair == [2]int{a, b} {
+			l.pairs = append(l.pairs[:i], l.pairs[i+1:]...)
+			return
+		}
+	}
+}
+
+// randomNetwork is an Erdős–Rényi network, where every pair of nodes is linked with the same chance, picked so
+// nodes have degree peers on average.
+func randomNetwork(n int, degree float64, r *rand.Rand) [][2]int {
+	l := newLinks()
+	if n < 2 {
+		return nil
+	}
+	p := degree / float64(n-1)
+	for a := 0; a < n; a++ {
+		for b := a + 1; b < n; b++ {
+			if r.Float64() < p {
+				l.add(a, b)
+			}
+		}
+	}
+	joinComponents(n, l, r)
+	return l.pairs
+}
+
+// smallWorldNetwork is a Watts–Strogatz network: a ring where every node is linked to the degree nearest nodes,
+// with each link moved to a random node with the chance rewire.  A few long links make a short path between
+// any two nodes, while neighbours stay tightly knit.
+func smallWorldNetwork(n int, degree int, rewire float64, r *rand.Rand) [][2]int {
+	l := newLinks()
+	half := degree / 2
+	if half < 1 {
+		half = 1
+	}
+	for a := 0; a < n; a++ {
+		for j := 1; j <= half; j++ {
+			l.add(a, (a+j)%n)
+		}
+	}
+	for j := 1; j <= half; j++ {
+		for a := 0; a < n; a++ {
+			b := (a + j) % n
+			if !l.has(a, b) || r.Float64() >= rewire {
+				continue
+			}
+			c := r.Intn(n)
+			if c == a || l.has(a, c) {
+				continue
+			}
+			l.remove(a, b)
+			l.add(a, c)
+		}
+	}
+	joinComponents(n, l, r)
+	return l.pairs
+}
+
+// scaleFreeNetwork is a Barabási–Albert network.  Nodes join one at a time, each linking to degree/2 of the
+// nodes already there, picked with a chance in proportion to how many peers they have.  So a few hubs end up
+// with most of the links.
+func scaleFreeNetwork(n int, degree int, r *rand.Rand) [][2]int {
+	l := newLinks()
+	m := degree / 2
+	if m < 1 {
+		m = 1
+	}
+	// Every end of every link, so picking from it favours the nodes with the most peers.
+	var ends []int
+	for a := 1; a < n; a++ {
+		if a <= m {
+			// Link the first nodes to each other
+			for b := 0; b < a; b++ {
+				l.add(a, b)
+				ends = append(ends, a, b)
+			}
+			continue
+		}
+		for made := 0; made < m; {
+			b := ends[r.Intn(len(ends))]
+			if l.add(a, b) {
+				ends = append(ends, a, b)
+				made++
+			}
+		}
+	}
+	return l.pairs
+}
+
+// joinComponents links the parts of a network that can't reach each other, by a random node in each, so every
+// node can reach every other.
+func joinComponents(n int, l *links, r *rand.Rand) {
+	for {
+		components := graphComponents(graphOf(n, l.pairs))
+		if len(components) < 2 {
+			return
+		}
+		a := components[0][r.Intn(len(components[0]))]
+		b := components[1][r.Intn(len(components[1]))]
+		l.add(a, b)
+	}
+}
+
+// graphOf lists the peers of each of n nodes.
+func graphOf(n int, pairs [][2]int) [][]int {
+	graph := make([][]int, n)
+	for _, pair := range pairs {
+		graph[pair[0]] = append(graph[pair[0]], pair[1])
+		graph[pair[1]] = append(graph[pair[1]], pair[0])
+	}
+	return graph
+}
+
+// simGraph lists the peers of each simulated node.
+func simGraph(fnodes []*FactomNode) [][]int {
+	graph := make([][]int, len(fnodes))
+	for i, fnode := range fnodes {
+		for _, peer := range fnode.Peers {
+			if sp, ok := peer.(*SimPeer); ok {
+				graph[i] = append(graph[i], sp.toNode)
+			}
+		}
+	}
+	return graph
+}
+
+// distances returns how many hops every node is from node a, or -1 where it can't be reached.
+func distances(graph [][]int, a int) []int {
+	dist := make([]int, len(graph))
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[a] = 0
+	queue := []int{a}
+	for 0 < len(queue) {
+		node := queue[0]
+		queue = queue[1:]
+		for _, peer := range graph[node] {
+			if dist[peer] < 0 {
+				dist[peer] = dist[node] + 1
+				queue = append(queue, peer)
+			}
+		}
+	}
+	return dist
+}
+
+// graphComponents returns the groups of nodes that can reach each other.
+func graphComponents(graph [][]int) [][]int {
+	var components [][]int
+	seen := make([]bool, len(graph))
+	for a := range graph {
+		if seen[a] {
+			continue
+		}
+		var component []int
+		for node, d := range distances(graph, a) {
+			if 0 <= d {
+				seen[node] = true
+				component = append(component, node)
+			}
+		}
+		components = append(components, component)
+	}
+	return components
+}
+
+type topologyStats struct {
+	Nodes      int     `json:"nodes"`
+	Links      int     `json:"links"`
+	MinDegree  int     `json:"mindegree"`
+	MeanDegree float64 `json:"meandegree"`
+	MaxDegree  int     `json:"maxdegree"`
+	Diameter   int     `json:"diameter"` // The most hops between two nodes that can reach each other
+	Components int     `json:"components"`
+}
+
+func graphStats(graph [][]int) topologyStats {
+	stats := topologyStats{Nodes: len(graph)}
+	if 0 == len(graph) {
+		return stats
+	}
+	stats.MinDegree = len(graph[0])
+	ends := 0
+	for a, peers := range graph {
+		ends += len(peers)
+		if len(peers) < stats.MinDegree {
+			stats.MinDegree = len(peers)
+		}
+		if len(peers) > stats.MaxDegree {
+			stats.MaxDegree = len(peers)
+		}
+		for _, d := range distances(graph, a) {
+			if d > stats.Diameter {
+				stats.Diameter = d
+			}
+		}
+	}
+	stats.Links = ends / 2
+	stats.MeanDegree = float64(ends) / float64(len(graph))
+	stats.Components = len(graphComponents(graph))
+	return stats
+}
+
+func (s topologyStats) String() string {
+	return fmt.Sprintf("%d nodes, %d links, degree %d/%.2f/%d (min/mean/max), diameter %d, %d component(s)",
+		s.Nodes, s.Links, s.MinDegree, s.MeanDegree, s.MaxDegree, s.Diameter, s.Components)
+}
+
+type topologyNode struct {
+	Node    int    `json:"node"`
+	Name    string `json:"name"`
+	Peers   int    `json:"peers"`
+	Offline bool   `json:"offline"`
+}
+
+// topologyLink is one direction of the link between two simulated nodes, and what has gone over it.
+type topologyLink struct {
+	From        int    `json:"from"`
+	To          int    `json:"to"`
+	Sent        int64  `json:"sent"`
+	Bytes       int64  `json:"bytes"`
+	Dropped     int64  `json:"dropped"`
+	InFlight    int    `json:"inflight"` // Delayed by the network faults
+	Queued      int    `json:"queued"`   // Arrived, and waiting for the node to read them
+	Faults      string `json:"faults,omitempty"`
+	Partitioned bool   `json:"partitioned"`
+}
+
+type topology struct {
+	Stats topologyStats  `json:"stats"`
+	Nodes []topologyNode `json:"nodes"`
+	Links []topologyLink `json:"links"`
+}
+
+// simTopology takes a snapshot of the simulated network.
+func simTopology(fnodes []*FactomNode) topology {
+	graph := simGraph(fnodes)
+	t := topology{Stats: graphStats(graph), Nodes: []topologyNode{}, Links: []topologyLink{}}
+	for i, fnode := range fnodes {
+		t.Nodes = append(t.Nodes, topologyNode{i, fnode.State.FactomNodeName, len(graph[i]), fnode.State.GetNetStateOff()})
+		for _, peer := range fnode.Peers {
+			sp, ok := peer.(*SimPeer)
+			if !ok {
+				continue
+			}
+			sp.flightLock.Lock()
+			inFlight := len(sp.flight)
+			sp.flightLock.Unlock()
+			linkFaults := ""
+			if lf := faults.link(sp.fromNode, sp.toNode); !lf.none() {
+				linkFaults = lf.String()
+			}
+			t.Links = append(t.Links, topologyLink{
+				From:        sp.fromNode,
+				To:          sp.toNode,
+				Sent:        atomic.LoadInt64(&sp.sent),
+				Bytes:       atomic.LoadInt64(&sp.bytes),
+				Dropped:     atomic.LoadInt64(&sp.dropped),
+				InFlight:    inFlight,
+				Queued:      len(sp.BroadcastOut),
+				Faults:      linkFaults,
+				Partitioned: faults.partitioned(sp.fromNode, sp.toNode),
+			})
+		}
+	}
+	return t
+}
+
+// writeJSON writes the topology as JSON.
+func (t topology) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
+
+// writeDOT writes the topology as a Graphviz digraph, with an edge each way between peers labelled with what
+// went over it.  Offline nodes and partitioned links are dashed.
+func (t topology) writeDOT(w io.Writer) error {
+	out := "digraph factomd {\n"
+	out += fmt.Sprintf("  label=%q;\n", t.Stats.String())
+	for _, node := range t.Nodes {
+		style := ""
+		if node.Offline {
+			style = ", style=dashed"
+		}
+		out += fmt.Sprintf("  %d [label=%q%s];\n", node.Node, node.Name, style)
+	}
+	for _, link := range t.Links {
+		label := fmt.Sprintf("%d msgs, %d bytes", link.Sent, link.Bytes)
+		if 0 < link.Dropped {
+			label += fmt.Sprintf(", %d dropped", link.Dropped)
+		}
+		if 0 < link.InFlight+link.Queued {
+			label += fmt.Sprintf(", %d in flight, %d queued", link.InFlight, link.Queued)
+		}
+		if 0 < len(link.Faults) {
+			label += "\\n" + link.Faults
+		}
+		style := ""
+		if link.Partitioned {
+			style = ", style=dashed"
+		}
+		out += fmt.Sprintf("  %d -> %d [label=\"%s\"%s];\n", link.From, link.To, label, style)
+	}
+	out += "}\n"
+	_, err := io.WriteString(w, out)
+	return err
+}
+
+// write writes the topology in the given format, dot or json.
+func (t topology) write(w io.Writer, format string) error {
+	switch format {
+	case "dot":
+		return t.writeDOT(w)
+	case "json":
+		return t.writeJSON(w)
+	}
+	return fmt.Errorf("unknown topology format %q, use dot or json", format)
+}
+
+// exportTopology writes the simulated network to a file, in the given format.
+func exportTopology(file string, format string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return simTopology(fnodes).write(f, format)
+}
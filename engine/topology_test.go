@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/factomd/state"
+)
+
+func TestTopologyGenerators(t *testing.T) {
+	generators := map[string]func(seed int64) [][2]int{
+		"random":     func(seed int64) [][2]int { return randomNetwork(50, 4, topologyRand(seed)) },
+		"smallworld": func(seed int64) [][2]int { return smallWorldNetwork(50, 4, 0.2, topologyRand(seed)) },
+		"scalefree":  func(seed int64) [][2]int { return scaleFreeNetwork(50, 4, topologyRand(seed)) },
+	}
+	for name, generate := range generators {
+		pairs := generate(7)
+		if !reflect.DeepEqual(pairs, generate(7)) {
+			t.Errorf("%s: the same seed built different networks", name)
+		}
+		if reflect.DeepEqual(pairs, generate(8)) {
+			t.Errorf("%s: different seeds built the same network", name)
+		}
+		stats := graphStats(graphOf(50, pairs))
+		if 1 != stats.Components || 0 == stats.MinDegree {
+			t.Errorf("%s: not every node can reach every other: %s", name, stats)
+		}
+		if stats.MeanDegree < 3 || stats.MeanDegree > 5 {
+			t.Errorf("%s: expected about 4 peers a node: %s", name, stats)
+		}
+	}
+
+	// The hubs of a scale free network have far more peers than the average.
+	if stats := graphStats(graphOf(200, scaleFreeNetwork(200, 2, topologyRand(1)))); stats.MaxDegree < 10 {
+		t.Errorf("scalefree: no hubs: %s", stats)
+	}
+}
+
+func TestGraphStats(t *testing.T) {
+	// A ring of 6, and a pair on their own.
+	pairs := [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 4}, {4, 5}, {5, 0}, {6, 7}}
+	stats := graphStats(graphOf(8, pairs))
+	expected := topologyStats{Nodes: 8, Links: 7, MinDegree: 1, MeanDegree: 1.75, MaxDegree: 2, Diameter: 3, Components: 2}
+	if stats != expected {
+		t.Errorf("Got %+v, expected %+v", stats, expected)
+	}
+}
+
+func TestTopologyExport(t *testing.T) {
+	defer func(nodes []*FactomNode) { fnodes = nodes }(fnodes)
+	faults = newNetFaults()
+	fnodes = nil
+	for _, name := range []string{"FNode0", "FNode1", "FNode2"} {
+		s := new(state.State)
+		s.FactomNodeName = name
+		fnodes = append(fnodes, &FactomNode{State: s})
+	}
+	AddSimPeer(fnodes, 0, 1)
+	AddSimPeer(fnodes, 1, 2)
+	peer := fnodes[0].Peers[0].(*SimPeer)
+	peer.sent, peer.bytes = 2, 100
+	faults.partition([][]int{{0}, {1, 2}}, 0)
+
+	top := simTopology(fnodes)
+	if 2 != top.Stats.Links || 2 != top.Stats.Diameter || 4 != len(top.Links) {
+		t.Fatalf("Wrong topology: %+v", top)
+	}
+
+	var out bytes.Buffer
+	if err := top.write(&out, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var read topology
+	if err := json.Unmarshal(out.Bytes(), &read); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(top, read) {
+		t.Errorf("JSON export read back as %+v", read)
+	}
+
+	out.Reset()
+	if err := top.write(&out, "dot"); err != nil {
+		t.Fatal(err)
+	}
+	dot := out.String()
+	for _, want := range []string{"digraph factomd {", `0 [label="FNode0"];`, `0 -> 1 [label="2 msgs, 100 bytes", style=dashed];`, `2 -> 1 [label="0 msgs, 0 bytes"];`} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT export lacks %s:\n%s", want, dot)
+		}
+	}
+
+	if err := top.write(&out, "png"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
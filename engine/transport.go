@@ -0,0 +1,38 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// Transport is a way for a FactomNode to reach other nodes.  There are three:
+//
+//	SimPeer          connects two simulated nodes in this process
+//	P2PProxy         connects a node to the real network through the p2p.Controller
+//	ReplayTransport  plays traffic captured from the network (see -netcapture) back into a node
+//
+// The node itself only sees the IPeer side.  Start and Stop let NetStart and shutdown handle all of them
+// the same way.
+type Transport interface {
+	interfaces.IPeer
+	Start() // Start moving messages
+	Stop()  // Stop moving messages, on shutdown
+}
+
+var _ Transport = (*SimPeer)(nil)
+var _ Transport = (*P2PProxy)(nil)
+var _ Transport = (*ReplayTransport)(nil)
+
+// stopTransports stops the transports of all the nodes.
+func stopTransports(fnodes []*FactomNode) {
+	for _, fnode := range fnodes {
+		for _, peer := range fnode.Peers {
+			if transport, ok := peer.(Transport); ok {
+				transport.Stop()
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ban records an address or subnet we refuse to talk to, why, and until when.
+type Ban struct {
+	Address string    // An IP address, or a subnet in CIDR notation (eg 10.1.0.0/16)
+	Reason  string    // Why the address was banned
+	Source  string    // BanSourceAutomatic or BanSourceOperator
+	Banned  time.Time // When the ban was made
+	Expires time.Time // When the ban lapses
+}
+
+// Where a ban came from
+const (
+	BanSourceAutomatic = "automatic" // The peer's quality score dropped too low
+	BanSourceOperator  = "operator"  // Banned through the API or control panel
+)
+
+func (b *Ban) expired() bool {
+	return time.Now().After(b.Expires)
+}
+
+// matches returns true if the ban covers the IP address.
+func (b *Ban) matches(ip net.IP) bool {
+	if _, subnet, err := net.ParseCIDR(b.Address); nil == err {
+		return subnet.Contains(ip)
+	}
+	banned := net.ParseIP(b.Address)
+	return nil != banned && banned.Equal(ip)
+}
+
+// normalizeBanAddress checks that address is an IP address or CIDR subnet, and returns it in canonical form.
+func normalizeBanAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if _, subnet, err := net.ParseCIDR(address); nil == err {
+		return subnet.String(), nil
+	}
+	if ip := net.ParseIP(address); nil != ip {
+		return ip.String(), nil
+	}
+	return "", fmt.Errorf("%q is not an IP address or a subnet", address)
+}
+
+// banFilePath returns where the bans for a peers file are kept, eg MainPeers.json -> MainPeersBans.json
+func banFilePath(peersFile string) string {
+	ext := filepath.Ext(peersFile)
+	return strings.TrimSuffix(peersFile, ext) + "Bans" + ext
+}
+
+// banList is the set of bans, indexed by address.  The accept loop reads it from its own goroutine, and the
+// API from others, so it has its own lock.
+type banList struct {
+	sync.Mutex
+	bans map[string]Ban
+	path string // file the bans are saved in, "" to not save them
+}
+
+func newBanList(path string) *banList {
+	b := new(banList)
+	b.bans = map[string]Ban{}
+	b.path = path
+	return b
+}
+
+// load reads the bans from disk, dropping any that have expired.
+func (b *banList) load() {
+	if "" == b.path {
+		return
+	}
+	file, err := os.Open(b.path)
+	if nil != err {
+		note("bans", "banList.load() no bans read from %s: %+v", b.path, err)
+		return
+	}
+	defer file.Close()
+	bans := map[string]Ban{}
+	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&bans); nil != err {
+		logerror("bans", "banList.load() could not decode %s: %+v", b.path, err)
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	for address, ban := range bans {
+		if !ban.expired() {
+			b.bans[address] = ban
+		}
+	}
+	note("bans", "banList.load() found %d bans in %s", len(b.bans), b.path)
+}
+
+// save writes the bans to disk.  Call with the lock held.
+func (b *banList) save() {
+	if "" == b.path {
+		return
+	}
+	file, err := os.Create(b.path)
+	if nil != err {
+		logerror("bans", "banList.save() could not write %s: %+v", b.path, err)
+		return
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	json.NewEncoder(writer).Encode(b.bans)
+	writer.Flush()
+}
+
+// add bans address (an IP address or subnet) for duration.  A new ban replaces any old one on the address.
+func (b *banList) add(address string, reason string, source string, duration time.Duration) (Ban, error) {
+	address, err := normalizeBanAddress(address)
+	if nil != err {
+		return Ban{}, err
+	}
+	now := time.Now()
+	ban := Ban{Address: address, Reason: reason, Source: source, Banned: now, Expires: now.Add(duration)}
+	b.Lock()
+	defer b.Unlock()
+	b.bans[address] = ban
+	b.save()
+	significant("bans", "Banned %s until %s (%s): %s", address, ban.Expires.Format(time.RFC3339), source, reason)
+	return ban, nil
+}
+
+// lift removes the ban on an address or subnet.  It returns false if there wasn't one.
+func (b *banList) lift(address string) bool {
+	address, err := normalizeBanAddress(address)
+	if nil != err {
+		return false
+	}
+	b.Lock()
+	defer b.Unlock()
+	_, present := b.bans[address]
+	if present {
+		delete(b.bans, address)
+		b.save()
+		significant("bans", "Lifted the ban on %s", address)
+	}
+	return present
+}
+
+// isBanned returns the ban covering address (an IP address, with or without a port), if there is one.
+func (b *banList) isBanned(address string) (Ban, bool) {
+	if host, _, err := net.SplitHostPort(address); nil == err {
+		address = host
+	}
+	ip := net.ParseIP(address)
+	if nil == ip {
+		return Ban{}, false
+	}
+	b.Lock()
+	defer b.Unlock()
+	for _, ban := range b.bans {
+		if !ban.expired() && ban.matches(ip) {
+			return ban, true
+		}
+	}
+	return Ban{}, false
+}
+
+// list returns the bans that haven't expired, oldest first, and forgets the expired ones.
+func (b *banList) list() []Ban {
+	b.Lock()
+	defer b.Unlock()
+	bans := []Ban{}
+	expired := false
+	for address, ban := range b.bans {
+		if ban.expired() {
+			delete(b.bans, address)
+			expired = true
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	if expired {
+		b.save()
+	}
+	sort.Sort(banSort(bans))
+	return bans
+}
+
+type banSort []Ban
+
+func (s banSort) Len() int {
+	return len(s)
+}
+func (s banSort) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s banSort) Less(i, j int) bool {
+	return s[i].Banned.Before(s[j].Banned)
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBanFilePath(t *testing.T) {
+	if path := banFilePath("/tmp/MainPeers.json"); "/tmp/MainPeersBans.json" != path {
+		t.Errorf("Got %s", path)
+	}
+}
+
+func TestBanList(t *testing.T) {
+	b := newBanList("")
+	if _, err := b.add("not an address", "test", BanSourceOperator, time.Hour); nil == err {
+		t.Errorf("Banned an invalid address")
+	}
+	if _, err := b.add("10.1.2.3", "test", BanSourceOperator, time.Hour); nil != err {
+		t.Errorf("%v", err)
+	}
+	if _, err := b.add("192.168.7.9/16", "test", BanSourceAutomatic, time.Hour); nil != err {
+		t.Errorf("%v", err)
+	}
+	b.add("172.16.0.1", "expired", BanSourceAutomatic, -time.Minute)
+
+	for _, c := range []struct {
+		address string
+		banned  bool
+	}{
+		{"10.1.2.3", true},
+		{"10.1.2.3:8108", true},
+		{"10.1.2.4", false},
+		{"192.168.200.1:8108", true},
+		{"192.169.0.1", false},
+		{"172.16.0.1", false},
+		{"garbage", false},
+	} {
+		if _, banned := b.isBanned(c.address); banned != c.banned {
+			t.Errorf("isBanned(%s) = %v, expected %v", c.address, banned, c.banned)
+		}
+	}
+
+	bans := b.list()
+	if 2 != len(bans) || "10.1.2.3" != bans[0].Address || "192.168.0.0/16" != bans[1].Address {
+		t.Errorf("Unexpected bans %+v", bans)
+	}
+
+	if !b.lift("192.168.0.0/16") || b.lift("192.168.0.0/16") {
+		t.Errorf("lift() should remove the ban once")
+	}
+	if _, banned := b.isBanned("192.168.200.1"); banned {
+		t.Errorf("Still banned after lift()")
+	}
+}
+
+func TestBanListPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bans")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "PeersBans.json")
+
+	b := newBanList(path)
+	b.add("10.1.2.3", "spam", BanSourceOperator, time.Hour)
+	b.add("10.1.2.4", "expired", BanSourceOperator, -time.Minute)
+
+	loaded := newBanList(path)
+	loaded.load()
+	ban, banned := loaded.isBanned("10.1.2.3")
+	if !banned || "spam" != ban.Reason || BanSourceOperator != ban.Source {
+		t.Errorf("Ban not reloaded, got %+v", ban)
+	}
+	if 1 != len(loaded.bans) {
+		t.Errorf("Expired ban was reloaded: %+v", loaded.bans)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Captures.  A capture is a recording of the parcels a node received from the network, and when, so the
+// traffic can be played back into a node later (see engine.ReplayTransport).  A capture starts with
+//
+//	[5] CaptureMagic
+//	[8] When the capture started, in nanoseconds since 1970
+//
+// so a replay can keep the time the parcels were captured at, and then has a series of records, each:
+//
+//	[8] Nanoseconds from the start of the capture to when the parcel arrived
+//	[4] Length of the frame
+//	[Length] The parcel, in the binary wire format (see wire.go)
+//
+// All integers are big endian.
+
+// CaptureMagic starts every capture.
+const CaptureMagic = "FCAP\x01"
+
+// maxCaptureFrame bounds a frame read from a capture, so a corrupt file can't make us allocate much.
+const maxCaptureFrame = wireFixedHeaderSize + 3*(binary.MaxVarintLen64+wireMaxStringSize) + MaxPayloadSize
+
+var errCaptureFrame = errors.New("p2p: capture frame too large")
+var errCaptureHeader = errors.New("p2p: not a capture")
+
+// CaptureWriter records parcels to a capture.
+type CaptureWriter struct {
+	sync.Mutex
+	w     *bufio.Writer
+	c     io.Closer // The underlying writer, if it can be closed
+	now   func() time.Time
+	start time.Time
+}
+
+// NewCaptureWriter starts a capture on w, keeping the time with now (eg time.Now).  Times in the capture are
+// from when it starts.
+func NewCaptureWriter(w io.Writer, now func() time.Time) *CaptureWriter {
+	c := new(CaptureWriter)
+	c.w = bufio.NewWriter(w)
+	c.c, _ = w.(io.Closer)
+	c.now = now
+	c.start = now()
+	var header [len(CaptureMagic) + 8]byte
+	copy(header[:], CaptureMagic)
+	binary.BigEndian.PutUint64(header[len(CaptureMagic):], uint64(c.start.UnixNano()))
+	c.w.Write(header[:]) // Buffered; any error comes back from the first Write or Close that flushes
+	return c
+}
+
+// Write records a parcel, received now.
+func (c *CaptureWriter) Write(parcel Parcel) error {
+	frame, err := MarshalParcel(&parcel)
+	if nil != err {
+		return err
+	}
+	var record [12]byte
+	binary.BigEndian.PutUint64(record[0:], uint64(c.now().Sub(c.start)))
+	binary.BigEndian.PutUint32(record[8:], uint32(len(frame)))
+	c.Lock()
+	defer c.Unlock()
+	if _, err = c.w.Write(record[:]); nil != err {
+		return err
+	}
+	_, err = c.w.Write(frame)
+	return err
+}
+
+// Close flushes the capture, and closes the underlying writer if it can be closed.
+func (c *CaptureWriter) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	err := c.w.Flush()
+	if nil != c.c {
+		if closeErr := c.c.Close(); nil == err {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// CaptureReader reads the parcels back from a capture.
+type CaptureReader struct {
+	r     *bufio.Reader
+	start time.Time
+}
+
+// NewCaptureReader reads the header of the capture on r, ready to read its parcels.
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	c := new(CaptureReader)
+	c.r = bufio.NewReader(r)
+	var header [len(CaptureMagic) + 8]byte
+	if _, err := io.ReadFull(c.r, header[:]); nil != err || CaptureMagic != string(header[:len(CaptureMagic)]) {
+		return nil, errCaptureHeader
+	}
+	c.start = time.Unix(0, int64(binary.BigEndian.Uint64(header[len(CaptureMagic):])))
+	return c, nil
+}
+
+// Start returns when the capture started.
+func (c *CaptureReader) Start() time.Time {
+	return c.start
+}
+
+// Next returns the next parcel in the capture, and how long after the start of the capture it arrived.
+// It returns io.EOF at the end of the capture.
+func (c *CaptureReader) Next() (time.Duration, Parcel, error) {
+	var parcel Parcel
+	var record [12]byte
+	if _, err := io.ReadFull(c.r, record[:]); nil != err {
+		if io.ErrUnexpectedEOF == err {
+			err = io.EOF // A capture cut off mid record (eg the node was killed) just ends there.
+		}
+		return 0, parcel, err
+	}
+	at := time.Duration(binary.BigEndian.Uint64(record[0:]))
+	length := binary.BigEndian.Uint32(record[8:])
+	if length > maxCaptureFrame {
+		return 0, parcel, errCaptureFrame
+	}
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(c.r, frame); nil != err {
+		return 0, parcel, io.EOF
+	}
+	if _, err := UnmarshalParcel(frame, &parcel); nil != err {
+		return 0, parcel, err
+	}
+	return at, parcel, nil
+}
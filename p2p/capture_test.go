@@ -0,0 +1,86 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCaptureWriter(&buf, time.Now)
+	parcels := []*Parcel{testParcel([]byte("first")), testParcel([]byte("second")), testParcel(nil)}
+	for _, parcel := range parcels {
+		if err := w.Write(*parcel); nil != err {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := w.Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	r, err := NewCaptureReader(bytes.NewReader(buf.Bytes()))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if time.Since(r.Start()) > time.Minute {
+		t.Errorf("Capture started at %s", r.Start())
+	}
+	var last time.Duration
+	for i, parcel := range parcels {
+		at, out, err := r.Next()
+		if nil != err {
+			t.Fatalf("Parcel %d: %v", i, err)
+		}
+		if !sameParcel(parcel, &out) {
+			t.Errorf("Parcel %d changed in the capture: %+v became %+v", i, parcel.Header, out.Header)
+		}
+		if at < last {
+			t.Errorf("Parcel %d at %s, before the one ahead of it at %s", i, at, last)
+		}
+		last = at
+	}
+	if _, _, err := r.Next(); io.EOF != err {
+		t.Errorf("Expected io.EOF at the end of the capture, got %v", err)
+	}
+
+	// A capture cut off mid record ends there.
+	r, _ = NewCaptureReader(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))
+	r.Next()
+	r.Next()
+	if _, _, err := r.Next(); io.EOF != err {
+		t.Errorf("Expected io.EOF for a cut off record, got %v", err)
+	}
+}
+
+func TestCaptureStart(t *testing.T) {
+	// The capture keeps the time of the clock it is given.
+	start := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	var buf bytes.Buffer
+	w := NewCaptureWriter(&buf, func() time.Time { return now })
+	now = now.Add(time.Second)
+	w.Write(*testParcel([]byte("first")))
+	w.Close()
+
+	r, err := NewCaptureReader(bytes.NewReader(buf.Bytes()))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !start.Equal(r.Start()) {
+		t.Errorf("Capture started at %s, expected %s", r.Start(), start)
+	}
+	if at, _, err := r.Next(); nil != err || time.Second != at {
+		t.Errorf("Parcel at %s, %v, expected a second in", at, err)
+	}
+
+	if _, err := NewCaptureReader(bytes.NewReader([]byte("not a capture"))); nil == err {
+		t.Errorf("Read a capture without the header")
+	}
+}
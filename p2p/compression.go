@@ -0,0 +1,72 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// Payload compression.  Peers that both advertise CapabilityCompression in their handshakes compress
+// payloads larger than CompressionThreshold with deflate, and set FlagCompressed in the header.  The Length
+// and Crc32 in the header are of the payload as sent, so parcelValidity checks the compressed bytes, and the
+// payload is inflated after that.
+
+// Parcel header flags
+const (
+	FlagCompressed uint16 = 1 << iota // The payload is deflated
+)
+
+var errInflatedTooLarge = errors.New("p2p: inflated payload larger than MaxPayloadSize")
+
+// compressParcel deflates the payload of a parcel if it is worth doing.  It returns false, and leaves the
+// parcel alone, if the payload is small or doesn't shrink.
+func compressParcel(parcel *Parcel) bool {
+	if len(parcel.Payload) <= CompressionThreshold || 0 != parcel.Header.Flags&FlagCompressed {
+		return false
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if nil != err {
+		return false
+	}
+	if _, err = w.Write(parcel.Payload); nil != err {
+		return false
+	}
+	if err = w.Close(); nil != err {
+		return false
+	}
+	if buf.Len() >= len(parcel.Payload) {
+		return false
+	}
+	parcel.Payload = buf.Bytes()
+	parcel.Header.Flags |= FlagCompressed
+	parcel.UpdateHeader()
+	return true
+}
+
+// decompressParcel inflates the payload of a parcel with FlagCompressed set.  The inflated payload is
+// bounded by MaxPayloadSize, so a peer can't send us a small parcel that inflates without limit.
+func decompressParcel(parcel *Parcel) error {
+	if 0 == parcel.Header.Flags&FlagCompressed {
+		return nil
+	}
+	r := flate.NewReader(bytes.NewReader(parcel.Payload))
+	defer r.Close()
+	payload, err := ioutil.ReadAll(io.LimitReader(r, MaxPayloadSize+1))
+	if nil != err {
+		return err
+	}
+	if len(payload) > MaxPayloadSize {
+		return errInflatedTooLarge
+	}
+	parcel.Payload = payload
+	parcel.Header.Flags &^= FlagCompressed
+	parcel.UpdateHeader()
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bytes"
+	"compress/flate"
+	"math/rand"
+	"testing"
+)
+
+func TestCompressParcel(t *testing.T) {
+	payload := bytes.Repeat([]byte("a block full of entries "), 2000)
+	parcel := testParcel(append([]byte(nil), payload...))
+	if !compressParcel(parcel) {
+		t.Fatalf("Did not compress a large payload")
+	}
+	if parcel.Header.Length >= uint32(len(payload)) || 0 == parcel.Header.Flags&FlagCompressed {
+		t.Errorf("Compressed header is wrong: %+v", parcel.Header)
+	}
+	if compressParcel(parcel) {
+		t.Errorf("Compressed a payload twice")
+	}
+
+	// Through the wire format and back.
+	data, err := MarshalParcel(parcel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Parcel
+	if _, err := UnmarshalParcel(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := decompressParcel(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, out.Payload) || 0 != out.Header.Flags&FlagCompressed || out.Header.Length != uint32(len(payload)) {
+		t.Errorf("Payload changed in compression")
+	}
+
+	small := testParcel([]byte("Ping"))
+	if compressParcel(small) {
+		t.Errorf("Compressed a payload under CompressionThreshold")
+	}
+	random := make([]byte, CompressionThreshold*4)
+	rand.New(rand.NewSource(3)).Read(random)
+	if compressParcel(testParcel(random)) {
+		t.Errorf("Compressed a payload that doesn't shrink")
+	}
+}
+
+func TestDecompressBounded(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(make([]byte, MaxPayloadSize+1))
+	w.Close()
+	parcel := testParcel(buf.Bytes())
+	parcel.Header.Flags = FlagCompressed
+	if err := decompressParcel(parcel); err != errInflatedTooLarge {
+		t.Errorf("Inflated past MaxPayloadSize: %v", err)
+	}
+
+	parcel = testParcel([]byte("not deflated"))
+	parcel.Header.Flags = FlagCompressed
+	if err := decompressParcel(parcel); err == nil {
+		t.Errorf("Inflated garbage")
+	}
+}
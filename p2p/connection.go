@@ -5,6 +5,8 @@
 package p2p
 
 import (
+	"bufio"
+	"crypto/tls"
 	"encoding/gob"
 	"fmt"
 	"hash/crc32"
@@ -22,8 +24,15 @@ type Connection struct {
 	SendChannel    chan interface{} // Send means "towards the network" Channel takes Parcels and ConnectionCommands
 	ReceiveChannel chan interface{} // Recieve means "from the network" Channel sends Parcels and ConnectionCommands
 	// and as "address" for sending messages to specific nodes.
-	encoder         *gob.Encoder      // Wire format is gobs in this version, may switch to binary
-	decoder         *gob.Decoder      // Wire format is gobs in this version, may switch to binary
+	encoder         parcelEncoder     // Wire format starts as gobs, and switches to binary after the handshake if both sides can.
+	decoder         parcelDecoder     // Wire format starts as gobs, and switches to binary after the handshake if both sides can.
+	reader          *bufio.Reader     // Shared by the decoders, so nothing buffered is lost when we switch.
+	handshakeDone   bool              // We have the peer's first parcel.  Until then we send nothing but our handshake.
+	binaryWire      bool              // True if we have switched to the binary wire format.
+	compress        bool              // True if both sides take compressed payloads.
+	sendQueues      [3][]Parcel       // Parcels waiting to go out, indexed by priority
+	sendLimiter     *rateLimiter      // Limits what we send to this peer, nil if unlimited
+	receiveLimiter  *rateLimiter      // Limits what we read from this peer, nil if unlimited
 	peer            Peer              // the datastructure representing the peer we are talking to. defined in peer.go
 	attempts        int               // reconnection attempts
 	timeLastAttempt time.Time         // time of last attempt to connect via dial
@@ -82,6 +91,18 @@ type ConnectionMetrics struct {
 	// Green: > 100
 	ConnectionState string // Basic state of the connection
 	ConnectionNotes string // Connectivity notes for the connection
+	WireFormat      string // "gob" or "binary"
+	Encrypted       bool   // True if the connection runs over TLS
+	PeerKey         string // Fingerprint of the key the peer presented, if encrypted
+	// Compression
+	BytesSentRaw     uint32  // BytesSent before compression
+	BytesReceivedRaw uint32  // BytesReceived after decompression
+	CompressionRatio float64 // Bytes on the wire over raw bytes, both directions.  1 means compression saved nothing.
+	// Bandwidth shaping
+	SendQueueDepth int    // Parcels waiting for bandwidth
+	DroppedParcels uint32 // Parcels dropped because their queue was full
+	// Filled in by the controller
+	ApplicationScore int32 // What the application thinks of the messages from this address (see Controller.scorePeer)
 }
 
 // ConnectionCommand is used to instruct the Connection to carry out some functionality.
@@ -158,6 +179,8 @@ func (c *Connection) commonInit(peer Peer) {
 	c.SendChannel = make(chan interface{}, 10000)
 	c.ReceiveChannel = make(chan interface{}, 10000)
 	c.metrics = ConnectionMetrics{MomentConnected: time.Now()}
+	c.sendLimiter = newRateLimiter(PeerSendRateLimit)
+	c.receiveLimiter = newRateLimiter(PeerReceiveRateLimit)
 	c.timeLastMetrics = time.Now()
 	c.timeLastAttempt = time.Now()
 	c.timeLastStatus = time.Now()
@@ -289,18 +312,38 @@ func (c *Connection) dial() bool {
 		c.setNotes(fmt.Sprintf("Connection.dial(%s) got error: %+v", address, err))
 		return false
 	}
+	if nil != NetworkIdentity {
+		secure, publicKey, err := NetworkIdentity.secureConnection(conn, true, c.peer.PinnedKey)
+		if nil != err {
+			conn.Close()
+			c.setNotes(fmt.Sprintf("Connection.dial(%s) encryption handshake failed: %+v", address, err))
+			return false
+		}
+		conn = secure
+		c.peer.PublicKey = publicKey
+	}
 	c.conn = conn
 	c.setNotes(fmt.Sprintf("Connection.dial(%s) was successful.", address))
 	return true
 }
 
+// isEncrypted tells us if the connection is running over TLS.
+func (c *Connection) isEncrypted() bool {
+	_, encrypted := c.conn.(*tls.Conn)
+	return encrypted
+}
+
 // Called when we are online and connected to the peer.
 func (c *Connection) goOnline() {
 	debug(c.peer.PeerIdent(), "Connection.goOnline() called.")
 	c.state = ConnectionOnline
 	now := time.Now()
+	c.reader = bufio.NewReader(c.conn)
 	c.encoder = gob.NewEncoder(c.conn)
-	c.decoder = gob.NewDecoder(c.conn)
+	c.decoder = gob.NewDecoder(c.reader)
+	c.binaryWire = false
+	c.compress = false
+	c.handshakeDone = false
 	c.attempts = 0
 	c.timeLastPing = now
 	c.timeLastAttempt = now
@@ -308,12 +351,60 @@ func (c *Connection) goOnline() {
 	c.peer.LastContact = now
 	// Probably shouldn't reset metrics when we go online. (Eg: say after a temp network problem)
 	// c.metrics = ConnectionMetrics{MomentConnected: now} // Reset metrics
+	// The handshake goes out first, ahead of anything in the SendChannel, and in gobs so older peers can read it.
+	ours := NewHandshake()
+	payload, err := ours.MarshalBinary()
+	if nil != err {
+		logfatal(c.peer.PeerIdent(), "Connection.goOnline() could not marshal our handshake: %+v", err)
+	}
+	handshake := NewParcel(CurrentNetwork, payload)
+	handshake.Header.Type = TypeHandshake
+	c.sendParcel(*handshake)
 	// Now ask the other side for the peers they know about.
 	parcel := NewParcel(CurrentNetwork, []byte("Peer Request"))
 	parcel.Header.Type = TypePeerRequest
 	BlockFreeChannelSend(c.SendChannel, ConnectionParcel{parcel: *parcel})
 }
 
+// handshake is called with the first parcel we get from the peer.  If the peer's handshake doesn't check out
+// we drop it, otherwise we note what it told us in the peer.  If we both speak the binary wire format, we
+// switch to it.  Older peers don't send a handshake, and get gobs.
+// Until the peer's first parcel arrives we hold our sends, so both sides switch at the same point in the stream.
+func (c *Connection) handshake(parcel Parcel) {
+	c.handshakeDone = true
+	if TypeHandshake != parcel.Header.Type {
+		note(c.peer.PeerIdent(), "Connection.handshake() peer sent no handshake, staying with gobs.")
+		return
+	}
+	var theirs Handshake
+	err := theirs.UnmarshalBinary(parcel.Payload)
+	if nil == err {
+		err = theirs.check()
+	}
+	if nil != err {
+		c.setNotes(fmt.Sprintf("Connection.handshake() rejected the peer's handshake: %+v", err))
+		c.attempts = MaxNumberOfRedialAttempts + 50 // so we don't redial invalid Peer
+		c.goShutdown()
+		return
+	}
+	c.peer.NodeID = theirs.NodeID
+	c.peer.Version = theirs.Version
+	c.peer.DBHeight = theirs.DBHeight
+	c.peer.Capabilities = theirs.Capabilities
+	if "" != theirs.ListenPort {
+		c.peer.Port = theirs.ListenPort
+	}
+	note(c.peer.PeerIdent(), "Connection.handshake() peer speaks version %d, is at height %d, and is %s", theirs.Version, theirs.DBHeight, CapabilityString(theirs.Capabilities))
+	c.updatePeer() // The controller keeps what we learned for routing.
+	c.compress = 0 != theirs.Capabilities&CapabilityCompression && 0 != NodeCapabilities&CapabilityCompression
+	if ProtocolVersionBinary <= theirs.Version && ProtocolVersionBinary <= ProtocolVersion {
+		note(c.peer.PeerIdent(), "Connection.handshake() peer speaks version %d, switching to the binary wire format.", theirs.Version)
+		c.encoder = newBinaryEncoder(c.conn)
+		c.decoder = newBinaryDecoder(c.reader)
+		c.binaryWire = true
+	}
+}
+
 func (c *Connection) goOffline() {
 	debug(c.peer.PeerIdent(), "Connection.goOffline()")
 	c.state = ConnectionOffline
@@ -329,19 +420,21 @@ func (c *Connection) goShutdown() {
 	}
 	c.decoder = nil
 	c.encoder = nil
+	c.reader = nil
+	c.sendQueues = [3][]Parcel{}
 	c.state = ConnectionShuttingDown
 }
 
 // processSends gets all the messages from the application and sends them out over the network
 func (c *Connection) processSends() {
 	// note(c.peer.PeerIdent(), "Connection.processSends() called. Items in send channel: %d State: %s", len(c.SendChannel), c.ConnectionState())
-	for 0 < len(c.SendChannel) && ConnectionOnline == c.state {
+	for 0 < len(c.SendChannel) && ConnectionOnline == c.state && c.handshakeDone {
 		message := <-c.SendChannel
 		switch message.(type) {
 		case ConnectionParcel:
 			verbose(c.peer.PeerIdent(), "processSends() ConnectionParcel")
 			parameters := message.(ConnectionParcel)
-			c.sendParcel(parameters.parcel)
+			c.queueParcel(parameters.parcel)
 		case ConnectionCommand:
 			verbose(c.peer.PeerIdent(), "processSends() ConnectionCommand")
 			parameters := message.(ConnectionCommand)
@@ -350,6 +443,39 @@ func (c *Connection) processSends() {
 			logfatal(c.peer.PeerIdent(), "processSends() unknown message?: %+v ", message)
 		}
 	}
+	if ConnectionOnline == c.state && c.handshakeDone {
+		c.sendQueued()
+	}
+}
+
+// queueParcel puts a parcel on the queue for its priority.
+func (c *Connection) queueParcel(parcel Parcel) {
+	priority := parcel.Priority()
+	if PriorityBulk < priority {
+		priority = PriorityNormal
+	}
+	if MaxSendQueue <= len(c.sendQueues[priority]) {
+		c.metrics.DroppedParcels++
+		debug(c.peer.PeerIdent(), "queueParcel() dropped a %s parcel, the queue for priority %d is full", parcel.MessageType(), priority)
+		return
+	}
+	c.sendQueues[priority] = append(c.sendQueues[priority], parcel)
+}
+
+// sendQueued sends queued parcels, highest priority first.  High priority parcels always go out; the rest
+// wait while we are over our send limit or the global one.
+func (c *Connection) sendQueued() {
+	for _, priority := range sendOrder {
+		for 0 < len(c.sendQueues[priority]) && ConnectionOnline == c.state {
+			if PriorityHigh != priority && !(c.sendLimiter.available() && globalSendLimiter.available()) {
+				return
+			}
+			parcel := c.sendQueues[priority][0]
+			c.sendQueues[priority][0] = Parcel{} // Let go of the payload
+			c.sendQueues[priority] = c.sendQueues[priority][1:]
+			c.sendParcel(parcel)
+		}
+	}
 }
 
 func (c *Connection) handleCommand(command ConnectionCommand) {
@@ -383,12 +509,23 @@ func (c *Connection) sendParcel(parcel Parcel) {
 	debug(c.peer.PeerIdent(), "sendParcel() sending message to network of type: %s", parcel.MessageType())
 	parcel.Header.NodeID = NodeID // Send it out with our ID for loopback.
 	verbose(c.peer.PeerIdent(), "sendParcel() Sanity check. State: %s Encoder: %+v, Parcel: %s", c.ConnectionState(), c.encoder, parcel.MessageType())
+	rawLength := parcel.Header.Length
+	if c.compress {
+		compressParcel(&parcel)
+	}
 	c.conn.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
 	err := c.encoder.Encode(parcel)
+	nerr, isNetError := err.(net.Error)
 	switch {
 	case nil == err:
 		c.metrics.BytesSent += parcel.Header.Length
+		c.metrics.BytesSentRaw += rawLength
+		c.sendLimiter.spend(parcel.Header.Length)
+		globalSendLimiter.spend(parcel.Header.Length)
 		c.metrics.MessagesSent += 1
+	case isNetError && nerr.Timeout() && c.isEncrypted(): // TLS can't recover from a write that timed out part way through a record.
+		c.setNotes(fmt.Sprintf("sendParcel() Write timed out on an encrypted connection: %+v", nerr))
+		c.goOffline()
 	default:
 		c.handleNetErrors(err)
 	}
@@ -401,6 +538,9 @@ func (c *Connection) sendParcel(parcel Parcel) {
 // -- we run out of data to recieve (which gives an io.EOF which is handled by handleNetErrors)
 func (c *Connection) processReceives() {
 	for ConnectionOnline == c.state {
+		if !(c.receiveLimiter.available() && globalReceiveLimiter.available()) {
+			return // Leave it in the socket for now.
+		}
 		var message Parcel
 		verbose(c.peer.PeerIdent(), "Connection.processReceives() called. State: %s", c.ConnectionState())
 		c.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
@@ -409,8 +549,16 @@ func (c *Connection) processReceives() {
 		case nil == err:
 			note(c.peer.PeerIdent(), "Connection.processReceives() RECIEVED FROM NETWORK!  State: %s MessageType: %s", c.ConnectionState(), message.MessageType())
 			c.metrics.BytesReceived += message.Header.Length
+			c.receiveLimiter.spend(message.Header.Length)
+			globalReceiveLimiter.spend(message.Header.Length)
 			c.metrics.MessagesReceived += 1
 			message.Header.PeerAddress = c.peer.Address
+			if !c.handshakeDone {
+				c.handshake(message)
+				if ConnectionOnline != c.state {
+					return
+				}
+			}
 			c.handleParcel(message)
 		default:
 			c.handleNetErrors(err)
@@ -463,6 +611,12 @@ func (c *Connection) handleParcel(parcel Parcel) {
 		c.peer.LastContact = time.Now() // We only update for valid messages (incluidng pings and heartbeats)
 		c.attempts = 0                  // reset since we are clearly in touch now.
 		c.peer.merit()                  // Increase peer quality score.
+		if err := decompressParcel(&parcel); nil != err {
+			significant(c.peer.PeerIdent(), "Connection.handleParcel() could not decompress the payload: %+v", err)
+			c.peer.demerit()
+			return
+		}
+		c.metrics.BytesReceivedRaw += parcel.Header.Length
 		debug(c.peer.PeerIdent(), "Connection.handleParcel() got ParcelValid %s", parcel.MessageType())
 		if Notes <= CurrentLoggingLevel {
 			parcel.PrintMessageType()
@@ -521,6 +675,9 @@ func (c *Connection) handleParcelTypes(parcel Parcel) {
 	case TypePong: // all we need is the timestamp which is set already
 		debug(c.peer.PeerIdent(), "handleParcelTypes() GOT Pong.")
 		return
+	case TypeHandshake: // Dealt with in handshake() when it's the first parcel.
+		debug(c.peer.PeerIdent(), "handleParcelTypes() GOT Handshake.")
+		return
 	case TypePeerRequest:
 		debug(c.peer.PeerIdent(), "handleParcelTypes() TypePeerRequest")
 		BlockFreeChannelSend(c.ReceiveChannel, ConnectionParcel{parcel: parcel}) // Controller handles these.
@@ -572,6 +729,17 @@ func (c *Connection) updateStats() {
 		c.metrics.PeerQuality = c.peer.QualityScore
 		c.metrics.ConnectionState = connectionStateStrings[c.state]
 		c.metrics.ConnectionNotes = c.notes
+		c.metrics.WireFormat = "gob"
+		if c.binaryWire {
+			c.metrics.WireFormat = "binary"
+		}
+		c.metrics.Encrypted = nil != c.conn && c.isEncrypted()
+		c.metrics.SendQueueDepth = len(c.sendQueues[PriorityHigh]) + len(c.sendQueues[PriorityNormal]) + len(c.sendQueues[PriorityBulk])
+		c.metrics.CompressionRatio = 1
+		if raw := c.metrics.BytesSentRaw + c.metrics.BytesReceivedRaw; 0 < raw {
+			c.metrics.CompressionRatio = float64(c.metrics.BytesSent+c.metrics.BytesReceived) / float64(raw)
+		}
+		c.metrics.PeerKey = c.peer.PublicKey
 		verbose(c.peer.PeerIdent(), "updatePeer() SENDING ConnectionUpdateMetrics - Bytes Sent: %d Bytes Received: %d", c.metrics.BytesSent, c.metrics.BytesReceived)
 		BlockFreeChannelSend(c.ReceiveChannel, ConnectionCommand{command: ConnectionUpdateMetrics, metrics: c.metrics})
 	}
@@ -15,6 +15,7 @@ import (
 	"math/rand"
 	"net"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 )
@@ -24,6 +25,7 @@ type Controller struct {
 	keepRunning bool // Indicates its time to shut down when false.
 
 	listenPort           string                // port we listen on for new connections
+	listenAddress        string                // address we listen on, "" for all of them
 	connections          map[string]Connection // map of the connections indexed by peer hash
 	connectionsByAddress map[string]Connection // map of the connections indexed by peer address
 
@@ -45,17 +47,32 @@ type Controller struct {
 	lastDiscoveryRequest       time.Time
 	NodeID                     uint64
 	lastStatusReport           time.Time
-	lastPeerRequest            time.Time // Last time we asked peers about the peers they know about.
-	specialPeersString         string    // configuration set special peers
+	lastPeerRequest            time.Time         // Last time we asked peers about the peers they know about.
+	specialPeersString         string            // configuration set special peers
+	pinnedKeys                 map[string]string // Key fingerprints special peers must present, indexed by address
+	bans                       *banList          // Addresses and subnets we won't talk to
+	applicationScores          map[string]int32  // The application's score for each address, kept across reconnects
+	peerHeights                map[string]uint32 // Handshake heights of the connected peers, for the application
+	peerHeightsLock            sync.RWMutex      // peerHeights is read from the application's goroutines
 }
 
 type ControllerInit struct {
 	Port                     string           // Port to listen on
+	ListenAddress            string           // Address to listen on, eg 0.0.0.0 or ::1.  "" listens on every IPv4 and IPv6 address.
 	PeersFile                string           // Path to file to find / save peers
 	Network                  NetworkID        // Network - eg MainNet, TestNet etc.
 	Exclusive                bool             // flag to indicate we should only connect to trusted peers
 	SeedURL                  string           // URL to a source of peer info
 	SpecialPeers             string           // Peers to always connect to at startup, and stay persistent
+	Encrypt                  bool             // Wrap connections in TLS, identifying ourselves with the key in IdentityFile
+	IdentityFile             string           // Path to our network identity key.  Created if it doesn't exist.
+	Capabilities             uint32           // Capability flags to advertise in our handshake
+	DBHeight                 func() uint32    // Gives the directory block height to advertise in our handshake
+	SendLimit                int              // Bytes per second we send, over all peers.  0 is unlimited.
+	ReceiveLimit             int              // Bytes per second we read, over all peers.  0 is unlimited.
+	PeerSendLimit            int              // Bytes per second we send to any one peer.  0 is unlimited.
+	PeerReceiveLimit         int              // Bytes per second we read from any one peer.  0 is unlimited.
+	BanDuration              time.Duration    // How long bans last.  0 keeps the default.
 	ConnectionMetricsChannel chan interface{} // Channel on which we put the connection metrics map, periodically.
 }
 
@@ -68,7 +85,8 @@ type CommandDialPeer struct {
 // CommandAddPeer is used to instruct the Controller to add a connection
 // This connection can come from acceptLoop or some other way.
 type CommandAddPeer struct {
-	conn net.Conn
+	conn      net.Conn
+	publicKey string // Fingerprint of the key the peer presented, if the connection is encrypted
 }
 
 // CommandShutdown is used to instruct the Controller to takve various actions.
@@ -87,6 +105,11 @@ type CommandBan struct {
 	peerHash string
 }
 
+// CommandEnforceBans is used to instruct the Controller to disconnect any peers that are now banned
+type CommandEnforceBans struct {
+	_ uint8
+}
+
 // CommandDisconnect is used to instruct the Controller to disconnect from a peer
 type CommandDisconnect struct {
 	peerHash string
@@ -119,7 +142,36 @@ func (c *Controller) Init(ci ControllerInit) *Controller {
 	c.connections = make(map[string]Connection)
 	c.connectionMetrics = make(map[string]ConnectionMetrics)
 	c.connectionMetricsChannel = ci.ConnectionMetricsChannel
+	c.pinnedKeys = make(map[string]string)
+	if 0 != ci.Capabilities {
+		NodeCapabilities = ci.Capabilities
+	}
+	DBHeightFunc = ci.DBHeight
+	SetBandwidthLimits(ci.SendLimit, ci.ReceiveLimit)
+	PeerSendRateLimit = ci.PeerSendLimit
+	PeerReceiveRateLimit = ci.PeerReceiveLimit
+	if 0 < ci.BanDuration {
+		BanDuration = ci.BanDuration
+	}
+	bansFile := ""
+	if "" != ci.PeersFile {
+		bansFile = banFilePath(ci.PeersFile)
+	}
+	c.bans = newBanList(bansFile)
+	c.applicationScores = make(map[string]int32)
+	c.peerHeights = make(map[string]uint32)
+	c.bans.load()
+	NetworkIdentity = nil
+	if ci.Encrypt {
+		identity, err := LoadIdentity(ci.IdentityFile)
+		if nil != err {
+			logfatal("ctrlr", "Controller.Init() could not load the network identity from %s: %+v", ci.IdentityFile, err)
+		}
+		NetworkIdentity = identity
+		significant("ctrlr", "Controller.Init() connections are encrypted.  Our network identity is %s", identity.Fingerprint)
+	}
 	c.listenPort = ci.Port
+	c.listenAddress = normalizeAddress(ci.ListenAddress)
 	NetworkListenPort = ci.Port
 	c.lastPeerManagement = time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
 	c.lastPeerRequest = time.Now()
@@ -150,6 +202,8 @@ func (c *Controller) StartNetwork() {
 }
 
 // DialSpecialPeersString lets us pass in a string of special peers to dial
+// A peer may be pinned to the key it must present on encrypted connections, eg: 1.2.3.4:8108@<key fingerprint>
+// IPv6 peers are written with brackets, eg: [2001:db8::1]:8108
 func (c *Controller) DialSpecialPeersString(peersString string) {
 	note("ctrlr", "DialSpecialPeersString() Dialing Special Peers %s", peersString)
 	parseFunc := func(c rune) bool {
@@ -158,8 +212,16 @@ func (c *Controller) DialSpecialPeersString(peersString string) {
 	peerAddresses := strings.FieldsFunc(peersString, parseFunc)
 	for _, peerAddress := range peerAddresses {
 		fmt.Println("Dialing Peer: ", peerAddress)
-		ipPort := strings.Split(peerAddress, ":")
-		peer := new(Peer).Init(ipPort[0], ipPort[1], 0, SpecialPeer, 0)
+		addressKey := strings.SplitN(peerAddress, "@", 2)
+		address, port, err := splitAddressPort(addressKey[0])
+		if nil != err {
+			logerror("ctrlr", "DialSpecialPeersString() skipping %s: %+v", peerAddress, err)
+			continue
+		}
+		peer := new(Peer).Init(address, port, 0, SpecialPeer, 0)
+		if 2 == len(addressKey) {
+			peer.PinnedKey = strings.ToLower(addressKey[1])
+		}
 		peer.Source["Local-Configuration"] = time.Now()
 		c.DialPeer(*peer, true) // these are persistent connections
 	}
@@ -189,11 +251,36 @@ func (c *Controller) AddPeer(conn net.Conn) {
 	BlockFreeChannelSend(c.commandChannel, CommandAddPeer{conn: conn})
 }
 
+// addSecurePeer runs the encryption handshake on an incoming connection, in its own goroutine so a slow peer
+// doesn't hold up the accept loop, and then adds the peer.
+func (c *Controller) addSecurePeer(conn net.Conn) {
+	secure, publicKey, err := NetworkIdentity.secureConnection(conn, false, "")
+	if nil != err {
+		note("ctrlr", "Controller.addSecurePeer() encryption handshake with %s failed: %+v", conn.RemoteAddr().String(), err)
+		conn.Close()
+		return
+	}
+	debug("ctrlr", "CommandAddPeer for %+v with key %s", conn, publicKey)
+	BlockFreeChannelSend(c.commandChannel, CommandAddPeer{conn: secure, publicKey: publicKey})
+}
+
 func (c *Controller) NetworkStop() {
 	debug("ctrlr", "NetworkStop %+v", c)
 	BlockFreeChannelSend(c.commandChannel, CommandShutdown{})
 }
 
+// PeerHeights returns the directory block height each connected peer advertised in its handshake, indexed
+// by peer hash.  It is refreshed with the connection metrics, about once a second.
+func (c *Controller) PeerHeights() map[string]uint32 {
+	c.peerHeightsLock.RLock()
+	defer c.peerHeightsLock.RUnlock()
+	heights := make(map[string]uint32, len(c.peerHeights))
+	for hash, height := range c.peerHeights {
+		heights[hash] = height
+	}
+	return heights
+}
+
 func (c *Controller) AdjustPeerQuality(peerHash string, adjustment int32) {
 	debug("ctrlr", "AdjustPeerQuality ")
 	BlockFreeChannelSend(c.commandChannel, CommandAdjustPeerQuality{peerHash: peerHash, adjustment: adjustment})
@@ -204,6 +291,25 @@ func (c *Controller) Ban(peerHash string) {
 	BlockFreeChannelSend(c.commandChannel, CommandBan{peerHash: peerHash})
 }
 
+// BanAddress bans an IP address or subnet (eg 10.1.0.0/16) for BanDuration, and disconnects any peers in it.
+func (c *Controller) BanAddress(address string, reason string) (Ban, error) {
+	ban, err := c.bans.add(address, reason, BanSourceOperator, BanDuration)
+	if nil == err {
+		BlockFreeChannelSend(c.commandChannel, CommandEnforceBans{})
+	}
+	return ban, err
+}
+
+// LiftBan removes the ban on an IP address or subnet.  It returns false if there wasn't one.
+func (c *Controller) LiftBan(address string) bool {
+	return c.bans.lift(address)
+}
+
+// Bans returns the bans in force.
+func (c *Controller) Bans() []Ban {
+	return c.bans.list()
+}
+
 func (c *Controller) Disconnect(peerHash string) {
 	debug("ctrlr", "Ban %s ", peerHash)
 	BlockFreeChannelSend(c.commandChannel, CommandDisconnect{peerHash: peerHash})
@@ -223,7 +329,7 @@ func (c *Controller) Disconnect(peerHash string) {
 //////////////////////////////////////////////////////////////////////
 
 func (c *Controller) listen() {
-	address := fmt.Sprintf(":%s", c.listenPort)
+	address := net.JoinHostPort(c.listenAddress, c.listenPort)
 	debug("ctrlr", "Controller.listen(%s) got address %s", c.listenPort, address)
 	listener, err := net.Listen("tcp", address)
 	if nil != err {
@@ -241,7 +347,14 @@ func (c *Controller) acceptLoop(listener net.Listener) {
 		conn, err := listener.Accept()
 		switch err {
 		case nil:
+			ban, banned := c.bans.isBanned(conn.RemoteAddr().String())
 			switch {
+			case banned:
+				note("ctrlr", "Controller.acceptLoop() refused %s, banned until %s: %s", conn.RemoteAddr().String(), ban.Expires.String(), ban.Reason)
+				conn.Close()
+			case c.numberIncommingConnections < MaxNumberIncommingConnections && nil != NetworkIdentity:
+				go c.addSecurePeer(conn) // Handshakes, then sends command to add the peer to the peers list
+				note("ctrlr", "Controller.acceptLoop() new peer: %+v", conn)
 			case c.numberIncommingConnections < MaxNumberIncommingConnections:
 				c.AddPeer(conn) // Sends command to add the peer to the peers list
 				note("ctrlr", "Controller.acceptLoop() new peer: %+v", conn)
@@ -426,6 +539,11 @@ func (c *Controller) handleConnectionCommand(command ConnectionCommand, connecti
 		dot("&&r\n")
 		note("ctrlr", "handleConnectionCommand() Got ConnectionUpdatingPeer from  %s", connection.peer.Hash)
 		c.discovery.updatePeer(command.peer)
+		c.banForQuality(command.peer)
+		if current, present := c.connections[connection.peer.Hash]; present {
+			current.peer = command.peer // Keep what the connection learned (eg: from the handshake) for routing.
+			c.connections[connection.peer.Hash] = current
+		}
 	default:
 		logfatal("ctrlr", "handleParcelReceive() unknown command.command?: %+v ", command.command)
 	}
@@ -435,6 +553,9 @@ func (c *Controller) handleCommand(command interface{}) {
 	switch commandType := command.(type) {
 	case CommandDialPeer: // parameter is the peer address
 		parameters := command.(CommandDialPeer)
+		if "" != parameters.peer.PinnedKey {
+			c.pinnedKeys[parameters.peer.Address] = parameters.peer.PinnedKey
+		}
 		conn := new(Connection).Init(parameters.peer, parameters.persistent)
 		connection := *conn
 		connection.Start()
@@ -444,12 +565,25 @@ func (c *Controller) handleCommand(command interface{}) {
 	case CommandAddPeer: // parameter is a Connection. This message is sent by the accept loop which is in a different goroutine
 		parameters := command.(CommandAddPeer)
 		conn := parameters.conn // net.Conn
-		addPort := strings.Split(conn.RemoteAddr().String(), ":")
+		address, port, err := splitAddressPort(conn.RemoteAddr().String())
+		if nil != err {
+			logerror("ctrlr", "Controller.handleCommand(CommandAddPeer) could not parse %s: %+v", conn.RemoteAddr().String(), err)
+			conn.Close()
+			break
+		}
 		debug("ctrlr", "Controller.handleCommand(CommandAddPeer) got rconn.RemoteAddr().String() %s and parsed IP: %s and Port: %s",
-			conn.RemoteAddr().String(), addPort[0], addPort[1])
+			conn.RemoteAddr().String(), address, port)
 		// Port initially stored will be the connection port (not the listen port), but peer will update it on first message.
-		peer := new(Peer).Init(addPort[0], addPort[1], 0, RegularPeer, 0)
+		pinnedKey, pinned := c.pinnedKeys[address]
+		if pinned && nil != NetworkIdentity && pinnedKey != parameters.publicKey {
+			significant("ctrlr", "Controller.handleCommand(CommandAddPeer) %s presented key %q but is pinned to %s, dropping it.", address, parameters.publicKey, pinnedKey)
+			conn.Close()
+			break
+		}
+		peer := new(Peer).Init(address, port, 0, RegularPeer, 0)
 		peer.Source["Accept()"] = time.Now()
+		peer.PinnedKey = pinnedKey
+		peer.PublicKey = parameters.publicKey
 		connection := new(Connection).InitWithConn(conn, *peer)
 		connection.Start()
 		c.connections[connection.peer.Hash] = *connection
@@ -465,13 +599,22 @@ func (c *Controller) handleCommand(command interface{}) {
 	case CommandAdjustPeerQuality:
 		verbose("ctrlr", "handleCommand() Processing command: CommandDemerit")
 		parameters := command.(CommandAdjustPeerQuality)
-		peerHash := parameters.peerHash
-		c.applicationPeerUpdate(parameters.adjustment, peerHash)
+		c.scorePeer(parameters.peerHash, parameters.adjustment)
 	case CommandBan:
 		verbose("ctrlr", "handleCommand() Processing command: CommandBan")
 		parameters := command.(CommandBan)
 		peerHash := parameters.peerHash
+		if connection, present := c.connections[peerHash]; present {
+			c.bans.add(connection.peer.Address, "Banned by operator", BanSourceOperator, BanDuration)
+		}
 		c.applicationPeerUpdate(BannedQualityScore, peerHash)
+	case CommandEnforceBans:
+		verbose("ctrlr", "handleCommand() Processing command: CommandEnforceBans")
+		for _, connection := range c.connections {
+			if _, banned := c.bans.isBanned(connection.peer.Address); banned {
+				BlockFreeChannelSend(connection.SendChannel, ConnectionCommand{command: ConnectionShutdownNow})
+			}
+		}
 	case CommandDisconnect:
 		verbose("ctrlr", "handleCommand() Processing command: CommandDisconnect")
 		parameters := command.(CommandDisconnect)
@@ -484,6 +627,63 @@ func (c *Controller) handleCommand(command interface{}) {
 		logfatal("ctrlr", "Unkown p2p.Controller command recieved: %+v", commandType)
 	}
 }
+
+// banForQuality bans a peer whose quality score has dropped below MinumumQualityScore.
+func (c *Controller) banForQuality(peer Peer) {
+	if MinumumQualityScore <= peer.QualityScore {
+		return
+	}
+	c.banAutomatically(peer, fmt.Sprintf("Quality score %d dropped below %d", peer.QualityScore, MinumumQualityScore))
+}
+
+// banAutomatically bans a misbehaving peer's address.  Special peers and loopback addresses (eg: several nodes
+// on one machine) are never banned automatically.  It returns true if the peer was banned.
+func (c *Controller) banAutomatically(peer Peer, reason string) bool {
+	if SpecialPeer == peer.Type {
+		return false
+	}
+	if ip := net.ParseIP(peer.Address); nil == ip || ip.IsLoopback() {
+		return false
+	}
+	if _, banned := c.bans.isBanned(peer.Address); banned {
+		return false
+	}
+	_, err := c.bans.add(peer.Address, reason, BanSourceAutomatic, BanDuration)
+	return nil == err
+}
+
+// scorePeer applies the application's opinion of a message to the peer that sent it.  The connection's
+// quality score takes the adjustment, so it disconnects itself below MinumumQualityScore as before.  The
+// application's score is also kept by address, so a peer can't clear it by reconnecting, and an address
+// whose score falls below BanApplicationScore is banned.
+func (c *Controller) scorePeer(peerHash string, adjustment int32) {
+	connection, present := c.connections[peerHash]
+	if !present {
+		return
+	}
+	address := connection.peer.Address
+	score := int64(c.applicationScores[address]) + int64(adjustment)
+	switch {
+	case score > int64(MaxApplicationScore):
+		score = int64(MaxApplicationScore)
+	case score < int64(BannedQualityScore):
+		score = int64(BannedQualityScore)
+	}
+	c.applicationScores[address] = int32(score)
+	c.applicationPeerUpdate(adjustment, peerHash)
+	switch {
+	case score < int64(BanApplicationScore):
+		reason := fmt.Sprintf("Application score %d dropped below %d", score, BanApplicationScore)
+		if c.banAutomatically(connection.peer, reason) {
+			delete(c.applicationScores, address)
+			BlockFreeChannelSend(connection.SendChannel, ConnectionCommand{command: ConnectionShutdownNow})
+		}
+	case score < int64(MinumumQualityScore) && !connection.isPersistent:
+		note("ctrlr", "scorePeer() disconnecting %s, application score %d", connection.peer.PeerIdent(), score)
+		BlockFreeChannelSend(connection.SendChannel, ConnectionCommand{command: ConnectionShutdownNow})
+	}
+}
+
 func (c *Controller) applicationPeerUpdate(qualityDelta int32, peerHash string) {
 	connection, present := c.connections[peerHash]
 	if present {
@@ -565,6 +765,10 @@ func (c *Controller) fillOutgoingSlots() {
 	peers := c.discovery.GetOutgoingPeers()
 
 	for _, peer := range peers {
+		if _, banned := c.bans.isBanned(peer.Address); banned {
+			note("controller", "Not dialing %s, it is banned.", peer.AddressPort())
+			continue
+		}
 		if c.weAreNotAlreadyConnectedTo(peer) {
 			note("controller", "We think we are not already connected to: %s so dialing.", peer.AddressPort())
 			c.DialPeer(peer, false)
@@ -592,9 +796,25 @@ func (c *Controller) updateMetrics() {
 					PeerQuality:      metrics.PeerQuality,
 					ConnectionState:  metrics.ConnectionState,
 					ConnectionNotes:  metrics.ConnectionNotes,
+					WireFormat:       metrics.WireFormat,
+					Encrypted:        metrics.Encrypted,
+					PeerKey:          metrics.PeerKey,
+					BytesSentRaw:     metrics.BytesSentRaw,
+					BytesReceivedRaw: metrics.BytesReceivedRaw,
+					CompressionRatio: metrics.CompressionRatio,
+					SendQueueDepth:   metrics.SendQueueDepth,
+					DroppedParcels:   metrics.DroppedParcels,
+					ApplicationScore: c.applicationScores[value.peer.Address],
 				}
 			}
 		}
+		heights := make(map[string]uint32)
+		for key, value := range c.connections {
+			heights[key] = value.peer.DBHeight
+		}
+		c.peerHeightsLock.Lock()
+		c.peerHeights = heights
+		c.peerHeightsLock.Unlock()
 		dot("@@9\n")
 		BlockFreeChannelSend(c.connectionMetricsChannel, newMetrics)
 		dot("@@10\n")
@@ -603,6 +823,8 @@ func (c *Controller) updateMetrics() {
 
 func (c *Controller) shutdown() {
 	debug("ctrlr", "Controller.shutdown() ")
+	// Save what we know about our peers, so we can find them again on restart.
+	c.discovery.SavePeers()
 	// Go thru peer list and shut down connections.
 	for _, connection := range c.connections {
 		BlockFreeChannelSend(connection.SendChannel, ConnectionCommand{command: ConnectionShutdownNow})
@@ -0,0 +1,84 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"testing"
+)
+
+func testScoringController(peer Peer) (*Controller, Connection) {
+	c := new(Controller)
+	c.connections = make(map[string]Connection)
+	c.applicationScores = make(map[string]int32)
+	c.bans = newBanList("")
+	connection := Connection{peer: peer, SendChannel: make(chan interface{}, 100)}
+	c.connections[peer.Hash] = connection
+	return c, connection
+}
+
+// shutdownSent returns true if a ConnectionShutdownNow is waiting on the connection's channel.
+func shutdownSent(connection Connection) bool {
+	for {
+		select {
+		case command := <-connection.SendChannel:
+			if cc, ok := command.(ConnectionCommand); ok && ConnectionShutdownNow == cc.command {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
+
+func TestScorePeer(t *testing.T) {
+	peer := Peer{Hash: "10.1.2.3:8108", Address: "10.1.2.3", Port: "8108", Type: RegularPeer}
+	c, connection := testScoringController(peer)
+
+	c.scorePeer(peer.Hash, MaxApplicationScore*2)
+	if MaxApplicationScore != c.applicationScores[peer.Address] {
+		t.Errorf("Score %d not capped at %d", c.applicationScores[peer.Address], MaxApplicationScore)
+	}
+	if shutdownSent(connection) {
+		t.Errorf("Disconnected a good peer")
+	}
+
+	c.scorePeer(peer.Hash, MinumumQualityScore-MaxApplicationScore-1)
+	if !shutdownSent(connection) {
+		t.Errorf("Peer below MinumumQualityScore was not disconnected")
+	}
+	if _, banned := c.bans.isBanned(peer.Address); banned {
+		t.Errorf("Peer banned before BanApplicationScore")
+	}
+
+	c.scorePeer(peer.Hash, BanApplicationScore)
+	if !shutdownSent(connection) {
+		t.Errorf("Peer below BanApplicationScore was not disconnected")
+	}
+	if ban, banned := c.bans.isBanned(peer.Address); !banned || BanSourceAutomatic != ban.Source {
+		t.Errorf("Peer below BanApplicationScore was not banned: %+v", ban)
+	}
+	if _, present := c.applicationScores[peer.Address]; present {
+		t.Errorf("Score kept after the ban")
+	}
+
+	c.scorePeer("unknown", BannedQualityScore) // No connection, nothing to do
+}
+
+func TestScorePeerNeverBansSpecialOrLocal(t *testing.T) {
+	for _, peer := range []Peer{
+		{Hash: "10.1.2.3:8108", Address: "10.1.2.3", Port: "8108", Type: SpecialPeer},
+		{Hash: "127.0.0.1:8108", Address: "127.0.0.1", Port: "8108", Type: RegularPeer},
+	} {
+		c, _ := testScoringController(peer)
+		c.scorePeer(peer.Hash, BannedQualityScore)
+		c.scorePeer(peer.Hash, BannedQualityScore)
+		if _, banned := c.bans.isBanned(peer.Address); banned {
+			t.Errorf("Banned %+v", peer)
+		}
+		if BannedQualityScore != c.applicationScores[peer.Address] {
+			t.Errorf("Score %d did not bottom out at BannedQualityScore", c.applicationScores[peer.Address])
+		}
+	}
+}
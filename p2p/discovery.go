@@ -13,7 +13,6 @@ import (
 	"os"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 )
@@ -101,6 +100,8 @@ func (d *Discovery) LoadPeers() {
 	// since this is run at startup, reset quality scores.
 	for _, peer := range d.knownPeers {
 		peer.QualityScore = 0
+		peer.Address = normalizeAddress(peer.Address)
+		peer.Location = peer.locationFromAddress()
 		d.knownPeers[peer.Address] = peer
 	}
 	UpdateKnownPeers.Unlock()
@@ -152,6 +153,8 @@ func (d *Discovery) LearnPeers(parcel Parcel) {
 	filteredArray := d.filterPeersFromOtherNetworks(peerArray)
 	for _, value := range filteredArray {
 		value.QualityScore = 0
+		value.Address = normalizeAddress(value.Address) // Other nodes may write IPv6 addresses differently
+		value.Location = value.locationFromAddress()
 		switch d.isPeerPresent(value) {
 		case true:
 			alreadyKnownPeer := d.getPeer(value.Address)
@@ -189,10 +192,11 @@ func (d *Discovery) filterPeersFromOtherNetworks(peers []Peer) (filtered []Peer)
 func (d *Discovery) filterForUniqueIPAdresses(peers []Peer) (filtered []Peer) {
 	unique := map[string]Peer{}
 	for _, peer := range peers {
-		_, present := unique[peer.Address]
+		address := normalizeAddress(peer.Address) // IPv6 addresses can be written several ways
+		_, present := unique[address]
 		if !present {
 			filtered = append(filtered, peer)
-			unique[peer.Address] = peer
+			unique[address] = peer
 		}
 	}
 	return
@@ -310,8 +314,12 @@ func (d *Discovery) DiscoverPeersFromSeed() {
 		lines = append(lines, scanner.Text())
 	}
 	for _, line := range lines {
-		ipAndPort := strings.Split(line, ":")
-		peerp := new(Peer).Init(ipAndPort[0], ipAndPort[1], 0, RegularPeer, 0)
+		address, port, err := splitAddressPort(line)
+		if nil != err {
+			logerror("discovery", "DiscoverPeersFromSeed skipping %q: %+v", line, err)
+			continue
+		}
+		peerp := new(Peer).Init(address, port, 0, RegularPeer, 0)
 		peer := *peerp
 		d.updatePeer(d.updatePeerSource(peer, "DNS-Seed"))
 	}
@@ -0,0 +1,127 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Handshake is the payload of the TypeHandshake parcel each side sends first on a new connection.  Nothing
+// else is sent until we have the peer's handshake, and a peer whose handshake doesn't check out is dropped
+// before any application message flows.
+type Handshake struct {
+	Version      uint16    // The protocol version the peer speaks
+	Network      NetworkID // The network the peer is on
+	NodeID       uint64    // The peer's node ID (for loopback detection)
+	ListenPort   string    // The port the peer listens on, so we can dial it later
+	DBHeight     uint32    // The peer's highest saved directory block
+	Capabilities uint32    // The Capability flags below
+}
+
+// Capability flags advertised in the handshake
+const (
+	CapabilityFullNode    uint32 = 1 << iota // Validates and relays everything
+	CapabilityPruned                         // Doesn't keep the full history
+	CapabilityArchive                        // Keeps every block, and can serve catch up from genesis
+	CapabilityCompression                    // Takes compressed payloads (see compression.go)
+)
+
+// NodeCapabilities are the flags we advertise in our handshake.
+var NodeCapabilities = CapabilityFullNode | CapabilityArchive | CapabilityCompression
+
+// DBHeightFunc, if set, tells us the directory block height to advertise in our handshake.
+var DBHeightFunc func() uint32
+
+// handshakeFixedSize is the size of a handshake payload without the listen port.
+const handshakeFixedSize = 22
+
+var errHandshakeShort = errors.New("p2p: handshake payload too short")
+
+// NewHandshake returns our handshake.
+func NewHandshake() Handshake {
+	h := Handshake{
+		Version:      ProtocolVersion,
+		Network:      CurrentNetwork,
+		NodeID:       NodeID,
+		ListenPort:   NetworkListenPort,
+		Capabilities: NodeCapabilities,
+	}
+	if nil != DBHeightFunc {
+		h.DBHeight = DBHeightFunc()
+	}
+	return h
+}
+
+func (h *Handshake) MarshalBinary() ([]byte, error) {
+	if len(h.ListenPort) > wireMaxStringSize {
+		return nil, errWireString
+	}
+	buf := make([]byte, handshakeFixedSize+binary.MaxVarintLen64+len(h.ListenPort))
+	binary.BigEndian.PutUint16(buf[0:], h.Version)
+	binary.BigEndian.PutUint32(buf[2:], uint32(h.Network))
+	binary.BigEndian.PutUint64(buf[6:], h.NodeID)
+	binary.BigEndian.PutUint32(buf[14:], h.DBHeight)
+	binary.BigEndian.PutUint32(buf[18:], h.Capabilities)
+	i := handshakeFixedSize
+	i += binary.PutUvarint(buf[i:], uint64(len(h.ListenPort)))
+	i += copy(buf[i:], h.ListenPort)
+	return buf[:i], nil
+}
+
+func (h *Handshake) UnmarshalBinary(data []byte) error {
+	if len(data) < handshakeFixedSize {
+		return errHandshakeShort
+	}
+	h.Version = binary.BigEndian.Uint16(data[0:])
+	h.Network = NetworkID(binary.BigEndian.Uint32(data[2:]))
+	h.NodeID = binary.BigEndian.Uint64(data[6:])
+	h.DBHeight = binary.BigEndian.Uint32(data[14:])
+	h.Capabilities = binary.BigEndian.Uint32(data[18:])
+	l, n := binary.Uvarint(data[handshakeFixedSize:])
+	switch {
+	case n == 0:
+		return errHandshakeShort
+	case n < 0:
+		return errWireBadVarint
+	case l > wireMaxStringSize:
+		return errWireString
+	}
+	i := handshakeFixedSize + n
+	if len(data) < i+int(l) {
+		return errHandshakeShort
+	}
+	h.ListenPort = string(data[i : i+int(l)])
+	return nil
+}
+
+// check returns an error if we can't talk to the peer that sent this handshake.
+func (h *Handshake) check() error {
+	switch {
+	case h.NodeID == NodeID:
+		return fmt.Errorf("loopback, the handshake has our own node ID")
+	case h.Network != CurrentNetwork:
+		return fmt.Errorf("peer is on network %#x, we are on %#x", h.Network, CurrentNetwork)
+	case h.Version < ProtocolVersionMinimum:
+		return fmt.Errorf("peer speaks version %d, we need at least %d", h.Version, ProtocolVersionMinimum)
+	}
+	return nil
+}
+
+// CapabilityString returns the capability flags as text, eg "full,archive"
+func CapabilityString(capabilities uint32) string {
+	var names []string
+	for _, c := range []struct {
+		flag uint32
+		name string
+	}{{CapabilityFullNode, "full"}, {CapabilityPruned, "pruned"}, {CapabilityArchive, "archive"}, {CapabilityCompression, "compression"}} {
+		if 0 != capabilities&c.flag {
+			names = append(names, c.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
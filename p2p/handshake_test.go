@@ -0,0 +1,63 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"testing"
+)
+
+func TestHandshakeRoundTrip(t *testing.T) {
+	h := Handshake{Version: ProtocolVersion, Network: TestNet, NodeID: 42, ListenPort: "8108", DBHeight: 12345, Capabilities: CapabilityFullNode | CapabilityArchive}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Handshake
+	if err := out.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if out != h {
+		t.Errorf("Handshake changed on the wire: %+v became %+v", h, out)
+	}
+	for i := 0; i < len(data); i++ {
+		if err := out.UnmarshalBinary(data[:i]); err == nil {
+			t.Errorf("Unmarshalled a handshake cut to %d of %d bytes", i, len(data))
+		}
+	}
+}
+
+func TestHandshakeCheck(t *testing.T) {
+	CurrentNetwork = TestNet
+	NodeID = 1
+	good := Handshake{Version: ProtocolVersion, Network: TestNet, NodeID: 2}
+	if err := good.check(); err != nil {
+		t.Errorf("Rejected a good handshake: %v", err)
+	}
+
+	bad := good
+	bad.Network = MainNet
+	if err := bad.check(); err == nil {
+		t.Errorf("Accepted a handshake from another network")
+	}
+	bad = good
+	bad.Version = ProtocolVersionMinimum - 1
+	if err := bad.check(); err == nil {
+		t.Errorf("Accepted a handshake with an old version")
+	}
+	bad = good
+	bad.NodeID = NodeID
+	if err := bad.check(); err == nil {
+		t.Errorf("Accepted a handshake from ourselves")
+	}
+}
+
+func TestCapabilityString(t *testing.T) {
+	if s := CapabilityString(CapabilityFullNode | CapabilityArchive); s != "full,archive" {
+		t.Errorf("Got %q", s)
+	}
+	if s := CapabilityString(0); s != "" {
+		t.Errorf("Got %q", s)
+	}
+}
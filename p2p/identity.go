@@ -0,0 +1,162 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Encrypted connections.
+//
+// When the network is started with encryption on, every connection is wrapped in TLS.  Each node has a
+// persistent identity key, kept in a PEM file, and presents a self signed certificate for it.  There is no
+// certificate authority; a peer is identified by the fingerprint of its public key (hex of the sha256 of the
+// PKIX encoding).  Special peers can be pinned to a fingerprint in the configuration, eg:
+//
+//	1.2.3.4:8108@3f8a...c2
+//
+// and a connection to or from that address is dropped if the peer presents any other key.
+
+// Identity is our persistent network identity.
+type Identity struct {
+	Key         *ecdsa.PrivateKey
+	Certificate tls.Certificate
+	Fingerprint string // Hex of the sha256 of our public key.  This is what peers pin.
+}
+
+// NetworkIdentity is set when connections are encrypted, and nil when they are plaintext.
+var NetworkIdentity *Identity
+
+// TLSHandshakeTimeout bounds how long we wait for a peer to finish the TLS handshake.
+var TLSHandshakeTimeout = time.Second * 10
+
+// LoadIdentity reads our identity key from path, creating a new key there if the file doesn't exist.
+func LoadIdentity(path string) (*Identity, error) {
+	var key *ecdsa.PrivateKey
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case nil == err:
+		block, _ := pem.Decode(data)
+		if nil == block || "EC PRIVATE KEY" != block.Type {
+			return nil, fmt.Errorf("%s does not hold an EC PRIVATE KEY", path)
+		}
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+		if nil != err {
+			return nil, err
+		}
+	case os.IsNotExist(err):
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if nil != err {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if nil != err {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		if err = ioutil.WriteFile(path, data, 0600); nil != err {
+			return nil, err
+		}
+		significant("ctrlr", "LoadIdentity() created a new network identity key in %s", path)
+	default:
+		return nil, err
+	}
+	return NewIdentity(key)
+}
+
+// NewIdentity builds an identity, with a self signed certificate, from a key.
+func NewIdentity(key *ecdsa.PrivateKey) (*Identity, error) {
+	fingerprint, err := KeyFingerprint(&key.PublicKey)
+	if nil != err {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if nil != err {
+		return nil, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: fingerprint},
+		NotBefore:    now.Add(-time.Hour * 24),
+		NotAfter:     now.Add(time.Hour * 24 * 365 * 10),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if nil != err {
+		return nil, err
+	}
+	id := new(Identity)
+	id.Key = key
+	id.Certificate = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	id.Fingerprint = fingerprint
+	return id, nil
+}
+
+// KeyFingerprint returns the hex of the sha256 of the PKIX encoding of a public key.
+func KeyFingerprint(publicKey interface{}) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if nil != err {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// tlsConfig returns the TLS configuration for our side of a connection.  We don't verify the certificate
+// chain since there isn't one; secureConnection checks the key fingerprint instead.
+func (id *Identity) tlsConfig() *tls.Config {
+	return &tls.Config{
+		Certificates:       []tls.Certificate{id.Certificate},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	}
+}
+
+// secureConnection runs the TLS handshake over conn as the client (if outgoing) or server, and returns the
+// encrypted connection along with the fingerprint of the key the peer presented.  If pinnedKey is set the
+// peer must present that key.
+func (id *Identity) secureConnection(conn net.Conn, outgoing bool, pinnedKey string) (*tls.Conn, string, error) {
+	var secure *tls.Conn
+	if outgoing {
+		secure = tls.Client(conn, id.tlsConfig())
+	} else {
+		secure = tls.Server(conn, id.tlsConfig())
+	}
+	secure.SetDeadline(time.Now().Add(TLSHandshakeTimeout))
+	if err := secure.Handshake(); nil != err {
+		return nil, "", err
+	}
+	secure.SetDeadline(time.Time{})
+	certificates := secure.ConnectionState().PeerCertificates
+	if 0 == len(certificates) {
+		return nil, "", fmt.Errorf("peer presented no certificate")
+	}
+	fingerprint, err := KeyFingerprint(certificates[0].PublicKey)
+	if nil != err {
+		return nil, "", err
+	}
+	if "" != pinnedKey && !strings.EqualFold(pinnedKey, fingerprint) {
+		return nil, "", fmt.Errorf("peer presented key %s, but is pinned to %s", fingerprint, pinnedKey)
+	}
+	return secure, fingerprint, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2pidentity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "PeerKey.pem")
+
+	created, err := LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Fingerprint != loaded.Fingerprint {
+		t.Errorf("Identity changed when reloaded: %s became %s", created.Fingerprint, loaded.Fingerprint)
+	}
+
+	ioutil.WriteFile(path, []byte("not a key"), 0600)
+	if _, err := LoadIdentity(path); err == nil {
+		t.Errorf("Loaded an identity from a file with no key in it")
+	}
+}
+
+func testIdentity(t *testing.T) *Identity {
+	dir, err := ioutil.TempDir("", "p2pidentity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	id, err := LoadIdentity(filepath.Join(dir, "PeerKey.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+type secureResult struct {
+	conn net.Conn
+	key  string
+	err  error
+}
+
+// handshake connects a client and server identity over a pipe, with the given pins.
+func handshake(client, server *Identity, clientPin, serverPin string) (secureResult, secureResult) {
+	a, b := net.Pipe()
+	done := make(chan secureResult)
+	go func() {
+		conn, key, err := server.secureConnection(b, false, serverPin)
+		if err != nil {
+			b.Close()
+		}
+		done <- secureResult{conn, key, err}
+	}()
+	conn, key, err := client.secureConnection(a, true, clientPin)
+	if err != nil {
+		a.Close()
+	}
+	return secureResult{conn, key, err}, <-done
+}
+
+func TestSecureConnection(t *testing.T) {
+	client, server := testIdentity(t), testIdentity(t)
+
+	c, s := handshake(client, server, server.Fingerprint, "")
+	if c.err != nil || s.err != nil {
+		t.Fatalf("Handshake failed: %v %v", c.err, s.err)
+	}
+	if c.key != server.Fingerprint || s.key != client.Fingerprint {
+		t.Errorf("Peers saw the wrong keys")
+	}
+	go c.conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := s.conn.Read(buf); err != nil || "hello" != string(buf) {
+		t.Errorf("Read %q, %v", buf, err)
+	}
+	c.conn.Close()
+	s.conn.Close()
+
+	c, _ = handshake(client, server, client.Fingerprint, "")
+	if c.err == nil {
+		t.Errorf("Connected to a peer pinned to another key")
+	}
+}
@@ -13,8 +13,9 @@ import (
 // Parcel is the atomic level of communication for the p2p network.  It contains within it the necessary info for
 // the networking protocol, plus the message that the Application is sending.
 type Parcel struct {
-	Header  ParcelHeader
-	Payload []byte
+	Header   ParcelHeader
+	Payload  []byte
+	priority uint8 // Not sent.  How the sending connection queues the parcel (see ratelimit.go)
 }
 
 // ParcelHeaderSize is the number of bytes in a parcel header
@@ -30,6 +31,7 @@ type ParcelHeader struct {
 	NodeID      uint64
 	PeerAddress string // address of the peer set by connection to know who sent message (for tracking source of other peers)
 	PeerPort    string // port of the peer , or we are listening on
+	Flags       uint16 // Flags about the payload (eg FlagCompressed)
 }
 
 type ParcelCommandType uint16
@@ -43,6 +45,7 @@ const ( // iota is reset to 0
 	TypePeerResponse                          // "Here's some peers I know about."
 	TypeAlert                                 // network wide alerts (used in bitcoin to indicate criticalities)
 	TypeMessage                               // Application level message
+	TypeHandshake                             // "Here's the version of the protocol I speak." Sent first on a new connection.
 )
 
 // CommandStrings is a Map of command ids to strings for easy printing of network comands
@@ -54,6 +57,7 @@ var CommandStrings = map[ParcelCommandType]string{
 	TypePeerResponse: "Peer Response", // "Here's some peers I know about."
 	TypeAlert:        "Alert",         // network wide alerts (used in bitcoin to indicate criticalities)
 	TypeMessage:      "Message",       // Application level message
+	TypeHandshake:    "Handshake",     // "Here's the version of the protocol I speak."
 }
 
 // MaxPayloadSize is the maximum bytes a message can be at the networking level.
@@ -80,6 +84,15 @@ func (p *Parcel) Init(header ParcelHeader) *Parcel {
 	return p
 }
 
+// SetPriority sets the priority the parcel is sent with, eg PriorityHigh for consensus messages.
+func (p *Parcel) SetPriority(priority uint8) {
+	p.priority = priority
+}
+
+func (p *Parcel) Priority() uint8 {
+	return p.priority
+}
+
 func (p *Parcel) UpdateHeader() {
 	p.Header.Crc32 = crc32.Checksum(p.Payload, CRCKoopmanTable)
 	p.Header.Length = uint32(len(p.Payload))
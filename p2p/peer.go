@@ -5,10 +5,12 @@
 package p2p
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
-	"strconv"
+	"net"
 	"strings"
 	"time"
 )
@@ -17,16 +19,21 @@ import (
 
 type Peer struct {
 	QualityScore int32     // 0 is neutral quality, negative is a bad peer.
-	Address      string    // Must be in form of x.x.x.x
+	Address      string    // IPv4 (x.x.x.x) or IPv6 address, without brackets.  See normalizeAddress.
 	Port         string    // Must be in form of xxxx
 	NodeID       uint64    // a nonce to distinguish multiple nodes behind one IP address
 	Hash         string    // This is more of a connection ID than hash right now.
-	Location     uint32    // IP address as an int.
+	Location     uint32    // IP address as an int (the first 32 bits for IPv6).
 	Network      NetworkID // The network this peer reference lives on.
 	Type         uint8
 	Connections  int                  // Number of successful connections.
 	LastContact  time.Time            // Keep track of how long ago we talked to the peer.
 	Source       map[string]time.Time // source where we heard from the peer.
+	PinnedKey    string               // Fingerprint of the key this peer must present on encrypted connections (set for special peers in config)
+	PublicKey    string               // Fingerprint of the key the peer presented on its last encrypted connection.
+	Version      uint16               // Protocol version from the peer's handshake
+	DBHeight     uint32               // Directory block height from the peer's handshake
+	Capabilities uint32               // Capability flags from the peer's handshake
 }
 
 const ( // iota is reset to 0
@@ -35,7 +42,7 @@ const ( // iota is reset to 0
 )
 
 func (p *Peer) Init(address string, port string, quality int32, peerType uint8, connections int) *Peer {
-	p.Address = address
+	p.Address = normalizeAddress(address)
 	p.Port = port
 	p.QualityScore = quality
 	p.generatePeerHash()
@@ -53,50 +60,75 @@ func (p *Peer) generatePeerHash() {
 	p.Hash = base64.URLEncoding.EncodeToString(raw[0:sha256.Size])
 }
 
+// AddressPort returns the address to dial, eg 10.0.0.1:8108 or [2001:db8::1]:8108
 func (p *Peer) AddressPort() string {
-	return p.Address + ":" + p.Port
+	return net.JoinHostPort(p.Address, p.Port)
 }
 
 func (p *Peer) PeerIdent() string {
-	return p.Hash[0:12] + "-" + p.Address + ":" + p.Port
+	return p.Hash[0:12] + "-" + p.AddressPort()
 }
 
 func (p *Peer) PeerFixedIdent() string {
-	address := fmt.Sprintf("%16s", p.Address)
-	return p.Hash[0:12] + "-" + address + ":" + p.Port
-}
-
-// BUGBUG Hadn't considered IPV6 addresses.
-// BUGBUG Need to audit all the net code to check IPv6 addresses
-// Here's an IPv6 conversion:
-// Ref: http://stackoverflow.com/questions/23297141/golang-net-ip-to-ipv6-from-mysql-as-decimal39-0-conversion
-// func ipv6ToInt(IPv6Addr net.IP) *big.Int {
-//     IPv6Int := big.NewInt(0)
-//     IPv6Int.SetBytes(IPv6Addr)
-//     return IPv6Int
-// }
-// Problem is we're working wiht string addresses, may never have made a connection.
-// BUGBUG - we might have a DNS address, not iP address and need to resolve it!
-// locationFromAddress converts the peers address into a uint32 "location" numeric
+	address := p.Address
+	if strings.Contains(address, ":") { // IPv6
+		address = "[" + address + "]"
+	}
+	return p.Hash[0:12] + "-" + fmt.Sprintf("%16s", address) + ":" + p.Port
+}
+
+// normalizeAddress puts an IP address in canonical form (net.IP.String()), without brackets, so that one
+// peer always has one Address whichever way it was written (eg 2001:db8::1 vs [2001:0db8:0::1]).  Anything
+// that isn't an IP address, like a host name from the seed, is returned as is.
+func normalizeAddress(address string) string {
+	address = strings.TrimSpace(address)
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	if ip := net.ParseIP(address); nil != ip {
+		return ip.String()
+	}
+	return address
+}
+
+// splitAddressPort splits an address and port (eg 10.0.0.1:8108 or [2001:db8::1]:8108), normalizing the address.
+func splitAddressPort(addressPort string) (string, string, error) {
+	host, port, err := net.SplitHostPort(strings.TrimSpace(addressPort))
+	if nil != err {
+		return "", "", err
+	}
+	return normalizeAddress(host), port, nil
+}
+
+// locationFromAddress converts the peers address into a uint32 "location" numeric.  For IPv4 it is the
+// address as an int, and for IPv6 the first 32 bits, which is about the size of a provider's allocation.
+// Host names have no location.  The Location is kept for the peers file and for peers that sort on it;
+// we sort on the whole address (see PeerDistanceSort).
 func (p *Peer) locationFromAddress() uint32 {
-	// Split out the port
-	ip_port := strings.Split(p.Address, ":")
-	// Split the IPv4 octets
-	octets := strings.Split(ip_port[0], ".")
-	// Turn into uint32
+	ip := net.ParseIP(p.Address)
+	if nil == ip {
+		verbose("peer", "Peer: %s with address: %s has no location", p.Hash, p.Address)
+		return 0
+	}
 	var location uint32
-	b0, _ := strconv.Atoi(octets[0])
-	b1, _ := strconv.Atoi(octets[1])
-	b2, _ := strconv.Atoi(octets[2])
-	b3, _ := strconv.Atoi(octets[3])
-	location += uint32(b0) << 24
-	location += uint32(b1) << 16
-	location += uint32(b2) << 8
-	location += uint32(b3)
-	verbose("peer", "Peer: %s with ip_port: %+v and octets: %+v has Location: %d", p.Hash, ip_port, octets, location)
+	if ipv4 := ip.To4(); nil != ipv4 {
+		location = binary.BigEndian.Uint32(ipv4)
+	} else {
+		location = binary.BigEndian.Uint32(ip.To16())
+	}
+	verbose("peer", "Peer: %s with address: %s has Location: %d", p.Hash, p.Address, location)
 	return location
 }
 
+// distanceKey is the peer's address as 16 bytes, for sorting peers by how close they are on the network.
+// IPv4 addresses are mapped into IPv6 (::ffff:x.x.x.x), so they sort together, ahead of the global IPv6
+// addresses.  Host names sort first.
+func (p *Peer) distanceKey() []byte {
+	ip := net.ParseIP(p.Address)
+	if nil == ip {
+		return nil
+	}
+	return ip.To16()
+}
+
 // merit increases a peers reputation
 func (p *Peer) merit() {
 	if 2147483000 > p.QualityScore {
@@ -134,5 +166,5 @@ func (p PeerDistanceSort) Swap(i, j int) {
 	p[i], p[j] = p[j], p[i]
 }
 func (p PeerDistanceSort) Less(i, j int) bool {
-	return p[i].Location < p[j].Location
+	return bytes.Compare(p[i].distanceKey(), p[j].distanceKey()) < 0
 }
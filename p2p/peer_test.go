@@ -0,0 +1,125 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"testing"
+)
+
+// testPeer makes a peer without a running controller, which normally seeds RandomGenerator.
+func testPeer(address string, port string) *Peer {
+	if nil == RandomGenerator {
+		RandomGenerator = rand.New(rand.NewSource(1))
+	}
+	return new(Peer).Init(address, port, 0, RegularPeer, 0)
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	for _, c := range []struct{ in, out string }{
+		{"10.0.0.1", "10.0.0.1"},
+		{" 10.0.0.1 ", "10.0.0.1"},
+		{"2001:0db8:0000::0001", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"::ffff:10.0.0.1", "10.0.0.1"},
+		{"seed.factom.com", "seed.factom.com"},
+	} {
+		if out := normalizeAddress(c.in); c.out != out {
+			t.Errorf("normalizeAddress(%q) = %q, expected %q", c.in, out, c.out)
+		}
+	}
+}
+
+func TestSplitAddressPort(t *testing.T) {
+	for _, c := range []struct{ in, address, port string }{
+		{"10.0.0.1:8108", "10.0.0.1", "8108"},
+		{"[2001:0db8::1]:8108", "2001:db8::1", "8108"},
+		{"[::1]:8108", "::1", "8108"},
+	} {
+		address, port, err := splitAddressPort(c.in)
+		if nil != err || c.address != address || c.port != port {
+			t.Errorf("splitAddressPort(%q) = %q %q %v", c.in, address, port, err)
+		}
+	}
+	if _, _, err := splitAddressPort("2001:db8::1"); nil == err {
+		t.Errorf("Split an IPv6 address without brackets or a port")
+	}
+}
+
+func TestPeerAddresses(t *testing.T) {
+	v4 := testPeer("10.1.2.3", "8108")
+	v6 := testPeer("2001:0db8::1", "8108")
+	if "10.1.2.3:8108" != v4.AddressPort() || "[2001:db8::1]:8108" != v6.AddressPort() {
+		t.Errorf("AddressPort() gave %s and %s", v4.AddressPort(), v6.AddressPort())
+	}
+	if 0x0a010203 != v4.Location || 0x20010db8 != v6.Location {
+		t.Errorf("Locations %x and %x", v4.Location, v6.Location)
+	}
+	host := testPeer("seed.factom.com", "8108")
+	if 0 != host.Location {
+		t.Errorf("Host name has location %x", host.Location)
+	}
+
+	peers := []Peer{*v6, *host, *v4, *testPeer("2001:db8::2", "8108")}
+	sort.Sort(PeerDistanceSort(peers))
+	for i, address := range []string{"seed.factom.com", "10.1.2.3", "2001:db8::1", "2001:db8::2"} {
+		if address != peers[i].Address {
+			t.Errorf("Sorted peer %d is %s, expected %s", i, peers[i].Address, address)
+		}
+	}
+}
+
+func TestFilterForUniqueIPv6Addresses(t *testing.T) {
+	d := new(Discovery)
+	peers := []Peer{
+		{Address: "2001:db8::1", Port: "8108"},
+		{Address: "2001:0db8:0::1", Port: "8109"},
+		{Address: "10.0.0.1", Port: "8108"},
+	}
+	if filtered := d.filterForUniqueIPAdresses(peers); 2 != len(filtered) {
+		t.Errorf("Expected 2 unique addresses, got %+v", filtered)
+	}
+}
+
+// TestDialLoopback dials listeners on the IPv4 and IPv6 loopback addresses the way connections do, and
+// checks the accepting side parses the remote address back to the peer's.
+func TestDialLoopback(t *testing.T) {
+	for _, loopback := range []string{"127.0.0.1", "::1"} {
+		listener, err := net.Listen("tcp", net.JoinHostPort(loopback, "0"))
+		if nil != err {
+			t.Logf("Skipping %s, can't listen: %v", loopback, err)
+			continue
+		}
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		peer := testPeer(loopback, port)
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if nil == err {
+				accepted <- conn
+			}
+			close(accepted)
+		}()
+		conn, err := net.Dial("tcp", peer.AddressPort())
+		if nil != err {
+			t.Errorf("Dialing %s: %v", peer.AddressPort(), err)
+			listener.Close()
+			continue
+		}
+		remote := <-accepted
+		if nil == remote {
+			t.Fatalf("Accept on %s failed", loopback)
+		}
+		address, _, err := splitAddressPort(remote.RemoteAddr().String())
+		if nil != err || peer.Address != address {
+			t.Errorf("Accepted %s from %s, expected %s", remote.RemoteAddr().String(), address, peer.Address)
+		}
+		remote.Close()
+		conn.Close()
+		listener.Close()
+	}
+}
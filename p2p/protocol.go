@@ -39,6 +39,8 @@ var (
 	NetworkListenPort                    = "8108"
 	NodeID                        uint64 = 0           // Random number used for loopback protection
 	MinumumQualityScore           int32  = -200        // if a peer's score is less than this we ignore them.
+	BanApplicationScore           int32  = -1000       // if the application's score for an address drops below this we ban it.
+	MaxApplicationScore           int32  = 200         // good behaviour only earns this much credit against later bad behaviour.
 	BannedQualityScore            int32  = -2147000000 // Used to ban a peer
 	MinumumSharingQualityScore    int32  = 20          // if a peer's score is less than this we don't share them.
 	OnlySpecialPeers                     = false
@@ -53,6 +55,10 @@ var (
 	PeerSaveInterval                     = time.Second * 30
 	PeerRequestInterval                  = time.Second * 180
 	PeerDiscoveryInterval                = time.Hour * 4
+	BanDuration                          = time.Hour * 24 // How long a ban lasts
+	CompressionThreshold                 = 1024           // Payloads larger than this are compressed, if the peer can take them
+	PeerSendRateLimit                    = 0              // Bytes per second we send to each peer.  0 is unlimited.
+	PeerReceiveRateLimit                 = 0              // Bytes per second we read from each peer.  0 is unlimited.
 
 	// Testing metrics
 	TotalMessagesRecieved       uint64
@@ -66,9 +72,12 @@ var (
 
 const (
 	// ProtocolVersion is the latest version this package supports
-	ProtocolVersion uint16 = 01
+	ProtocolVersion uint16 = 02
 	// ProtocolVersionMinimum is the earliest version this package supports
 	ProtocolVersionMinimum uint16 = 01
+	// ProtocolVersionBinary is the first version to speak the binary wire format (see wire.go).
+	// Connections where either side is older stay with gobs.
+	ProtocolVersionBinary uint16 = 02
 	// Don't think we need this.
 	// ProtocolCookie         uint32 = uint32([]bytes("Fact"))
 	// Used in generating message CRC values
@@ -0,0 +1,95 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"sync"
+	"time"
+)
+
+// Bandwidth shaping.
+//
+// Each connection has a send and a receive limit, and there is a send and a receive limit shared by all
+// connections.  The limits are token buckets in bytes per second, holding at most a second's worth.
+// A connection queues the parcels it is given by priority, and sends the high priority (consensus) parcels
+// ahead of everything else and regardless of the limits.  Normal and then bulk parcels go out as the limits
+// allow.  On the receive side a connection just stops reading while it is over a limit, and lets TCP push
+// back on the peer.
+
+// Parcel priorities.  The zero value is PriorityNormal.
+const (
+	PriorityNormal uint8 = iota // Anything not listed below
+	PriorityHigh                // Consensus messages (acks, EOMs, DBSigs).  Never held back by the limits.
+	PriorityBulk                // Catch up traffic (DBStates, data responses).  Sent when nothing else is waiting.
+)
+
+// sendOrder is the order in which a connection services its queues.
+var sendOrder = []uint8{PriorityHigh, PriorityNormal, PriorityBulk}
+
+// MaxSendQueue bounds each of a connection's priority queues.  Parcels beyond it are dropped.
+var MaxSendQueue = 5000
+
+// Global limits, shared by all the connections.  nil is unlimited.
+var (
+	globalSendLimiter    *rateLimiter
+	globalReceiveLimiter *rateLimiter
+)
+
+// rateLimiter is a token bucket.  A nil *rateLimiter never limits.
+type rateLimiter struct {
+	sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for bytesPerSecond, or nil if bytesPerSecond is 0 (unlimited).
+func newRateLimiter(bytesPerSecond int) *rateLimiter {
+	if 0 >= bytesPerSecond {
+		return nil
+	}
+	r := new(rateLimiter)
+	r.rate = float64(bytesPerSecond)
+	r.tokens = r.rate
+	r.last = time.Now()
+	return r
+}
+
+func (r *rateLimiter) refill() {
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.rate {
+		r.tokens = r.rate
+	}
+	r.last = now
+}
+
+// available returns true if the limiter isn't in debt.
+func (r *rateLimiter) available() bool {
+	if nil == r {
+		return true
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.refill()
+	return 0 < r.tokens
+}
+
+// spend takes bytes from the bucket.  It can go into debt, which is paid back before available() is true again.
+func (r *rateLimiter) spend(bytes uint32) {
+	if nil == r {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.refill()
+	r.tokens -= float64(bytes)
+}
+
+// SetBandwidthLimits sets the global send and receive limits, in bytes per second.  0 is unlimited.
+func SetBandwidthLimits(sendRate, receiveRate int) {
+	globalSendLimiter = newRateLimiter(sendRate)
+	globalReceiveLimiter = newRateLimiter(receiveRate)
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var unlimited *rateLimiter
+	unlimited.spend(1 << 30)
+	if !unlimited.available() || nil != newRateLimiter(0) {
+		t.Errorf("A nil limiter limited")
+	}
+
+	r := newRateLimiter(1000)
+	if !r.available() {
+		t.Errorf("A new limiter should start with a second's worth")
+	}
+	r.spend(1500)
+	if r.available() {
+		t.Errorf("Limiter in debt still available")
+	}
+	r.last = r.last.Add(-time.Second) // Pretend a second has passed.
+	if !r.available() {
+		t.Errorf("Limiter did not refill")
+	}
+	r.last = r.last.Add(-time.Hour)
+	r.refill()
+	if r.tokens > r.rate {
+		t.Errorf("Limiter holds %f, more than a second's worth", r.tokens)
+	}
+}
+
+func TestSendPriorities(t *testing.T) {
+	RandomGenerator = rand.New(rand.NewSource(4))
+	ours, theirs := net.Pipe()
+	defer ours.Close()
+	defer theirs.Close()
+
+	c := new(Connection)
+	c.commonInit(*new(Peer).Init("10.0.0.1", "8108", 0, RegularPeer, 0))
+	c.conn = ours
+	c.encoder = newBinaryEncoder(ours)
+	c.state = ConnectionOnline
+	c.handshakeDone = true
+	c.sendLimiter = newRateLimiter(100)
+	c.sendLimiter.spend(1000) // Over the limit, so only high priority goes out.
+
+	for _, priority := range []uint8{PriorityBulk, PriorityNormal, PriorityHigh} {
+		parcel := testParcel([]byte{priority})
+		parcel.SetPriority(priority)
+		c.queueParcel(*parcel)
+	}
+
+	received := make(chan Parcel, 3)
+	go func() {
+		decoder := newBinaryDecoder(theirs)
+		for {
+			var parcel Parcel
+			if err := decoder.Decode(&parcel); err != nil {
+				return
+			}
+			received <- parcel
+		}
+	}()
+
+	c.sendQueued()
+	if p := <-received; PriorityHigh != p.Payload[0] {
+		t.Errorf("First parcel out was priority %d", p.Payload[0])
+	}
+	if 2 != len(c.sendQueues[PriorityNormal])+len(c.sendQueues[PriorityBulk]) {
+		t.Errorf("Sent parcels while over the limit")
+	}
+
+	c.sendLimiter = nil
+	c.sendQueued()
+	for _, want := range []uint8{PriorityNormal, PriorityBulk} {
+		if p := <-received; want != p.Payload[0] {
+			t.Errorf("Got priority %d, wanted %d", p.Payload[0], want)
+		}
+	}
+
+	MaxSendQueue = 1
+	defer func() { MaxSendQueue = 5000 }()
+	c.queueParcel(*testParcel([]byte("one")))
+	c.queueParcel(*testParcel([]byte("two")))
+	if 1 != c.metrics.DroppedParcels {
+		t.Errorf("Dropped %d parcels, wanted 1", c.metrics.DroppedParcels)
+	}
+}
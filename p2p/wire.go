@@ -0,0 +1,198 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// This file contains the binary wire format for parcels.  Peers that both speak
+// ProtocolVersionBinary or later switch to it after the handshake.  Older peers
+// keep using gobs.
+//
+// A frame on the wire is:
+//
+//	[4] Network
+//	[2] Version
+//	[2] Type
+//	[4] Length of the payload
+//	[4] Crc32 of the payload
+//	[8] NodeID
+//	[2] Flags
+//	[varint + bytes] TargetPeer
+//	[varint + bytes] PeerAddress
+//	[varint + bytes] PeerPort
+//	[Length] Payload
+//
+// All integers are big endian.
+
+// wireFixedHeaderSize is the size of the fixed part of a frame's header.
+const wireFixedHeaderSize = 26
+
+// wireMaxStringSize bounds the strings in a frame's header, so a bad frame
+// can't make us allocate much.
+const wireMaxStringSize = 1024
+
+var (
+	errWireShort     = errors.New("p2p: incomplete frame")
+	errWireString    = errors.New("p2p: frame header string too long")
+	errWirePayload   = errors.New("p2p: frame payload larger than MaxPayloadSize")
+	errWireBadVarint = errors.New("p2p: bad varint in frame header")
+)
+
+// parcelEncoder and parcelDecoder are the parts of gob.Encoder and
+// gob.Decoder we use, so the binary format can stand in for them.
+type parcelEncoder interface {
+	Encode(e interface{}) error
+}
+
+type parcelDecoder interface {
+	Decode(e interface{}) error
+}
+
+// MarshalParcel returns the binary frame for a parcel.
+func MarshalParcel(parcel *Parcel) ([]byte, error) {
+	h := parcel.Header
+	if len(parcel.Payload) > MaxPayloadSize {
+		return nil, errWirePayload
+	}
+	for _, s := range []string{h.TargetPeer, h.PeerAddress, h.PeerPort} {
+		if len(s) > wireMaxStringSize {
+			return nil, errWireString
+		}
+	}
+	size := wireFixedHeaderSize + 3*binary.MaxVarintLen64 + len(h.TargetPeer) + len(h.PeerAddress) + len(h.PeerPort) + len(parcel.Payload)
+	buf := make([]byte, size)
+
+	binary.BigEndian.PutUint32(buf[0:], uint32(h.Network))
+	binary.BigEndian.PutUint16(buf[4:], h.Version)
+	binary.BigEndian.PutUint16(buf[6:], uint16(h.Type))
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(parcel.Payload)))
+	binary.BigEndian.PutUint32(buf[12:], h.Crc32)
+	binary.BigEndian.PutUint64(buf[16:], h.NodeID)
+	binary.BigEndian.PutUint16(buf[24:], h.Flags)
+	i := wireFixedHeaderSize
+	for _, s := range []string{h.TargetPeer, h.PeerAddress, h.PeerPort} {
+		i += binary.PutUvarint(buf[i:], uint64(len(s)))
+		i += copy(buf[i:], s)
+	}
+	i += copy(buf[i:], parcel.Payload)
+	return buf[:i], nil
+}
+
+// UnmarshalParcel decodes one frame from the front of data.  It returns the
+// number of bytes used.  If data doesn't hold a whole frame yet, it returns
+// errWireShort; any other error means the stream can't be trusted.
+func UnmarshalParcel(data []byte, parcel *Parcel) (int, error) {
+	if len(data) < wireFixedHeaderSize {
+		return 0, errWireShort
+	}
+	var h ParcelHeader
+	h.Network = NetworkID(binary.BigEndian.Uint32(data[0:]))
+	h.Version = binary.BigEndian.Uint16(data[4:])
+	h.Type = ParcelCommandType(binary.BigEndian.Uint16(data[6:]))
+	h.Length = binary.BigEndian.Uint32(data[8:])
+	h.Crc32 = binary.BigEndian.Uint32(data[12:])
+	h.NodeID = binary.BigEndian.Uint64(data[16:])
+	h.Flags = binary.BigEndian.Uint16(data[24:])
+	if h.Length > MaxPayloadSize {
+		return 0, errWirePayload
+	}
+
+	i := wireFixedHeaderSize
+	var strs [3]string
+	for j := range strs {
+		l, n := binary.Uvarint(data[i:])
+		switch {
+		case n == 0:
+			return 0, errWireShort
+		case n < 0:
+			return 0, errWireBadVarint
+		case l > wireMaxStringSize:
+			return 0, errWireString
+		}
+		i += n
+		if len(data) < i+int(l) {
+			return 0, errWireShort
+		}
+		strs[j] = string(data[i : i+int(l)])
+		i += int(l)
+	}
+	h.TargetPeer, h.PeerAddress, h.PeerPort = strs[0], strs[1], strs[2]
+
+	if len(data) < i+int(h.Length) {
+		return 0, errWireShort
+	}
+	parcel.Header = h
+	parcel.Payload = append([]byte(nil), data[i:i+int(h.Length)]...)
+	return i + int(h.Length), nil
+}
+
+// binaryEncoder writes parcels as binary frames.
+type binaryEncoder struct {
+	w io.Writer
+}
+
+func newBinaryEncoder(w io.Writer) *binaryEncoder {
+	return &binaryEncoder{w: w}
+}
+
+func (e *binaryEncoder) Encode(v interface{}) error {
+	var parcel *Parcel
+	switch p := v.(type) {
+	case Parcel:
+		parcel = &p
+	case *Parcel:
+		parcel = p
+	default:
+		return errors.New("p2p: binaryEncoder can only encode parcels")
+	}
+	data, err := MarshalParcel(parcel)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+// binaryDecoder reads binary frames.  It keeps any partial frame between
+// calls, so a read deadline expiring mid frame doesn't lose our place in the
+// stream.
+type binaryDecoder struct {
+	r   io.Reader
+	buf []byte
+}
+
+func newBinaryDecoder(r io.Reader) *binaryDecoder {
+	return &binaryDecoder{r: r}
+}
+
+func (d *binaryDecoder) Decode(v interface{}) error {
+	parcel, ok := v.(*Parcel)
+	if !ok {
+		return errors.New("p2p: binaryDecoder can only decode into a *Parcel")
+	}
+	chunk := make([]byte, 4096)
+	var readErr error
+	for {
+		n, err := UnmarshalParcel(d.buf, parcel)
+		switch err {
+		case nil:
+			d.buf = append(d.buf[:0], d.buf[n:]...)
+			return nil
+		case errWireShort:
+			if readErr != nil { // Whatever we read is kept for the next call.
+				return readErr
+			}
+		default:
+			return err
+		}
+		var read int
+		read, readErr = d.r.Read(chunk)
+		d.buf = append(d.buf, chunk[:read]...)
+	}
+}
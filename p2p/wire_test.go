@@ -0,0 +1,213 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func testParcel(payload []byte) *Parcel {
+	parcel := NewParcel(TestNet, payload)
+	parcel.Header.NodeID = 0x0123456789abcdef
+	parcel.Header.TargetPeer = "target"
+	parcel.Header.PeerAddress = "10.0.0.1"
+	parcel.Header.PeerPort = "8108"
+	return parcel
+}
+
+func sameParcel(a, b *Parcel) bool {
+	return a.Header == b.Header && bytes.Equal(a.Payload, b.Payload)
+}
+
+func TestWireRoundTrip(t *testing.T) {
+	for _, payload := range [][]byte{nil, []byte("Ping"), bytes.Repeat([]byte{0xAB}, MaxPayloadSize)} {
+		parcel := testParcel(payload)
+		data, err := MarshalParcel(parcel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Trailing bytes belong to the next frame.
+		data = append(data, 1, 2, 3)
+
+		var out Parcel
+		n, err := UnmarshalParcel(data, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(data)-3 {
+			t.Errorf("Used %d bytes of a %d byte frame", n, len(data)-3)
+		}
+		if !sameParcel(parcel, &out) {
+			t.Errorf("Parcel changed on the wire: %+v became %+v", parcel.Header, out.Header)
+		}
+	}
+
+	parcel := testParcel(make([]byte, MaxPayloadSize+1))
+	if _, err := MarshalParcel(parcel); err == nil {
+		t.Errorf("Marshalled a payload over MaxPayloadSize")
+	}
+}
+
+func TestWireShortFrames(t *testing.T) {
+	data, _ := MarshalParcel(testParcel([]byte("some payload")))
+	for i := 0; i < len(data); i++ {
+		var out Parcel
+		if _, err := UnmarshalParcel(data[:i], &out); err != errWireShort {
+			t.Errorf("Frame cut to %d of %d bytes gave %v", i, len(data), err)
+		}
+	}
+}
+
+func TestWireBadFrames(t *testing.T) {
+	data, _ := MarshalParcel(testParcel([]byte("some payload")))
+
+	big := append([]byte(nil), data...)
+	big[8], big[9], big[10], big[11] = 0xFF, 0xFF, 0xFF, 0xFF
+	var out Parcel
+	if _, err := UnmarshalParcel(big, &out); err != errWirePayload {
+		t.Errorf("Oversized payload length gave %v", err)
+	}
+
+	long := append([]byte(nil), data[:wireFixedHeaderSize]...)
+	long = append(long, 0xFF, 0xFF, 0x03) // a string of 65535 bytes
+	if _, err := UnmarshalParcel(long, &out); err != errWireString {
+		t.Errorf("Oversized header string gave %v", err)
+	}
+
+	varint := append([]byte(nil), data[:wireFixedHeaderSize]...)
+	varint = append(varint, bytes.Repeat([]byte{0xFF}, 11)...)
+	if _, err := UnmarshalParcel(varint, &out); err != errWireBadVarint {
+		t.Errorf("Overflowing varint gave %v", err)
+	}
+}
+
+// Throw random and mutated frames at the decoder.  It must never panic, never
+// claim more bytes than it was given, and any parcel it accepts must survive a
+// round trip.
+func TestWireFuzz(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	valid, _ := MarshalParcel(testParcel([]byte("fuzzing the wire format")))
+
+	for i := 0; i < 20000; i++ {
+		var data []byte
+		switch i % 3 {
+		case 0: // Random bytes
+			data = make([]byte, r.Intn(128))
+			r.Read(data)
+		case 1: // A valid frame with some bytes flipped
+			data = append([]byte(nil), valid...)
+			for j := r.Intn(4) + 1; j > 0; j-- {
+				data[r.Intn(len(data))] = byte(r.Intn(256))
+			}
+		case 2: // A valid frame cut short or padded
+			data = append([]byte(nil), valid[:r.Intn(len(valid))]...)
+			pad := make([]byte, r.Intn(16))
+			r.Read(pad)
+			data = append(data, pad...)
+		}
+
+		var out Parcel
+		n, err := UnmarshalParcel(data, &out)
+		if err != nil {
+			continue
+		}
+		if n > len(data) {
+			t.Fatalf("Used %d bytes of %d: %x", n, len(data), data)
+		}
+		again, err := MarshalParcel(&out)
+		if err != nil {
+			t.Fatalf("Could not marshal a parcel we unmarshalled: %v %x", err, data)
+		}
+		var back Parcel
+		if _, err := UnmarshalParcel(again, &back); err != nil || !sameParcel(&out, &back) {
+			t.Fatalf("Parcel changed in a round trip: %x became %x", data[:n], again)
+		}
+	}
+}
+
+var errTimeout = errors.New("timeout")
+
+// trickleReader hands out a few bytes at a time, with an error between each.
+type trickleReader struct {
+	data []byte
+	r    *rand.Rand
+	hang bool
+}
+
+func (t *trickleReader) Read(p []byte) (int, error) {
+	if t.hang = !t.hang; t.hang {
+		return 0, errTimeout
+	}
+	if len(t.data) == 0 {
+		return 0, errTimeout
+	}
+	n := t.r.Intn(7) + 1
+	if n > len(t.data) {
+		n = len(t.data)
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	copy(p, t.data[:n])
+	t.data = t.data[n:]
+	return n, errTimeout
+}
+
+func TestBinaryDecoderResumes(t *testing.T) {
+	var stream []byte
+	var sent []*Parcel
+	for i := 0; i < 20; i++ {
+		parcel := testParcel(bytes.Repeat([]byte{byte(i)}, i*13))
+		data, _ := MarshalParcel(parcel)
+		stream = append(stream, data...)
+		sent = append(sent, parcel)
+	}
+
+	decoder := newBinaryDecoder(&trickleReader{data: stream, r: rand.New(rand.NewSource(2))})
+	for i := 0; i < len(sent); {
+		var out Parcel
+		err := decoder.Decode(&out)
+		switch err {
+		case nil:
+			if !sameParcel(sent[i], &out) {
+				t.Fatalf("Parcel %d changed on the wire", i)
+			}
+			i++
+		case errTimeout:
+		default:
+			t.Fatalf("Parcel %d: %v", i, err)
+		}
+	}
+}
+
+// The handshake is sent in gobs, and the binary frames follow on the same
+// stream.  The gob decoder must not read past its message.
+func TestGobThenBinary(t *testing.T) {
+	var stream bytes.Buffer
+	handshake := testParcel([]byte("Handshake"))
+	handshake.Header.Type = TypeHandshake
+	if err := gob.NewEncoder(&stream).Encode(*handshake); err != nil {
+		t.Fatal(err)
+	}
+	message := testParcel([]byte("After the handshake"))
+	if err := newBinaryEncoder(&stream).Encode(*message); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(&stream)
+	var out Parcel
+	if err := gob.NewDecoder(reader).Decode(&out); err != nil || !sameParcel(handshake, &out) {
+		t.Fatalf("Handshake did not decode: %v", err)
+	}
+	out = Parcel{}
+	if err := newBinaryDecoder(reader).Decode(&out); err != nil || !sameParcel(message, &out) {
+		t.Fatalf("Binary parcel after the handshake did not decode: %v", err)
+	}
+}
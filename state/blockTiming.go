@@ -0,0 +1,145 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+var _ = fmt.Print
+
+// The number of blocks of timing history we keep.
+const BlockTimingHistory = 144
+
+// Returns the timing record for the given height, creating it if this is a
+// new block.  Returns nil for blocks that have fallen out of the history.
+// Callers must hold the blockTimingMutex.
+func (s *State) blockTiming(dbheight uint32) *interfaces.BlockTiming {
+	for i := len(s.BlockTimings) - 1; i >= 0; i-- {
+		if s.BlockTimings[i].DBHeight == dbheight {
+			return s.BlockTimings[i]
+		}
+		if s.BlockTimings[i].DBHeight < dbheight {
+			break
+		}
+	}
+	if len(s.BlockTimings) > 0 && s.BlockTimings[len(s.BlockTimings)-1].DBHeight > dbheight {
+		return nil
+	}
+
+	// A new block.  Close out the counts on the last one.
+	s.closeBlockTiming()
+
+	b := new(interfaces.BlockTiming)
+	b.DBHeight = dbheight
+	b.Start = primitives.GetClock().Now().UnixNano() / 1e6
+	s.BlockTimings = append(s.BlockTimings, b)
+	if len(s.BlockTimings) > BlockTimingHistory {
+		s.BlockTimings = s.BlockTimings[len(s.BlockTimings)-BlockTimingHistory:]
+	}
+	return b
+}
+
+func (s *State) closeBlockTiming() {
+	if len(s.BlockTimings) > 0 {
+		last := s.BlockTimings[len(s.BlockTimings)-1]
+		last.MissingCnt = s.MissingCnt - s.timingMissingCnt
+		last.ResendCnt = s.ResendCnt - s.timingResendCnt
+		last.ExpireCnt = s.ExpireCnt - s.timingExpireCnt
+	}
+	s.timingMissingCnt = s.MissingCnt
+	s.timingResendCnt = s.ResendCnt
+	s.timingExpireCnt = s.ExpireCnt
+}
+
+func sinceStart(b *interfaces.BlockTiming) int64 {
+	t := primitives.GetClock().Now().UnixNano()/1e6 - b.Start
+	if t == 0 {
+		t = 1 // Zero means it hasn't happened
+	}
+	return t
+}
+
+// TimeEOM records when the EOM for the given minute and VM was processed.
+func (s *State) TimeEOM(dbheight uint32, minute int, vmIndex int) {
+	if minute < 0 || minute > 9 || vmIndex < 0 {
+		return
+	}
+	s.blockTimingMutex.Lock()
+	defer s.blockTimingMutex.Unlock()
+
+	b := s.blockTiming(dbheight)
+	if b == nil {
+		return
+	}
+	m := &b.Minutes[minute]
+	for len(m.EOMs) <= vmIndex {
+		m.EOMs = append(m.EOMs, 0)
+	}
+	if m.EOMs[vmIndex] == 0 {
+		m.EOMs[vmIndex] = sinceStart(b)
+	}
+}
+
+// TimeDBSigs records when all the DBSigs for the given block were processed.
+func (s *State) TimeDBSigs(dbheight uint32) {
+	s.blockTimingMutex.Lock()
+	defer s.blockTimingMutex.Unlock()
+
+	b := s.blockTiming(dbheight)
+	if b != nil && b.DBSigs == 0 {
+		b.DBSigs = sinceStart(b)
+	}
+}
+
+// TimeProcess adds to the time spent processing the given block's process list.
+func (s *State) TimeProcess(dbheight uint32, minute int, d time.Duration) {
+	if minute < 0 || minute > 9 {
+		return
+	}
+	s.blockTimingMutex.Lock()
+	defer s.blockTimingMutex.Unlock()
+
+	if b := s.blockTiming(dbheight); b != nil {
+		b.Minutes[minute].ProcessMicro += int64(d / time.Microsecond)
+	}
+}
+
+// TimeSave records the time it took to save the given block.
+func (s *State) TimeSave(dbheight uint32, d time.Duration) {
+	s.blockTimingMutex.Lock()
+	defer s.blockTimingMutex.Unlock()
+
+	if b := s.blockTiming(dbheight); b != nil {
+		b.SaveMicro += int64(d / time.Microsecond)
+	}
+}
+
+// GetBlockTimings returns copies of the timing records of up to count of the
+// most recent blocks, oldest first.  A count <= 0 returns all we have.
+func (s *State) GetBlockTimings(count int) []interfaces.BlockTiming {
+	s.blockTimingMutex.Lock()
+	defer s.blockTimingMutex.Unlock()
+
+	start := 0
+	if count > 0 && count < len(s.BlockTimings) {
+		start = len(s.BlockTimings) - count
+	}
+	timings := make([]interfaces.BlockTiming, 0, len(s.BlockTimings)-start)
+	for _, b := range s.BlockTimings[start:] {
+		timings = append(timings, b.Copy())
+	}
+	// The counts on the current block are still running.
+	if n := len(timings); n > 0 && start+n == len(s.BlockTimings) {
+		timings[n-1].MissingCnt = s.MissingCnt - s.timingMissingCnt
+		timings[n-1].ResendCnt = s.ResendCnt - s.timingResendCnt
+		timings[n-1].ExpireCnt = s.ExpireCnt - s.timingExpireCnt
+	}
+	return timings
+}
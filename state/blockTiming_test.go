@@ -0,0 +1,68 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/factomd/state"
+	"github.com/FactomProject/factomd/testHelper"
+)
+
+func TestBlockTiming(t *testing.T) {
+	s := testHelper.CreateEmptyTestState()
+	s.BlockTimings = nil
+
+	s.TimeProcess(10, 0, 2*time.Millisecond)
+	s.TimeProcess(10, 0, 3*time.Millisecond)
+	s.TimeEOM(10, 0, 2)
+	s.MissingCnt += 3
+	s.ResendCnt += 2
+	s.TimeDBSigs(10)
+	s.TimeSave(10, time.Millisecond)
+
+	timings := s.GetBlockTimings(0)
+	if len(timings) != 1 {
+		t.Fatalf("Expected 1 block of timings, got %d", len(timings))
+	}
+	b := timings[0]
+	if b.DBHeight != 10 || b.Minutes[0].ProcessMicro != 5000 || b.SaveMicro != 1000 || b.DBSigs == 0 {
+		t.Errorf("Timings recorded incorrectly - %v", b)
+	}
+	if len(b.Minutes[0].EOMs) != 3 || b.Minutes[0].EOMs[2] == 0 || b.Minutes[0].EOMs[0] != 0 {
+		t.Errorf("EOM times recorded incorrectly - %v", b.Minutes[0].EOMs)
+	}
+	if b.MissingCnt != 3 || b.ResendCnt != 2 || b.ExpireCnt != 0 {
+		t.Errorf("Counts recorded incorrectly - %v", b)
+	}
+
+	// Moving to a new block closes out the counts on the last.
+	s.TimeProcess(11, 0, time.Millisecond)
+	s.MissingCnt++
+	timings = s.GetBlockTimings(0)
+	if len(timings) != 2 || timings[0].MissingCnt != 3 || timings[1].MissingCnt != 1 {
+		t.Errorf("Counts not split between blocks - %v", timings)
+	}
+
+	// Copies are returned, not the records themselves.
+	timings[1].Minutes[0].ProcessMicro = 0
+	if s.GetBlockTimings(1)[0].Minutes[0].ProcessMicro == 0 {
+		t.Errorf("GetBlockTimings returned the records rather than copies")
+	}
+
+	// Blocks older than the history are ignored, and the history is limited.
+	for i := uint32(12); i < 12+BlockTimingHistory; i++ {
+		s.TimeSave(i, time.Millisecond)
+	}
+	s.TimeSave(10, time.Millisecond)
+	timings = s.GetBlockTimings(0)
+	if len(timings) != BlockTimingHistory || timings[0].DBHeight != 12 {
+		t.Errorf("History not limited to %d blocks - %d blocks from %d", BlockTimingHistory, len(timings), timings[0].DBHeight)
+	}
+	if len(s.GetBlockTimings(5)) != 5 {
+		t.Errorf("Did not limit the count of blocks returned")
+	}
+}
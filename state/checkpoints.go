@@ -0,0 +1,151 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+var _ = fmt.Print
+
+// Checkpoints are Directory Blocks we know to be good.  Any DBState that
+// conflicts with a checkpoint is refused, which protects a syncing node from
+// long range forks.  The lists are "height:KeyMR" pairs separated by commas,
+// the same format used for the checkpoints in the config file.
+//
+// The built in lists are empty on purpose, so out of the box nothing is
+// enforced on any network.  A wrong KeyMR here would stop every node on that
+// network from syncing past it, so entries are only to be added from a
+// KeyMR checked against the network, and until then checkpoints come from the
+// MainCheckpoints, TestCheckpoints and LocalCheckpoints config settings.
+var MainNetCheckpoints = ""
+var TestNetCheckpoints = ""
+var LocalNetCheckpoints = ""
+
+type Checkpoint struct {
+	DBHeight uint32
+	KeyMR    interfaces.IHash
+}
+
+// ParseCheckpoints parses a list of checkpoints of the form
+// "height:KeyMR,height:KeyMR".  Spaces are ignored.
+func ParseCheckpoints(list string) ([]Checkpoint, error) {
+	var checkpoints []Checkpoint
+	for _, cp := range strings.Split(list, ",") {
+		cp = strings.TrimSpace(cp)
+		if len(cp) == 0 {
+			continue
+		}
+		parts := strings.Split(cp, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Checkpoint %q is not of the form height:KeyMR", cp)
+		}
+		height, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Checkpoint %q has a bad height: %v", cp, err)
+		}
+		keymr, err := primitives.HexToHash(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("Checkpoint %q has a bad KeyMR: %v", cp, err)
+		}
+		checkpoints = append(checkpoints, Checkpoint{uint32(height), keymr})
+	}
+	return checkpoints, nil
+}
+
+// AddCheckpoints adds the given list of checkpoints.  A checkpoint that
+// disagrees with one we already have is an error.
+func (s *State) AddCheckpoints(list string) error {
+	checkpoints, err := ParseCheckpoints(list)
+	if err != nil {
+		return err
+	}
+	if s.Checkpoints == nil {
+		s.Checkpoints = make(map[uint32]interfaces.IHash)
+	}
+	for _, cp := range checkpoints {
+		if old, ok := s.Checkpoints[cp.DBHeight]; ok && !old.IsSameAs(cp.KeyMR) {
+			return fmt.Errorf("Conflicting checkpoints at height %d: %s and %s", cp.DBHeight, old.String(), cp.KeyMR.String())
+		}
+		s.Checkpoints[cp.DBHeight] = cp.KeyMR
+		if cp.DBHeight > s.HighestCheckpoint {
+			s.HighestCheckpoint = cp.DBHeight
+		}
+	}
+	return nil
+}
+
+// Load the built in checkpoints for our network, and add any from the config file.
+func (s *State) initCheckpoints() {
+	s.Checkpoints = make(map[uint32]interfaces.IHash)
+	s.HighestCheckpoint = 0
+
+	var builtin, configured string
+	switch s.Network {
+	case "MAIN":
+		builtin, configured = MainNetCheckpoints, s.MainCheckpoints
+	case "TEST":
+		builtin, configured = TestNetCheckpoints, s.TestCheckpoints
+	case "LOCAL":
+		builtin, configured = LocalNetCheckpoints, s.LocalCheckpoints
+	}
+	if err := s.AddCheckpoints(builtin); err != nil {
+		panic("Bad built in checkpoints: " + err.Error())
+	}
+	if err := s.AddCheckpoints(configured); err != nil {
+		panic("Bad checkpoints in factomd.conf: " + err.Error())
+	}
+}
+
+// ConflictsWithCheckpoint returns true if we have a checkpoint at the height
+// of the given Directory Block, and the KeyMR does not match.
+func (s *State) ConflictsWithCheckpoint(dblock interfaces.IDirectoryBlock) bool {
+	keymr, ok := s.Checkpoints[dblock.GetHeader().GetDBHeight()]
+	if !ok {
+		return false
+	}
+	return !keymr.IsSameAs(dblock.GetKeyMR())
+}
+
+// IsBelowCheckpoint returns true if the given height is at or below our
+// highest checkpoint.
+func (s *State) IsBelowCheckpoint(dbheight uint32) bool {
+	return len(s.Checkpoints) > 0 && dbheight <= s.HighestCheckpoint
+}
+
+// IsLinkedToCheckpoint returns true if the given Directory Block's KeyMR is
+// known good: it is a checkpoint, or the PrevKeyMR of a block already found
+// linked.  The block it links to is then taken as linked in turn.  As blocks
+// usually arrive in order, ahead of the blocks that link to them, most blocks
+// below a checkpoint are not yet linked when they arrive.
+func (s *State) IsLinkedToCheckpoint(dblock interfaces.IDirectoryBlock) bool {
+	dbheight := dblock.GetHeader().GetDBHeight()
+	if !s.IsBelowCheckpoint(dbheight) {
+		return false
+	}
+	keymr := dblock.GetKeyMR()
+
+	s.checkpointMutex.Lock()
+	defer s.checkpointMutex.Unlock()
+	linked, ok := s.Checkpoints[dbheight]
+	if !ok {
+		linked, ok = s.checkpointLinks[dbheight]
+	}
+	if !ok || !linked.IsSameAs(keymr) {
+		return false
+	}
+	if dbheight > 0 {
+		if s.checkpointLinks == nil {
+			s.checkpointLinks = make(map[uint32]interfaces.IHash)
+		}
+		s.checkpointLinks[dbheight-1] = dblock.GetHeader().GetPrevKeyMR()
+	}
+	return true
+}
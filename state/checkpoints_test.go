@@ -0,0 +1,102 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/factomd/common/directoryBlock"
+	"github.com/FactomProject/factomd/common/primitives"
+	. "github.com/FactomProject/factomd/state"
+	"github.com/FactomProject/factomd/testHelper"
+)
+
+func TestParseCheckpoints(t *testing.T) {
+	keymr := "836ba9715fc4e83ae1e8755c40374e7e2265e4f312788710af2ff5478c2b495e"
+
+	cps, err := ParseCheckpoints("")
+	if err != nil || len(cps) != 0 {
+		t.Errorf("Expected no checkpoints from an empty list, got %v %v", cps, err)
+	}
+
+	cps, err = ParseCheckpoints("9:" + keymr + ", 20 : " + keymr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(cps) != 2 || cps[0].DBHeight != 9 || cps[1].DBHeight != 20 || cps[0].KeyMR.String() != keymr {
+		t.Errorf("Checkpoints parsed incorrectly - %v", cps)
+	}
+
+	bad := []string{"9", "x:" + keymr, "9:xyz", "9:" + keymr + ":1"}
+	for _, b := range bad {
+		if _, err := ParseCheckpoints(b); err == nil {
+			t.Errorf("Expected an error parsing %q", b)
+		}
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	state := testHelper.CreateAndPopulateTestState()
+	d := state.GetDirectoryBlockByHeight(9)
+	keymr := d.GetKeyMR().String()
+	other := "0000000000000000000000000000000000000000000000000000000000000001"
+
+	if state.ConflictsWithCheckpoint(d) || state.IsBelowCheckpoint(9) {
+		t.Errorf("No checkpoints were set, but got a conflict or a checkpoint")
+	}
+
+	if err := state.AddCheckpoints("9:" + keymr); err != nil {
+		t.Errorf("%v", err)
+	}
+	if state.ConflictsWithCheckpoint(d) {
+		t.Errorf("Directory Block matching the checkpoint reported as a conflict")
+	}
+	if !state.IsBelowCheckpoint(5) || !state.IsBelowCheckpoint(9) || state.IsBelowCheckpoint(10) {
+		t.Errorf("IsBelowCheckpoint is wrong about the heights around the checkpoint at 9")
+	}
+
+	if err := state.AddCheckpoints("9:" + other); err == nil {
+		t.Errorf("Expected an error adding a checkpoint that conflicts with another")
+	}
+
+	state.Checkpoints[9] = testHelper.CreateTestDirectoryBlock(nil).GetKeyMR()
+	if !state.ConflictsWithCheckpoint(d) {
+		t.Errorf("Directory Block not matching the checkpoint was not reported as a conflict")
+	}
+}
+
+func TestIsLinkedToCheckpoint(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	var chain []*directoryBlock.DirectoryBlock
+	var prev *directoryBlock.DirectoryBlock
+	for i := 0; i < 5; i++ {
+		prev = testHelper.CreateTestDirectoryBlock(prev)
+		chain = append(chain, prev)
+	}
+	// A block at 2 that links to the real block at 1, but is not the one 3 links to.
+	forged := testHelper.CreateTestDirectoryBlock(chain[1])
+	forged.GetHeader().SetTimestamp(primitives.NewTimestampFromMinutes(1))
+
+	if err := state.AddCheckpoints("3:" + chain[3].GetKeyMR().String()); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if state.IsLinkedToCheckpoint(chain[2]) {
+		t.Errorf("Block 2 linked before the checkpoint block was seen")
+	}
+	if state.IsLinkedToCheckpoint(chain[4]) {
+		t.Errorf("Block 4, above the checkpoint, linked")
+	}
+	if !state.IsLinkedToCheckpoint(chain[3]) {
+		t.Errorf("The checkpoint block is not linked")
+	}
+	if state.IsLinkedToCheckpoint(forged) {
+		t.Errorf("A forged block 2 linked")
+	}
+	for i := 2; i >= 0; i-- {
+		if !state.IsLinkedToCheckpoint(chain[i]) {
+			t.Errorf("Block %d not linked down from the checkpoint", i)
+		}
+	}
+}
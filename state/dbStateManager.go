@@ -336,6 +336,13 @@ func (list *DBStateList) ProcessBlocks(d *DBState) (progress bool) {
 		return
 	}
 
+	// Refuse any block that conflicts with our checkpoints.  Dropping it lets
+	// Catchup() ask for the block again.
+	if !list.AgreesWithCheckpoints(d) {
+		list.Drop(d)
+		return
+	}
+
 	list.LastTime = nil // If I saved or processed stuff, I'm good for a while
 
 	// Any updates required to the state as established by the AdminBlock are applied here.
@@ -350,6 +357,8 @@ func (list *DBStateList) ProcessBlocks(d *DBState) (progress bool) {
 	// Promote the currently scheduled next FER
 	list.State.ProcessRecentFERChainEntries()
 
+	list.State.recordFingerprint(d)
+
 	// Step my counter of Complete blocks
 	i := d.DirectoryBlock.GetHeader().GetDBHeight() - list.Base
 	if uint32(i) > list.Complete {
@@ -361,6 +370,42 @@ func (list *DBStateList) ProcessBlocks(d *DBState) (progress bool) {
 	return
 }
 
+// AgreesWithCheckpoints returns false if the given DBState conflicts with a
+// checkpoint.  Below the highest checkpoint we also insist that each block
+// links to the one before it.  That alone does not tie a block to the
+// checkpoint, as a forged chain can link to itself, so signatures are only
+// skipped on blocks IsLinkedToCheckpoint has traced down from one.
+func (list *DBStateList) AgreesWithCheckpoints(d *DBState) bool {
+	s := list.State
+	dbheight := d.DirectoryBlock.GetHeader().GetDBHeight()
+	if s.ConflictsWithCheckpoint(d.DirectoryBlock) {
+		fmt.Printf("%s Refusing DBState at height %d. KeyMR %s conflicts with checkpoint %s\n",
+			s.FactomNodeName, dbheight, d.DirectoryBlock.GetKeyMR().String(), s.Checkpoints[dbheight].String())
+		return false
+	}
+	if dbheight > 0 && s.IsBelowCheckpoint(dbheight) {
+		p := list.Get(int(dbheight) - 1)
+		if p != nil && p.DirectoryBlock != nil &&
+			!d.DirectoryBlock.GetHeader().GetPrevKeyMR().IsSameAs(p.DirectoryBlock.GetKeyMR()) {
+			fmt.Printf("%s Refusing DBState at height %d. It does not link to the block before it\n",
+				s.FactomNodeName, dbheight)
+			return false
+		}
+	}
+	return true
+}
+
+// Drop removes the given DBState from the list, if it has not been processed.
+func (list *DBStateList) Drop(d *DBState) {
+	if d.Locked {
+		return
+	}
+	i := int(d.DirectoryBlock.GetHeader().GetDBHeight()) - int(list.Base)
+	if i >= 0 && i < len(list.DBStates) && list.DBStates[i] == d {
+		list.DBStates[i] = nil
+	}
+}
+
 func (list *DBStateList) SaveDBStateToDB(d *DBState) (progress bool) {
 
 	if !d.Locked || !d.ReadyToSave {
@@ -378,6 +423,7 @@ func (list *DBStateList) SaveDBStateToDB(d *DBState) (progress bool) {
 		return
 	}
 
+	start := time.Now()
 	head, _ := list.State.DB.FetchDirectoryBlockHead()
 
 	// Take the height, and some function of the identity chain, and use that to decide to trim.  That
@@ -427,6 +473,8 @@ func (list *DBStateList) SaveDBStateToDB(d *DBState) (progress bool) {
 		list.State.DB.SaveDirectoryBlockHead(head)
 	}
 
+	list.State.TimeSave(d.DirectoryBlock.GetHeader().GetDBHeight(), time.Since(start))
+
 	progress = true
 	d.ReadyToSave = false
 	d.Saved = true
@@ -455,6 +503,11 @@ func (list *DBStateList) UpdateState() (progress bool) {
 		}
 		progress = list.ProcessBlocks(d) || progress
 
+		// If ProcessBlocks refused this block, we must wait for a good one.
+		if list.DBStates[i] == nil {
+			return
+		}
+
 		progress = list.SaveDBStateToDB(d) || progress
 
 		// Make sure we move forward the Adminblock state in the process lists
@@ -0,0 +1,222 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/FactomProject/factomd/common/entryCreditBlock"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+var _ = fmt.Print
+
+// How many DBStates may be waiting on the workers at once.  When the window
+// is full, the ValidatorLoop checks the DBState itself.
+const DBStateWindow = 100
+
+// DBStateValidator runs the checks on a DBState that do not depend on our
+// state (signatures and merkle roots) with a pool of workers.  DBStates from
+// the network pass through here ahead of being applied in order by the
+// ValidatorLoop, so catch-up is not limited to one core.
+type DBStateValidator struct {
+	State   *State
+	Workers int
+	work    chan *messages.DBStateMsg
+
+	// Statistics.  Updated atomically by the workers.
+	Checked int64 // DBStates fully checked
+	Skipped int64 // DBStates linked back from a checkpoint, where signatures were not checked
+	Invalid int64 // DBStates that failed a check
+	Inline  int64 // DBStates checked by the ValidatorLoop because the window was full
+	Nanos   int64 // Time spent checking
+}
+
+func NewDBStateValidator(s *State, workers int) *DBStateValidator {
+	v := new(DBStateValidator)
+	v.State = s
+	v.Workers = workers
+	v.work = make(chan *messages.DBStateMsg, DBStateWindow)
+	for i := 0; i < workers; i++ {
+		go v.worker()
+	}
+	return v
+}
+
+func (v *DBStateValidator) worker() {
+	for msg := range v.work {
+		v.check(msg)
+	}
+}
+
+// Submit hands the DBState to the workers.  Returns false if the window is full.
+func (v *DBStateValidator) Submit(msg *messages.DBStateMsg) bool {
+	select {
+	case v.work <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check the DBState, and pass it on to the follower if it is good.  Bad
+// DBStates go to the invalid queue, so the peer that sent it can be demerited.
+func (v *DBStateValidator) check(msg *messages.DBStateMsg) {
+	clock := primitives.GetClock()
+	start := clock.Now()
+	skipSigs := v.State.canSkipSigs(msg)
+	err := CheckDBState(msg, skipSigs)
+	atomic.AddInt64(&v.Nanos, clock.Now().Sub(start).Nanoseconds())
+
+	if err != nil {
+		atomic.AddInt64(&v.Invalid, 1)
+		fmt.Println(v.State.FactomNodeName, "Invalid DBState:", err.Error())
+		v.State.networkInvalidMsgQueue <- msg
+		return
+	}
+	if skipSigs {
+		atomic.AddInt64(&v.Skipped, 1)
+	}
+	atomic.AddInt64(&v.Checked, 1)
+	v.State.msgQueue <- msg
+}
+
+// Count returns the number of DBStates checked so far.  Safe on a nil validator.
+func (v *DBStateValidator) Count() int64 {
+	if v == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&v.Checked) + atomic.LoadInt64(&v.Invalid)
+}
+
+// AvgCheck returns the average time spent checking a DBState.  Safe on a nil validator.
+func (v *DBStateValidator) AvgCheck() time.Duration {
+	n := v.Count()
+	if n == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&v.Nanos) / n)
+}
+
+// Pending returns the number of DBStates waiting on the workers.  Safe on a nil validator.
+func (v *DBStateValidator) Pending() int {
+	if v == nil {
+		return 0
+	}
+	return len(v.work)
+}
+
+func (v *DBStateValidator) String() string {
+	checked := atomic.LoadInt64(&v.Checked)
+	avg := v.AvgCheck()
+	return fmt.Sprintf("Workers %d Checked %d (sigs skipped %d, inline %d) Invalid %d Avg %s",
+		v.Workers, checked, atomic.LoadInt64(&v.Skipped), atomic.LoadInt64(&v.Inline),
+		atomic.LoadInt64(&v.Invalid), avg.String())
+}
+
+// queueDBState routes a DBState from the network through the checks before
+// it gets to the follower.  If we have no workers, or they are backed up, we
+// do the checks right here.
+func (s *State) queueDBState(msg *messages.DBStateMsg) {
+	if s.DBStateValidator == nil {
+		if err := CheckDBState(msg, s.canSkipSigs(msg)); err != nil {
+			fmt.Println(s.FactomNodeName, "Invalid DBState:", err.Error())
+			s.networkInvalidMsgQueue <- msg
+			return
+		}
+		s.msgQueue <- msg
+		return
+	}
+	if !s.DBStateValidator.Submit(msg) {
+		atomic.AddInt64(&s.DBStateValidator.Inline, 1)
+		s.DBStateValidator.check(msg)
+	}
+}
+
+// canSkipSigs returns true if the signatures in the DBState need no checking.
+// That is so when the Directory Block is linked back from a checkpoint, and
+// the admin, Entry Credit and factoid blocks are the ones it lists.  Any other
+// block, even below a checkpoint, could be forged, and is checked in full.
+func (s *State) canSkipSigs(msg *messages.DBStateMsg) bool {
+	if msg.DirectoryBlock == nil || msg.AdminBlock == nil || msg.FactoidBlock == nil || msg.EntryCreditBlock == nil {
+		return false
+	}
+	entries := msg.DirectoryBlock.GetDBEntries()
+	if len(entries) < 3 ||
+		!entries[0].GetKeyMR().IsSameAs(msg.AdminBlock.DatabasePrimaryIndex()) ||
+		!entries[1].GetKeyMR().IsSameAs(msg.EntryCreditBlock.DatabasePrimaryIndex()) ||
+		!entries[2].GetKeyMR().IsSameAs(msg.FactoidBlock.DatabasePrimaryIndex()) {
+		return false
+	}
+	return s.IsLinkedToCheckpoint(msg.DirectoryBlock)
+}
+
+// CheckDBState does the checks on a DBState that need nothing from our state:
+// the Directory Block body merkle root, and (unless skipSigs is set) the
+// signatures on factoid transactions and Entry Credit commits.  The entries
+// themselves are not part of a DBState, so they are checked as they arrive.
+func CheckDBState(msg *messages.DBStateMsg, skipSigs bool) error {
+	if msg.DirectoryBlock == nil || msg.AdminBlock == nil || msg.FactoidBlock == nil || msg.EntryCreditBlock == nil {
+		return fmt.Errorf("DBState is missing a block")
+	}
+
+	dbheight := msg.DirectoryBlock.GetHeader().GetDBHeight()
+
+	bodyMR, err := dbBodyMR(msg.DirectoryBlock)
+	if err != nil {
+		return err
+	}
+	if !bodyMR.IsSameAs(msg.DirectoryBlock.GetHeader().GetBodyMR()) {
+		return fmt.Errorf("Directory Block %d body MR %s does not match the header %s",
+			dbheight, bodyMR.String(), msg.DirectoryBlock.GetHeader().GetBodyMR().String())
+	}
+
+	if skipSigs {
+		return nil
+	}
+
+	for i, tx := range msg.FactoidBlock.GetTransactions() {
+		if err := tx.ValidateSignatures(); err != nil {
+			return fmt.Errorf("Factoid transaction %d in block %d: %s", i, dbheight, err.Error())
+		}
+	}
+
+	for i, entry := range msg.EntryCreditBlock.GetBody().GetEntries() {
+		switch e := entry.(type) {
+		case *entryCreditBlock.CommitChain:
+			if err := e.ValidateSignatures(); err != nil {
+				return fmt.Errorf("Commit Chain %d in Entry Credit block %d: %s", i, dbheight, err.Error())
+			}
+		case *entryCreditBlock.CommitEntry:
+			if err := e.ValidateSignatures(); err != nil {
+				return fmt.Errorf("Commit Entry %d in Entry Credit block %d: %s", i, dbheight, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// Compute the body merkle root of a Directory Block.  Unlike BuildBodyMR(),
+// this leaves the header alone.
+func dbBodyMR(dblock interfaces.IDirectoryBlock) (interfaces.IHash, error) {
+	entries := dblock.GetDBEntries()
+	hashes := make([]interfaces.IHash, len(entries))
+	for i, entry := range entries {
+		data, err := entry.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = primitives.Sha(data)
+	}
+	if len(hashes) == 0 {
+		hashes = append(hashes, primitives.Sha(nil))
+	}
+	merkleTree := primitives.BuildMerkleTreeStore(hashes)
+	return merkleTree[len(merkleTree)-1], nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/factomd/common/messages"
+	. "github.com/FactomProject/factomd/state"
+	"github.com/FactomProject/factomd/testHelper"
+)
+
+func TestCheckDBState(t *testing.T) {
+	msgs := testHelper.CreateTestDBStateList()
+	for i, m := range msgs {
+		msg := m.(*messages.DBStateMsg)
+		if err := CheckDBState(msg, false); err != nil {
+			t.Errorf("DBState %d failed its checks - %v", i, err)
+		}
+	}
+
+	msg := msgs[len(msgs)-1].(*messages.DBStateMsg)
+	msg.DirectoryBlock.GetHeader().SetBodyMR(testHelper.NewRepeatingHash(0x55))
+	if err := CheckDBState(msg, false); err == nil {
+		t.Errorf("DBState with a bad body MR passed its checks")
+	}
+	if err := CheckDBState(msg, true); err == nil {
+		t.Errorf("DBState with a bad body MR passed its checks below a checkpoint")
+	}
+
+	msg.EntryCreditBlock = nil
+	if err := CheckDBState(msg, false); err == nil {
+		t.Errorf("DBState missing a block passed its checks")
+	}
+}
+
+func TestDBStateValidator(t *testing.T) {
+	s := testHelper.CreateEmptyTestState()
+	v := NewDBStateValidator(s, 2)
+	if v.Count() != 0 || v.Pending() != 0 {
+		t.Errorf("New validator should be idle - %s", v.String())
+	}
+
+	var none *DBStateValidator
+	if none.Count() != 0 || none.Pending() != 0 || none.AvgCheck() != 0 {
+		t.Errorf("A nil validator should report nothing")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// Fingerprints of the blocks a node processes, so the nodes of a simulation can be compared height by
+// height, to catch them the moment they disagree.  Only kept if Fingerprinting is set, as hashing every
+// balance at every block isn't free.
+
+// The number of blocks of fingerprints we keep.
+const FingerprintHistory = 1000
+
+// The number of messages we keep of those the node last executed.
+const RecentMsgHistory = 10
+
+// BlockFingerprint is what a node made of a block, and where it left the node.
+type BlockFingerprint struct {
+	DBHeight    uint32
+	DBKeyMR     interfaces.IHash
+	ABHash      interfaces.IHash
+	Balances    interfaces.IHash // Every factoid and entry credit balance after the block
+	Authorities interfaces.IHash // The authority set after the block
+	Recent      []string         // The messages the node executed last before the block was done, oldest first
+}
+
+// recordFingerprint takes the fingerprint of a block just processed.
+func (s *State) recordFingerprint(d *DBState) {
+	if !s.Fingerprinting {
+		return
+	}
+	f := new(BlockFingerprint)
+	f.DBHeight = d.DirectoryBlock.GetHeader().GetDBHeight()
+	f.DBKeyMR = d.DirectoryBlock.GetKeyMR()
+	f.ABHash = d.AdminBlock.GetHash()
+	f.Balances = s.balancesHash()
+	f.Authorities = s.authoritiesHash()
+
+	s.fingerprintMutex.Lock()
+	defer s.fingerprintMutex.Unlock()
+	f.Recent = append([]string(nil), s.recentMsgs...)
+	for len(s.fingerprints) > 0 && s.fingerprints[len(s.fingerprints)-1].DBHeight >= f.DBHeight {
+		// Processing the block again, or one before it (eg after reloading), so what follows is out of date.
+		s.fingerprints = s.fingerprints[:len(s.fingerprints)-1]
+	}
+	s.fingerprints = append(s.fingerprints, f)
+	if len(s.fingerprints) > FingerprintHistory {
+		s.fingerprints = s.fingerprints[len(s.fingerprints)-FingerprintHistory:]
+	}
+}
+
+// GetFingerprint returns the fingerprint of the block at the given height, or nil if the node hasn't processed
+// it, or it has fallen out of the history.
+func (s *State) GetFingerprint(dbheight uint32) *BlockFingerprint {
+	s.fingerprintMutex.Lock()
+	defer s.fingerprintMutex.Unlock()
+	for i := len(s.fingerprints) - 1; i >= 0; i-- {
+		if s.fingerprints[i].DBHeight == dbheight {
+			return s.fingerprints[i]
+		}
+		if s.fingerprints[i].DBHeight < dbheight {
+			break
+		}
+	}
+	return nil
+}
+
+// GetFingerprintHeight returns the height of the highest block fingerprinted, and false if there is none.
+func (s *State) GetFingerprintHeight() (uint32, bool) {
+	s.fingerprintMutex.Lock()
+	defer s.fingerprintMutex.Unlock()
+	if 0 == len(s.fingerprints) {
+		return 0, false
+	}
+	return s.fingerprints[len(s.fingerprints)-1].DBHeight, true
+}
+
+// noteExecuted keeps the message among the last the node executed.
+func (s *State) noteExecuted(msg interfaces.IMsg) {
+	if !s.Fingerprinting {
+		return
+	}
+	s.fingerprintMutex.Lock()
+	defer s.fingerprintMutex.Unlock()
+	s.recentMsgs = append(s.recentMsgs, msg.String())
+	if len(s.recentMsgs) > RecentMsgHistory {
+		s.recentMsgs = s.recentMsgs[len(s.recentMsgs)-RecentMsgHistory:]
+	}
+}
+
+// balancesHash hashes every permanent factoid and entry credit balance, in address order.
+func (s *State) balancesHash() interfaces.IHash {
+	var buf bytes.Buffer
+	write := func(prefix byte, balances map[[32]byte]int64) {
+		addresses := make([]string, 0, len(balances))
+		for adr := range balances {
+			addresses = append(addresses, string(adr[:]))
+		}
+		sort.Strings(addresses)
+		for _, adr := range addresses {
+			var key [32]byte
+			copy(key[:], adr)
+			buf.WriteByte(prefix)
+			buf.WriteString(adr)
+			binary.Write(&buf, binary.BigEndian, balances[key])
+		}
+	}
+	s.FactoidBalancesPMutex.Lock()
+	write('F', s.FactoidBalancesP)
+	s.FactoidBalancesPMutex.Unlock()
+	s.ECBalancesPMutex.Lock()
+	write('E', s.ECBalancesP)
+	s.ECBalancesPMutex.Unlock()
+	return primitives.Sha(buf.Bytes())
+}
+
+// authoritiesHash hashes the authority set: each authority's identity, status and signing key, in identity
+// order.
+func (s *State) authoritiesHash() interfaces.IHash {
+	byID := make(map[string]Authority)
+	ids := make([]string, 0, len(s.Authorities))
+	for _, a := range s.Authorities {
+		if nil == a.AuthorityChainID {
+			continue
+		}
+		id := string(a.AuthorityChainID.Bytes())
+		byID[id] = a
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var buf bytes.Buffer
+	for _, id := range ids {
+		a := byID[id]
+		buf.WriteString(id)
+		binary.Write(&buf, binary.BigEndian, int32(a.Status))
+		buf.Write(a.SigningKey[:])
+	}
+	return primitives.Sha(buf.Bytes())
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/factomd/state"
+	"github.com/FactomProject/factomd/testHelper"
+)
+
+func fingerprintedTestState() *State {
+	s := new(State)
+	s.DB = testHelper.CreateAndPopulateTestDatabaseOverlay()
+	s.LoadConfig("", "")
+	s.Init()
+	s.Fingerprinting = true
+	s.SetFactoshisPerEC(1)
+	go s.ValidatorLoop()
+	LoadDatabase(s)
+	for i := 0; i < 200; i++ {
+		if high, _ := s.GetFingerprintHeight(); testHelper.BlockCount-1 <= int(high) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s
+}
+
+func TestFingerprints(t *testing.T) {
+	s1 := fingerprintedTestState()
+	s2 := fingerprintedTestState()
+
+	high, ok := s1.GetFingerprintHeight()
+	if !ok || testHelper.BlockCount-1 != int(high) {
+		t.Fatalf("Fingerprinted up to %d %v, expected %d", high, ok, testHelper.BlockCount-1)
+	}
+	for h := uint32(0); h <= high; h++ {
+		f1, f2 := s1.GetFingerprint(h), s2.GetFingerprint(h)
+		if nil == f1 || nil == f2 {
+			t.Fatalf("No fingerprint at height %d", h)
+		}
+		dblock, _ := s1.DB.FetchDBlockByHeight(h)
+		if !f1.DBKeyMR.IsSameAs(dblock.GetKeyMR()) {
+			t.Errorf("Height %d fingerprinted with the KeyMR %s, expected %s", h, f1.DBKeyMR, dblock.GetKeyMR())
+		}
+		if !f1.ABHash.IsSameAs(f2.ABHash) || !f1.Balances.IsSameAs(f2.Balances) || !f1.Authorities.IsSameAs(f2.Authorities) {
+			t.Errorf("Two nodes loading the same blocks differ at height %d: %+v %+v", h, f1, f2)
+		}
+	}
+	if nil != s1.GetFingerprint(high+1) {
+		t.Errorf("A fingerprint for a block not yet processed")
+	}
+
+	// Without Fingerprinting, nothing is kept.
+	s3 := testHelper.CreateEmptyTestState()
+	if _, ok := s3.GetFingerprintHeight(); ok {
+		t.Errorf("Fingerprints were kept without Fingerprinting")
+	}
+}
@@ -0,0 +1,402 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+)
+
+// The journal records every message a node takes in, so a run can be replayed.  It is binary: a header, then
+// for each message its length (a uvarint) followed by
+//
+//	8 bytes   when the message was received, in milliseconds
+//	4 bytes   the directory block the node was building
+//	uvarint   length, then the peer the message came from (empty if it came from this node)
+//	uvarint   length, then the name of the node
+//	          the marshaled message
+//
+// Once a file passes the size limit, the journal goes on in another: journal0.jnl, journal0.jnl.1,
+// journal0.jnl.2 and so on.  journal0.jnl.idx indexes where each directory block starts, for seeking.
+
+// JournalMagic starts every journal file.
+const JournalMagic = "FJNL\x01"
+
+// DefaultJournalMaxSize is the size a journal file grows to before the journal goes on in the next.
+const DefaultJournalMaxSize = 64 * 1024 * 1024
+
+// MaxJournalRecordSize bounds a record, so a corrupt length read from a journal is caught rather than
+// allocated.  No message comes near it; those off the network are at most half a megabyte.
+const MaxJournalRecordSize = 16 * 1024 * 1024
+
+var errJournalCorrupt = errors.New("journal record is corrupt")
+
+type JournalRecord struct {
+	Received int64  // Milliseconds
+	Height   uint32 // The directory block the node was building
+	Origin   string // The peer the message came from; empty if it came from this node
+	Node     string
+	Msg      []byte // The marshaled message
+}
+
+func (r *JournalRecord) MarshalBinary() ([]byte, error) {
+	var body bytes.Buffer
+	var scratch [binary.MaxVarintLen64]byte
+	binary.Write(&body, binary.BigEndian, r.Received)
+	binary.Write(&body, binary.BigEndian, r.Height)
+	for _, s := range []string{r.Origin, r.Node} {
+		body.Write(scratch[:binary.PutUvarint(scratch[:], uint64(len(s)))])
+		body.WriteString(s)
+	}
+	body.Write(r.Msg)
+	if body.Len() > MaxJournalRecordSize {
+		return nil, fmt.Errorf("journal record of %d bytes is over the limit of %d", body.Len(), MaxJournalRecordSize)
+	}
+
+	out := make([]byte, 0, binary.MaxVarintLen64+body.Len())
+	out = append(out, scratch[:binary.PutUvarint(scratch[:], uint64(body.Len()))]...)
+	return append(out, body.Bytes()...), nil
+}
+
+// Message unmarshals the message the record holds.
+func (r *JournalRecord) Message() (interfaces.IMsg, error) {
+	return messages.UnmarshalMessage(r.Msg)
+}
+
+// ReadJournalRecord reads the next record of a binary journal.  It returns io.EOF at the end.
+func ReadJournalRecord(in *bufio.Reader) (*JournalRecord, error) {
+	size, err := binary.ReadUvarint(in)
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxJournalRecordSize {
+		return nil, errJournalCorrupt
+	}
+	// Read what is there, rather than allocating all the length promises, in case the file is cut short.
+	body, err := ioutil.ReadAll(io.LimitReader(in, int64(size)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(body)) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if len(body) < 12 {
+		return nil, errors.New("journal record too short")
+	}
+	r := new(JournalRecord)
+	r.Received = int64(binary.BigEndian.Uint64(body))
+	r.Height = binary.BigEndian.Uint32(body[8:])
+	rest := body[12:]
+	for _, s := range []*string{&r.Origin, &r.Node} {
+		n, used := binary.Uvarint(rest)
+		if used <= 0 || uint64(len(rest)-used) < n {
+			return nil, errJournalCorrupt
+		}
+		*s = string(rest[used : used+int(n)])
+		rest = rest[used+int(n):]
+	}
+	r.Msg = rest
+	return r, nil
+}
+
+// ReadTextJournalRecord reads the next message from a journal in the old text format, where each message
+// is on a line starting MsgHex:.  Only the message is known, so the received time is the message's
+// timestamp, and the height is the highest the messages read so far have been for.  It returns io.EOF at
+// the end.
+func ReadTextJournalRecord(in *bufio.Reader, height *uint32) (*JournalRecord, error) {
+	for {
+		line, err := in.ReadBytes('\n')
+		if 0 == len(line) {
+			if err == nil {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		// Get the next word.  If not MsgHex:, then go to next line.
+		adv, word, _ := bufio.ScanWords(line, true)
+		if string(word) != "MsgHex:" {
+			continue
+		}
+		_, data, _ := bufio.ScanWords(line[adv:], true)
+		raw, err := hex.DecodeString(string(data))
+		if err != nil {
+			return nil, err
+		}
+		msg, err := messages.UnmarshalMessage(raw)
+		if err != nil {
+			return nil, err
+		}
+		var msgHeight uint32
+		switch m := msg.(type) {
+		case *messages.EOM:
+			msgHeight = m.DBHeight
+		case *messages.Ack:
+			msgHeight = m.DBHeight
+		case *messages.DirectoryBlockSignature:
+			msgHeight = m.DBHeight
+		}
+		if msgHeight > *height {
+			*height = msgHeight
+		}
+		r := &JournalRecord{Height: *height, Origin: msg.GetNetworkOrigin(), Msg: raw}
+		if ts := msg.GetTimestamp(); nil != ts {
+			r.Received = ts.GetTimeMilli()
+		}
+		return r, nil
+	}
+}
+
+// JournalSegment returns the name of the nth file of a journal.
+func JournalSegment(path string, n int) string {
+	if 0 == n {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// JournalIndexEntry is where a directory block starts in a journal.
+type JournalIndexEntry struct {
+	Height  uint32
+	Segment uint32
+	Offset  int64
+}
+
+// Journal writes a binary journal.
+type Journal struct {
+	path    string
+	maxSize int64
+	segment int
+	file    *os.File
+	size    int64
+	index   *os.File
+	height  uint32
+	indexed bool
+}
+
+// CreateJournal starts a journal at path, replacing any there.  maxSize limits the size of each file; 0 is
+// no limit.
+func CreateJournal(path string, maxSize int64) (*Journal, error) {
+	j := &Journal{path: path, maxSize: maxSize}
+	index, err := os.Create(path + ".idx")
+	if err != nil {
+		return nil, err
+	}
+	j.index = index
+	// Clear away the files of an earlier journal, so they aren't read as part of this one.
+	for n := 1; ; n++ {
+		if err := os.Remove(JournalSegment(path, n)); err != nil {
+			break
+		}
+	}
+	if err := j.open(); err != nil {
+		index.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) open() error {
+	file, err := os.Create(JournalSegment(j.path, j.segment))
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(JournalMagic); err != nil {
+		file.Close()
+		return err
+	}
+	j.file = file
+	j.size = int64(len(JournalMagic))
+	return nil
+}
+
+// Write adds a record to the journal.
+func (j *Journal) Write(r *JournalRecord) error {
+	data, err := r.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if 0 < j.maxSize && j.size+int64(len(data)) > j.maxSize && int64(len(JournalMagic)) < j.size {
+		if err := j.file.Close(); err != nil {
+			return err
+		}
+		j.segment++
+		if err := j.open(); err != nil {
+			return err
+		}
+	}
+	if !j.indexed || r.Height != j.height {
+		entry := JournalIndexEntry{r.Height, uint32(j.segment), j.size}
+		if err := binary.Write(j.index, binary.BigEndian, entry); err != nil {
+			return err
+		}
+		j.height = r.Height
+		j.indexed = true
+	}
+	n, err := j.file.Write(data)
+	j.size += int64(n)
+	return err
+}
+
+// Sync writes the journal to disk.
+func (j *Journal) Sync() error {
+	if err := j.index.Sync(); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *Journal) Close() error {
+	j.index.Close()
+	return j.file.Close()
+}
+
+// ReadJournalIndex reads the index of the journal at path.
+func ReadJournalIndex(path string) ([]JournalIndexEntry, error) {
+	f, err := os.Open(path + ".idx")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	in := bufio.NewReader(f)
+	var entries []JournalIndexEntry
+	for {
+		var entry JournalIndexEntry
+		if err := binary.Read(in, binary.BigEndian, &entry); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// JournalReader reads a journal, binary or text.  Opened on a path, it goes on through the journal's files.
+type JournalReader struct {
+	path    string // Empty if reading a stream
+	segment int
+	file    *os.File
+	in      *bufio.Reader
+	text    bool
+	height  uint32 // Of a text journal
+}
+
+// NewJournalReader reads a journal from a stream, working out if it is binary or text.
+func NewJournalReader(in *bufio.Reader) (*JournalReader, error) {
+	j := &JournalReader{in: in}
+	magic, err := in.Peek(len(JournalMagic))
+	if err != nil || string(magic) != JournalMagic {
+		j.text = true
+		return j, nil
+	}
+	in.Discard(len(JournalMagic))
+	return j, nil
+}
+
+// OpenJournalReader reads the journal at path from the start.
+func OpenJournalReader(path string) (*JournalReader, error) {
+	return openJournalReader(path, 0, 0)
+}
+
+// SeekJournal reads the journal at path from the start of the first directory block at or after height.
+func SeekJournal(path string, height uint32) (*JournalReader, error) {
+	entries, err := ReadJournalIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Height >= height })
+	if i == len(entries) {
+		return nil, fmt.Errorf("the journal %s doesn't reach height %d", path, height)
+	}
+	return openJournalReader(path, int(entries[i].Segment), entries[i].Offset)
+}
+
+func openJournalReader(path string, segment int, offset int64) (*JournalReader, error) {
+	file, err := os.Open(JournalSegment(path, segment))
+	if err != nil {
+		return nil, err
+	}
+	j, err := NewJournalReader(bufio.NewReaderSize(file, 64*1024))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	j.path, j.segment, j.file = path, segment, file
+	if 0 < offset {
+		if j.text {
+			file.Close()
+			return nil, fmt.Errorf("%s is a text journal, which can't be seeked", path)
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		j.in.Reset(file)
+	}
+	return j, nil
+}
+
+// Next returns the next record, and io.EOF at the end of the journal.
+func (j *JournalReader) Next() (*JournalRecord, error) {
+	if j.text {
+		return ReadTextJournalRecord(j.in, &j.height)
+	}
+	for {
+		r, err := ReadJournalRecord(j.in)
+		if err != io.EOF || 0 == len(j.path) {
+			return r, err
+		}
+		// Go on to the journal's next file, if there is one.
+		file, err := os.Open(JournalSegment(j.path, j.segment+1))
+		if err != nil {
+			return nil, io.EOF
+		}
+		j.file.Close()
+		j.segment++
+		j.file = file
+		j.in.Reset(file)
+		if _, err := j.in.Discard(len(JournalMagic)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (j *JournalReader) Close() error {
+	if nil == j.file {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// ConvertTextJournal writes a journal in the old text format to a binary journal, returning the number of
+// messages in it.
+func ConvertTextJournal(in *bufio.Reader, out *Journal) (int, error) {
+	var height uint32
+	n := 0
+	for {
+		r, err := ReadTextJournalRecord(in, &height)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := out.Write(r); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
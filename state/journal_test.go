@@ -1,31 +1,185 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
 package state_test
 
-/*
 import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
-	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/messages"
 	"github.com/FactomProject/factomd/common/primitives"
 	. "github.com/FactomProject/factomd/state"
+	"github.com/FactomProject/factomd/testHelper"
 )
 
+func testJournalDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readJournal(t *testing.T, j *JournalReader) []*JournalRecord {
+	var records []*JournalRecord
+	for {
+		r, err := j.Next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+}
+
 func TestJournal(t *testing.T) {
-	s := new(State)
-	filename := "journaltest.log"
-	s.JournalFile = filename
-	_, err := os.Create(s.JournalFile)
+	dir := testJournalDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal0.jnl")
+
+	eom := new(messages.EOM)
+	eom.Timestamp = primitives.NewTimestampFromMilliseconds(1000)
+	eom.ChainID = primitives.NewZeroHash()
+	data, err := eom.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Small files, so the journal goes over several.
+	j, err := CreateJournal(path, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		r := &JournalRecord{Received: int64(i), Height: uint32(i / 5), Origin: "peer", Node: "FNode0", Msg: data}
+		if err := j.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(JournalSegment(path, 2)); err != nil {
+		t.Errorf("Expected the journal to go on into a third file: %v", err)
+	}
+	index, err := ReadJournalIndex(path)
+	if err != nil || 6 != len(index) {
+		t.Fatalf("Expected an index entry for each of 6 heights, got %v %v", index, err)
+	}
+
+	reader, err := OpenJournalReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readJournal(t, reader)
+	reader.Close()
+	if 30 != len(records) {
+		t.Fatalf("Read %d records, expected 30", len(records))
+	}
+	r := records[17]
+	if 17 != r.Received || 3 != r.Height || "peer" != r.Origin || "FNode0" != r.Node || !bytes.Equal(data, r.Msg) {
+		t.Errorf("Read back %+v", r)
+	}
+	if msg, err := r.Message(); err != nil || !msg.GetMsgHash().IsSameAs(eom.GetMsgHash()) {
+		t.Errorf("The record's message is %v %v", msg, err)
+	}
+
+	// Seeking starts at the first message of the height.
+	reader, err = SeekJournal(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = readJournal(t, reader)
+	reader.Close()
+	if 10 != len(records) || 4 != records[0].Height || 20 != records[0].Received {
+		t.Errorf("Seeking to height 4 read %d records, from %+v", len(records), records[0])
+	}
+	if _, err := SeekJournal(path, 6); err == nil {
+		t.Errorf("Expected an error seeking past the end of the journal")
+	}
+
+	// A new journal replaces the old one, files and all.
+	j, err = CreateJournal(path, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	if _, err := os.Stat(JournalSegment(path, 1)); !os.IsNotExist(err) {
+		t.Errorf("The old journal's second file was left: %v", err)
+	}
+}
+
+func TestTextJournal(t *testing.T) {
+	text := testHelper.CreateTestLogFileString()
+	dbstates := testHelper.CreateTestDBStateList()
+
+	// The old text journals are still read.
+	reader, err := NewJournalReader(bufio.NewReader(strings.NewReader(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readJournal(t, reader)
+	if len(dbstates) != len(records) {
+		t.Fatalf("Read %d messages from the text journal, expected %d", len(records), len(dbstates))
+	}
+
+	// And converted.
+	dir := testJournalDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal0.jnl")
+	j, err := CreateJournal(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := ConvertTextJournal(bufio.NewReader(strings.NewReader(text)), j)
+	j.Close()
+	if err != nil || len(dbstates) != n {
+		t.Fatalf("Converted %d messages, %v", n, err)
+	}
+	reader, err = OpenJournalReader(path)
 	if err != nil {
-		t.Errorf("%v", err)
+		t.Fatal(err)
 	}
+	converted := readJournal(t, reader)
+	reader.Close()
+	for i, r := range converted {
+		if !bytes.Equal(records[i].Msg, r.Msg) || records[i].Received != r.Received {
+			t.Errorf("Message %d was converted as %+v", i, r)
+		}
+	}
+}
 
-	msg := new(messages.Ack)
-	msg.MsgHash = primitives.NewZeroHash()
-	msg.MessageHash = primitives.NewZeroHash()
-	msg.SerialHash = primitives.NewZeroHash()
-	msg.Timestamp = interfaces.Timestamp(0x112233)
+func TestCorruptJournal(t *testing.T) {
+	r := &JournalRecord{Received: 1, Height: 2, Origin: "peer", Node: "FNode0", Msg: []byte{1, 2, 3}}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A length no record could have.
+	corrupt := append([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, data[1:]...)
+	if _, err := ReadJournalRecord(bufio.NewReader(bytes.NewReader(corrupt))); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("Expected a corrupt record, got %v", err)
+	}
 
-	s.JournalMessage(msg)
+	// A record cut short.
+	if _, err := ReadJournalRecord(bufio.NewReader(bytes.NewReader(data[:len(data)-2]))); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected an unexpected EOF, got %v", err)
+	}
+
+	// A message over the limit isn't written.
+	r.Msg = make([]byte, MaxJournalRecordSize)
+	if _, err := r.MarshalBinary(); err == nil {
+		t.Errorf("Marshaled a record over the limit")
+	}
 }
-*/
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"log"
 	"sync"
-	"time"
 
 	"github.com/FactomProject/factomd/common/adminBlock"
 	"github.com/FactomProject/factomd/common/constants"
@@ -458,7 +457,7 @@ func (p *ProcessList) CheckDiffSigTally() bool {
 }
 
 func ask(p *ProcessList, vmIndex int, waitSeconds int64, vm *VM, thetime int64, height int) int64 {
-	now := time.Now().Unix()
+	now := primitives.GetClock().Now().Unix()
 	//fmt.Println("ASK", p.State.FactomNodeName, vmIndex, now, thetime, waitSeconds)
 	if thetime == 0 {
 		thetime = now
@@ -476,7 +475,7 @@ func ask(p *ProcessList, vmIndex int, waitSeconds int64, vm *VM, thetime int64,
 }
 
 func fault(p *ProcessList, vmIndex int, waitSeconds int64, vm *VM, thetime int64, height int) int64 {
-	now := time.Now().Unix()
+	now := primitives.GetClock().Now().Unix()
 
 	if thetime == 0 {
 		thetime = now
@@ -7,6 +7,7 @@ package state
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/FactomProject/factomd/common/interfaces"
 )
@@ -58,7 +59,10 @@ func (lists *ProcessLists) UpdateState(dbheight uint32) (progress bool) {
 		s.LeaderPL = s.ProcessLists.Get(s.LLeaderHeight)
 		s.Leader, s.LeaderVMIndex = s.LeaderPL.GetVirtualServers(s.CurrentMinute, s.IdentityChainID)
 	}
-	return pl.Process(lists.State)
+	start := time.Now()
+	progress = pl.Process(lists.State)
+	lists.State.TimeProcess(pl.DBHeight, lists.State.CurrentMinute, time.Since(start))
+	return
 
 }
 
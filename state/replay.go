@@ -5,6 +5,8 @@
 package state
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"sync"
 	"time"
@@ -16,6 +18,9 @@ import (
 const HourRange = 4                // Double this for the period we protect, i.e. 4 means +/- 4 hours
 const numBuckets = HourRange*2 + 3 // cover an hour each way, and an hour in the middle.
 
+// How often the ValidatorLoop saves the replay filter to the database.
+const ReplaySaveInterval = 5 * time.Minute
+
 var _ = time.Now()
 var _ = fmt.Print
 
@@ -108,3 +113,133 @@ func (r *Replay) IsTSValid_(mask int, hash [32]byte, timestamp interfaces.Timest
 
 	return false
 }
+
+// Find looks for the hash in every bucket.  Returns the mask of the replay
+// checks it has passed, and the hour (since 1970) of the bucket holding it.
+func (r *Replay) Find(hash [32]byte) (mask int, hour int, found bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, bucket := range r.buckets {
+		if v, ok := bucket[hash]; ok {
+			return v, r.basetime + i, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Hour returns the hour (since 1970) the filter was last advanced to.
+func (r *Replay) Hour() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.center
+}
+
+func (r *Replay) MarshalBinary() ([]byte, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, int64(r.basetime))
+	binary.Write(buf, binary.BigEndian, int64(r.center))
+	for _, bucket := range r.buckets {
+		binary.Write(buf, binary.BigEndian, uint32(len(bucket)))
+		for hash, mask := range bucket {
+			buf.Write(hash[:])
+			binary.Write(buf, binary.BigEndian, int32(mask))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *Replay) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("Error unmarshalling Replay: %v", rec)
+		}
+	}()
+
+	var basetime, center int64
+	var buckets [numBuckets]map[[32]byte]int
+
+	buf := bytes.NewBuffer(data)
+	if err = binary.Read(buf, binary.BigEndian, &basetime); err != nil {
+		return nil, err
+	}
+	if err = binary.Read(buf, binary.BigEndian, &center); err != nil {
+		return nil, err
+	}
+	for i := range buckets {
+		var cnt uint32
+		if err = binary.Read(buf, binary.BigEndian, &cnt); err != nil {
+			return nil, err
+		}
+		if cnt == 0 {
+			continue
+		}
+		if int(cnt)*36 > buf.Len() {
+			return nil, fmt.Errorf("Error unmarshalling Replay: bucket %d claims %d hashes", i, cnt)
+		}
+		buckets[i] = make(map[[32]byte]int, cnt)
+		for j := uint32(0); j < cnt; j++ {
+			var hash [32]byte
+			var mask int32
+			buf.Read(hash[:])
+			if err = binary.Read(buf, binary.BigEndian, &mask); err != nil {
+				return nil, err
+			}
+			buckets[i][hash] = int(mask)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.basetime = int(basetime)
+	r.center = int(center)
+	r.buckets = buckets
+	return buf.Bytes(), nil
+}
+
+func (r *Replay) UnmarshalBinary(data []byte) error {
+	_, err := r.UnmarshalBinaryData(data)
+	return err
+}
+
+// SaveReplay writes the replay filter to the database, so a restart does not
+// open a window for replays of messages we have already seen.
+func (s *State) SaveReplay() {
+	if s.DB == nil || s.Replay == nil {
+		return
+	}
+	if err := s.DB.SaveReplay(s.Replay); err != nil {
+		fmt.Println(s.FactomNodeName, "Could not save the replay filter:", err.Error())
+	}
+}
+
+// LoadReplay restores the replay filter saved in the database, if it is
+// recent enough that its buckets still overlap the range we protect.
+func (s *State) LoadReplay() {
+	if s.DB == nil {
+		return
+	}
+	r := new(Replay)
+	found, err := s.DB.FetchReplay(r)
+	if err != nil {
+		fmt.Println(s.FactomNodeName, "Could not load the replay filter:", err.Error())
+		return
+	}
+	if found == nil {
+		return
+	}
+	age := hours(s.GetTimestamp().GetTimeSeconds()) - r.Hour()
+	if age < 0 || age > HourRange {
+		return
+	}
+	s.Replay = r
+}
+
+// FindInReplay reports if the hash is in the replay filter, the replay
+// checks it has passed, and the hour (since 1970) of its bucket.
+func (s *State) FindInReplay(hash interfaces.IHash) (mask int, hour int, found bool) {
+	return s.Replay.Find(hash.Fixed())
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
 	. "github.com/FactomProject/factomd/state"
+	"github.com/FactomProject/factomd/testHelper"
 )
 
 var _ = fmt.Printf
@@ -81,3 +82,59 @@ func Test_Replay(test *testing.T) {
 	fmt.Println("Simulation ran from", time.Unix(start.GetTimeSeconds(), 0), "to", time.Unix(now.GetTimeSeconds(), 0))
 
 }
+
+func Test_ReplayMarshal(test *testing.T) {
+	r := new(Replay)
+	now := primitives.NewTimestampNow()
+
+	var hashes [][32]byte
+	for i := 0; i < 100; i++ {
+		hash := primitives.Sha([]byte(fmt.Sprintf("m%d", i))).Fixed()
+		ts := primitives.NewTimestampFromSeconds(uint32(now.GetTimeSeconds() + (int64(i)%8-4)*hour/2))
+		if !r.IsTSValid_(constants.INTERNAL_REPLAY, hash, ts, now) {
+			test.Fatalf("Hash %d was not accepted", i)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	data, err := r.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	r2 := new(Replay)
+	if err := r2.UnmarshalBinary(data); err != nil {
+		test.Fatal(err)
+	}
+	if r2.Hour() != r.Hour() {
+		test.Errorf("Hour %d restored as %d", r.Hour(), r2.Hour())
+	}
+	for i, hash := range hashes {
+		mask, hr, found := r2.Find(hash)
+		_, hr1, _ := r.Find(hash)
+		if !found || mask != constants.INTERNAL_REPLAY || hr != hr1 {
+			test.Errorf("Hash %d not restored: found %v mask %d hour %d", i, found, mask, hr)
+		}
+	}
+
+	if err := r2.UnmarshalBinary(data[:len(data)-3]); err == nil {
+		test.Errorf("Unmarshalled a truncated replay filter")
+	}
+}
+
+func Test_SaveReplay(test *testing.T) {
+	s := testHelper.CreateEmptyTestState()
+	hash := primitives.Sha([]byte("saved"))
+	if !s.Replay.IsTSValid(constants.NETWORK_REPLAY, hash, s.GetTimestamp()) {
+		test.Fatal("Hash was not accepted")
+	}
+	s.SaveReplay()
+
+	s.Replay = new(Replay)
+	if _, _, found := s.FindInReplay(hash); found {
+		test.Fatal("Hash found in an empty replay filter")
+	}
+	s.LoadReplay()
+	if mask, _, found := s.FindInReplay(hash); !found || mask != constants.NETWORK_REPLAY {
+		test.Errorf("Hash not found after reloading the replay filter")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"sync"
+	"sync/atomic"
 
 	"github.com/FactomProject/factomd/common/constants"
 	"github.com/FactomProject/factomd/common/interfaces"
@@ -51,6 +52,7 @@ type State struct {
 	LocalServerPrivKey      string
 	DirectoryBlockInSeconds int
 	PortNumber              int
+	AdminPassword           string // Required by the admin API methods.  Empty disables them.
 	Replay                  *Replay
 	DropRate                int
 
@@ -74,6 +76,20 @@ type State struct {
 	LocalPeersFile    string
 	LocalSeedURL      string
 	LocalSpecialPeers string
+	MainCheckpoints   string
+	TestCheckpoints   string
+	LocalCheckpoints  string
+	EncryptPeers      bool
+	PeerKeyFile       string
+	BanDuration       time.Duration // How long banned peers are refused
+
+	Checkpoints       map[uint32]interfaces.IHash // Known good Directory Block KeyMRs by height
+	HighestCheckpoint uint32
+	checkpointLinks   map[uint32]interfaces.IHash // KeyMRs linked back from a checkpoint, by height
+	checkpointMutex   sync.Mutex
+
+	DBStateWorkers   int // Workers checking DBStates ahead of the ValidatorLoop.  0 checks them inline.
+	DBStateValidator *DBStateValidator
 
 	IdentityChainID      interfaces.IHash // If this node has an identity, this is it
 	Identities           []Identity       // Identities of all servers in management chain
@@ -92,18 +108,37 @@ type State struct {
 	ResendCnt  int
 	ExpireCnt  int
 
+	// Timing of the production of recent blocks
+	BlockTimings     []*interfaces.BlockTiming
+	blockTimingMutex sync.Mutex
+	timingMissingCnt int
+	timingResendCnt  int
+	timingExpireCnt  int
+
+	// Fingerprints of the blocks processed, and the messages last executed, to compare nodes in a simulation
+	Fingerprinting   bool
+	fingerprints     []*BlockFingerprint
+	recentMsgs       []string
+	fingerprintMutex sync.Mutex
+
 	tickerQueue            chan int
 	timerMsgQueue          chan interfaces.IMsg
 	TimeOffset             interfaces.Timestamp
 	MaxTimeOffset          interfaces.Timestamp
 	networkOutMsgQueue     chan interfaces.IMsg
 	networkInvalidMsgQueue chan interfaces.IMsg
+	networkUsefulMsgQueue  chan interfaces.IMsg
 	inMsgQueue             chan interfaces.IMsg
 	apiQueue               chan interfaces.IMsg
 	ackQueue               chan interfaces.IMsg
 	msgQueue               chan interfaces.IMsg
 	ShutdownChan           chan int // For gracefully halting Factom
+	ShutdownDone           chan int // Signaled by the ValidatorLoop once it has stopped
+	shuttingDown           int32    // Set to 1 once a shutdown has begun.  The API refuses submissions.  Atomic.
 	JournalFile            string
+	JournalMaxSize         int64 // Bytes each file of the journal grows to before it goes on in the next
+	journal                *Journal
+	journalMutex           sync.Mutex
 
 	serverPrivKey         *primitives.PrivateKey
 	serverPubKey          *primitives.PublicKey
@@ -239,7 +274,8 @@ func (s *State) Clone(number string) interfaces.IState {
 	clone.FactomdVersion = s.FactomdVersion
 	clone.LogPath = s.LogPath + "/Sim" + number
 	clone.LdbPath = s.LdbPath + "/Sim" + number
-	clone.JournalFile = s.LogPath + "/journal" + number + ".log"
+	clone.JournalFile = s.LogPath + "/journal" + number + ".jnl"
+	clone.JournalMaxSize = s.JournalMaxSize
 	clone.BoltDBPath = s.BoltDBPath + "/Sim" + number
 	clone.LogLevel = s.LogLevel
 	clone.ConsoleLogLevel = s.ConsoleLogLevel
@@ -261,10 +297,18 @@ func (s *State) Clone(number string) interfaces.IState {
 	clone.LocalPeersFile = s.LocalPeersFile
 	clone.LocalSeedURL = s.LocalSeedURL
 	clone.LocalSpecialPeers = s.LocalSpecialPeers
+	clone.MainCheckpoints = s.MainCheckpoints
+	clone.TestCheckpoints = s.TestCheckpoints
+	clone.LocalCheckpoints = s.LocalCheckpoints
+	clone.EncryptPeers = s.EncryptPeers
+	clone.PeerKeyFile = s.PeerKeyFile
+	clone.BanDuration = s.BanDuration
+	clone.DBStateWorkers = s.DBStateWorkers
 	clone.FaultMap = s.FaultMap
 
 	clone.DirectoryBlockInSeconds = s.DirectoryBlockInSeconds
 	clone.PortNumber = s.PortNumber
+	clone.AdminPassword = s.AdminPassword
 
 	clone.ControlPanelPort = s.ControlPanelPort
 	clone.ControlPanelPath = s.ControlPanelPath
@@ -350,10 +394,21 @@ func (s *State) LoadConfig(filename string, folder string) {
 		s.LocalPeersFile = cfg.App.LocalPeersFile
 		s.LocalSeedURL = cfg.App.LocalSeedURL
 		s.LocalSpecialPeers = cfg.App.LocalSpecialPeers
+		s.MainCheckpoints = cfg.App.MainCheckpoints
+		s.TestCheckpoints = cfg.App.TestCheckpoints
+		s.LocalCheckpoints = cfg.App.LocalCheckpoints
+		s.EncryptPeers = cfg.App.EncryptPeers
+		s.PeerKeyFile = cfg.App.PeerKeyFile
+		if banDuration, err := time.ParseDuration(cfg.App.BanDuration); err == nil {
+			s.BanDuration = banDuration
+		} else if len(cfg.App.BanDuration) > 0 {
+			s.Println("Invalid BanDuration in factomd.conf, using the default: ", err.Error())
+		}
 		s.LocalServerPrivKey = cfg.App.LocalServerPrivKey
 		s.FactoshisPerEC = cfg.App.ExchangeRate
 		s.DirectoryBlockInSeconds = cfg.App.DirectoryBlockInSeconds
 		s.PortNumber = cfg.Wsapi.PortNumber
+		s.AdminPassword = cfg.Wsapi.AdminPassword
 		s.ControlPanelPort = cfg.App.ControlPanelPort
 		s.ControlPanelPath = cfg.App.ControlPanelFilesPath
 		switch cfg.App.ControlPanelSetting {
@@ -397,6 +452,7 @@ func (s *State) LoadConfig(filename string, folder string) {
 		s.LocalPeersFile = "LocalPeers.json"
 		s.LocalSeedURL = "https://raw.githubusercontent.com/FactomProject/factomproject.github.io/master/seed/localseed.txt"
 		s.LocalSpecialPeers = ""
+		s.PeerKeyFile = "PeerKey.pem"
 
 		s.LocalServerPrivKey = "4c38c72fc5cdad68f13b74674d3ffb1f3d63a112710868c9b08946553448d26d"
 		s.FactoshisPerEC = 006666
@@ -412,7 +468,8 @@ func (s *State) LoadConfig(filename string, folder string) {
 		s.IdentityChainID = primitives.Sha([]byte(s.FactomNodeName))
 
 	}
-	s.JournalFile = s.LogPath + "/journal0" + ".log"
+	s.JournalFile = s.LogPath + "/journal0" + ".jnl"
+	s.JournalMaxSize = DefaultJournalMaxSize
 }
 
 func (s *State) Init() {
@@ -431,6 +488,7 @@ func (s *State) Init() {
 	s.timerMsgQueue = make(chan interfaces.IMsg, 10000)          //incoming eom notifications, used by leaders
 	s.TimeOffset = new(primitives.Timestamp)                     //interfaces.Timestamp(int64(rand.Int63() % int64(time.Microsecond*10)))
 	s.networkInvalidMsgQueue = make(chan interfaces.IMsg, 10000) //incoming message queue from the network messages
+	s.networkUsefulMsgQueue = make(chan interfaces.IMsg, 1000)   //network messages that gave us something we asked for
 	s.InvalidMessages = make(map[[32]byte]interfaces.IMsg, 0)
 	s.networkOutMsgQueue = make(chan interfaces.IMsg, 10000) //Messages to be broadcast to the network
 	s.inMsgQueue = make(chan interfaces.IMsg, 10000)         //incoming message queue for factom application messages
@@ -438,12 +496,14 @@ func (s *State) Init() {
 	s.ackQueue = make(chan interfaces.IMsg, 10000)           //queue of Leadership messages
 	s.msgQueue = make(chan interfaces.IMsg, 10000)           //queue of Follower messages
 	s.ShutdownChan = make(chan int, 1)                       //Channel to gracefully shut down.
+	s.ShutdownDone = make(chan int, 1)                       //Channel to report the ValidatorLoop has stopped.
 
 	er := os.MkdirAll(s.LogPath, 0777)
 	if er != nil {
 		fmt.Println("Could not create " + s.LogPath + "\n error: " + er.Error())
 	}
-	_, err := os.Create(s.JournalFile) //Create the Journal File
+	journal, err := CreateJournal(s.JournalFile, s.JournalMaxSize) //Create the Journal File
+	s.journal = journal
 	if err != nil {
 		fmt.Println("Could not create the file: " + s.JournalFile)
 		s.JournalFile = ""
@@ -516,6 +576,7 @@ func (s *State) Init() {
 	if s.ExportData {
 		s.DB.SetExportData(s.ExportDataSubpath)
 	}
+	s.LoadReplay()
 
 	//Network
 	switch s.Network {
@@ -530,6 +591,10 @@ func (s *State) Init() {
 	default:
 		panic("Bad value for Network in factomd.conf")
 	}
+	s.initCheckpoints()
+	if s.DBStateWorkers > 0 {
+		s.DBStateValidator = NewDBStateValidator(s, s.DBStateWorkers)
+	}
 
 	s.Println("\nRunning on the ", s.Network, "Network")
 	s.Println("\nExchange rate chain id set to ", s.FERChainId)
@@ -784,16 +849,44 @@ func (s *State) MessageToLogString(msg interfaces.IMsg) string {
 }
 
 func (s *State) JournalMessage(msg interfaces.IMsg) {
-	if len(s.JournalFile) != 0 {
-		f, err := os.OpenFile(s.JournalFile, os.O_APPEND+os.O_WRONLY, 0666)
-		if err != nil {
-			s.JournalFile = ""
-			return
-		}
-		str := s.MessageToLogString(msg)
-		f.WriteString(str)
-		f.Close()
+	s.journalMutex.Lock()
+	defer s.journalMutex.Unlock()
+	if nil == s.journal {
+		return
+	}
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return
+	}
+	r := &JournalRecord{
+		Received: primitives.NewTimestampNow().GetTimeMilli(),
+		Height:   s.LLeaderHeight,
+		Origin:   msg.GetNetworkOrigin(),
+		Node:     s.FactomNodeName,
+		Msg:      data,
+	}
+	if err := s.journal.Write(r); err != nil {
+		fmt.Println("Could not write to the journal " + s.JournalFile + ": " + err.Error())
+		s.journal.Close()
+		s.journal = nil
+	}
+}
+
+// FlushJournal waits for any journal write in progress, syncs the journal to
+// disk, and stops any further journaling.  Used when shutting down.
+func (s *State) FlushJournal() error {
+	s.journalMutex.Lock()
+	defer s.journalMutex.Unlock()
+	if nil == s.journal {
+		return nil
+	}
+	j := s.journal
+	s.journal = nil
+	if err := j.Sync(); err != nil {
+		j.Close()
+		return err
 	}
+	return j.Close()
 }
 
 func (s *State) GetLeaderVM() int {
@@ -1010,6 +1103,18 @@ func (s *State) GetPort() int {
 	return s.PortNumber
 }
 
+func (s *State) GetAdminPassword() string {
+	return s.AdminPassword
+}
+
+func (s *State) IsShuttingDown() bool {
+	return atomic.LoadInt32(&s.shuttingDown) != 0
+}
+
+func (s *State) SetShuttingDown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+}
+
 func (s *State) TickerQueue() chan int {
 	return s.tickerQueue
 }
@@ -1022,6 +1127,22 @@ func (s *State) NetworkInvalidMsgQueue() chan interfaces.IMsg {
 	return s.networkInvalidMsgQueue
 }
 
+func (s *State) NetworkUsefulMsgQueue() chan interfaces.IMsg {
+	return s.networkUsefulMsgQueue
+}
+
+// usefulNetworkMsg lets the network processor credit the peer that sent msg.  Peer scores are only a hint,
+// so the message is dropped rather than holding up the state if the queue is full.
+func (s *State) usefulNetworkMsg(msg interfaces.IMsg) {
+	if len(msg.GetNetworkOrigin()) == 0 {
+		return
+	}
+	select {
+	case s.networkUsefulMsgQueue <- msg:
+	default:
+	}
+}
+
 func (s *State) NetworkOutMsgQueue() chan interfaces.IMsg {
 	return s.networkOutMsgQueue
 }
@@ -64,6 +64,7 @@ func (s *State) Process() (progress bool) {
 			} else {
 				msg.FollowerExecute(s)
 			}
+			s.noteExecuted(msg)
 			ret = true
 		case 0:
 			s.Holding[msg.GetMsgHash().Fixed()] = msg
@@ -89,6 +90,7 @@ func (s *State) Process() (progress bool) {
 		a := ack.(*messages.Ack)
 		if a.DBHeight >= s.LLeaderHeight && ack.Validate(s) == 1 {
 			ack.FollowerExecute(s)
+			s.noteExecuted(ack)
 		}
 		progress = true
 	case msg := <-s.msgQueue:
@@ -243,6 +245,10 @@ func (s *State) FollowerExecuteAck(msg interfaces.IMsg) {
 func (s *State) FollowerExecuteDBState(msg interfaces.IMsg) {
 	dbstatemsg, _ := msg.(*messages.DBStateMsg)
 
+	if s.ConflictsWithCheckpoint(dbstatemsg.DirectoryBlock) {
+		return
+	}
+
 	s.DBStates.LastTime = s.GetTimestamp()
 	dbstate := s.AddDBState(false, // Not a new block; got it from the network
 		dbstatemsg.DirectoryBlock,
@@ -266,6 +272,9 @@ func (s *State) FollowerExecuteAddData(msg interfaces.IMsg) {
 
 		if entry.GetHash().IsSameAs(dataResponseMsg.DataHash) {
 
+			if _, requested := s.DataRequests[entry.GetHash().Fixed()]; requested {
+				s.usefulNetworkMsg(msg)
+			}
 			s.DB.InsertEntry(entry)
 			delete(s.DataRequests, entry.GetHash().Fixed())
 		}
@@ -273,6 +282,9 @@ func (s *State) FollowerExecuteAddData(msg interfaces.IMsg) {
 		eblock := dataResponseMsg.DataObject.(interfaces.IEntryBlock)
 		dataHash, _ := eblock.KeyMR()
 		if dataHash.IsSameAs(dataResponseMsg.DataHash) {
+			if s.HasDataRequest(dataHash) {
+				s.usefulNetworkMsg(msg)
+			}
 			s.addEBlock(eblock)
 		}
 	default:
@@ -649,6 +661,7 @@ func (s *State) ProcessEOM(dbheight uint32, msg interfaces.IMsg) bool {
 
 	// What I do for each EOM
 	if !e.Processed {
+		s.TimeEOM(dbheight, int(e.Minute), msg.GetVMIndex())
 		vm.LeaderMinute++
 		s.EOMProcessed++
 		e.Processed = true
@@ -823,6 +836,7 @@ func (s *State) ProcessDBSig(dbheight uint32, msg interfaces.IMsg) bool {
 	// Put the stuff that executes once for set of DBSignatures (after I have them all) here
 	if s.DBSigProcessed >= s.DBSigLimit {
 		dbstate := s.DBStates.Get(int(dbheight - 1))
+		s.TimeDBSigs(dbheight - 1)
 
 		// TODO: check signatures here.  Count what match and what don't.  Then if a majority
 		// disagree with us, null our entry out.  Otherwise toss our DBState and ask for one from
@@ -0,0 +1,45 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/testHelper"
+)
+
+func TestFollowerExecuteAddDataCredit(t *testing.T) {
+	s := testHelper.CreateEmptyTestState()
+	eblock, entries := testHelper.CreateTestEntryBlock(nil)
+	keymr, _ := eblock.KeyMR()
+
+	// Neither was asked for, so the peer gets no credit for them.
+	for _, msg := range []interfaces.IMsg{
+		messages.NewDataResponse(s, eblock, 1, keymr),
+		messages.NewDataResponse(s, entries[0], 0, entries[0].GetHash()),
+	} {
+		msg.SetNetworkOrigin("peer")
+		s.FollowerExecuteAddData(msg)
+	}
+	if 0 != len(s.NetworkUsefulMsgQueue()) {
+		t.Errorf("Credited the peer for data not requested")
+	}
+
+	// Once asked for, they are.
+	s.AddDataRequest(keymr, keymr)
+	s.AddDataRequest(entries[0].GetHash(), keymr)
+	for _, msg := range []interfaces.IMsg{
+		messages.NewDataResponse(s, eblock, 1, keymr),
+		messages.NewDataResponse(s, entries[0], 0, entries[0].GetHash()),
+	} {
+		msg.SetNetworkOrigin("peer")
+		s.FollowerExecuteAddData(msg)
+	}
+	if 2 != len(s.NetworkUsefulMsgQueue()) {
+		t.Errorf("Expected the peer credited for the eblock and the entry, got %d", len(s.NetworkUsefulMsgQueue()))
+	}
+}
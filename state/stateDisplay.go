@@ -44,6 +44,9 @@ type DisplayState struct {
 	RawSummary  string
 	PrintMap    string
 	ProcessList string
+
+	// Block Timing
+	BlockTimings []interfaces.BlockTiming
 }
 
 type FactoidTransaction struct {
@@ -197,6 +200,8 @@ func DeepStateDisplayCopy(s *State) (*DisplayState, error) {
 	ds.PrintMap = pl.PrintMap()
 	ds.ProcessList = pl.String()
 
+	ds.BlockTimings = s.GetBlockTimings(0)
+
 	return ds, nil
 }
 
@@ -232,6 +237,10 @@ func (d *DisplayState) Clone() *DisplayState {
 	ds.PrintMap = d.PrintMap
 	ds.ProcessList = d.ProcessList
 
+	for _, b := range d.BlockTimings {
+		ds.BlockTimings = append(ds.BlockTimings, b.Copy())
+	}
+
 	return ds
 }
 
@@ -8,23 +8,33 @@ import (
 	"fmt"
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
 	"time"
 )
 
 func (state *State) ValidatorLoop() {
 	timeStruct := new(Timer)
+	clock := primitives.GetClock()
+	lastReplaySave := clock.Now()
 	for {
 
 		// Check if we should shut down.
 		select {
 		case <-state.ShutdownChan:
-			fmt.Println("Closing the Database on", state.GetFactomNodeName())
-			state.DB.Close()
-			fmt.Println(state.GetFactomNodeName(), "closed")
+			// We only get here between passes, so any save to the database
+			// has completed.  Closing the database is left to the caller.
+			state.SaveReplay()
+			fmt.Println("Stopped processing on", state.GetFactomNodeName())
+			state.ShutdownDone <- 0
 			return
 		default:
 		}
 
+		if clock.Now().Sub(lastReplaySave) > ReplaySaveInterval {
+			state.SaveReplay()
+			lastReplaySave = clock.Now()
+		}
+
 		// Look for pending messages, and get one if there is one.
 		var msg interfaces.IMsg
 	loop:
@@ -57,7 +67,7 @@ func (state *State) ValidatorLoop() {
 				state.JournalMessage(msg)
 				break loop
 			default: // No messages? Sleep for a bit
-				time.Sleep(10 * time.Millisecond)
+				primitives.IdleSleep(10 * time.Millisecond)
 			}
 		}
 
@@ -68,6 +78,8 @@ func (state *State) ValidatorLoop() {
 			}
 			if _, ok := msg.(*messages.Ack); ok {
 				state.ackQueue <- msg
+			} else if dbs, ok := msg.(*messages.DBStateMsg); ok && !dbs.IsLocal() {
+				state.queueDBState(dbs)
 			} else {
 				state.msgQueue <- msg
 			}
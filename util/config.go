@@ -50,6 +50,12 @@ type FactomdConfig struct {
 		LocalPeersFile    string
 		LocalSeedURL      string
 		LocalSpecialPeers string
+		MainCheckpoints   string
+		TestCheckpoints   string
+		LocalCheckpoints  string
+		EncryptPeers      bool
+		PeerKeyFile       string
+		BanDuration       string
 	}
 	Peer struct {
 		AddPeers     []string      `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
@@ -87,6 +93,7 @@ type FactomdConfig struct {
 	Wsapi struct {
 		PortNumber      int
 		ApplicationName string
+		AdminPassword   string
 	}
 	Log struct {
 		LogPath         string
@@ -138,6 +145,16 @@ LocalNetworkPort     = 8110
 LocalPeersFile       = "LocalPeers.json"
 LocalSeedURL         = "https://raw.githubusercontent.com/FactomProject/factomproject.github.io/master/seed/localseed.txt"
 LocalSpecialPeers     = ""
+; --------------- Checkpoints: "height:KeyMR" pairs separated by commas.  Added to the built in checkpoints, which are empty, so only these are enforced.
+MainCheckpoints      = ""
+TestCheckpoints      = ""
+LocalCheckpoints     = ""
+; --------------- EncryptPeers: wrap peer connections in TLS.  PeerKeyFile holds our network identity key, and is created if missing.
+; --------------- Special peers can be pinned to the key they must present with address:port@fingerprint
+EncryptPeers         = false
+PeerKeyFile          = "PeerKey.pem"
+; --------------- BanDuration: how long banned peers are refused, eg 24h or 90m.  Bans are kept next to the peers file.
+BanDuration          = "24h"
 ; --------------- NodeMode: FULL | SERVER | LIGHT ----------------
 NodeMode                              = FULL
 LocalServerPrivKey                    = 4c38c72fc5cdad68f13b74674d3ffb1f3d63a112710868c9b08946553448d26d
@@ -166,6 +183,8 @@ RpcBtcdHost                           = "localhost:18334"
 [wsapi]
 ApplicationName                       = "Factom/wsapi"
 PortNumber                            = 8088
+; --------------- AdminPassword is required by the admin API methods (eg shutdown).  Empty disables them.
+AdminPassword                         = ""
 
 ; ------------------------------------------------------------------------------
 ; logLevel - allowed values are: debug, info, notice, warning, error, critical, alert, emergency and none
@@ -217,6 +236,12 @@ func (s *FactomdConfig) String() string {
 	out.WriteString(fmt.Sprintf("\n    LocalPeersFile          %v", s.App.LocalPeersFile))
 	out.WriteString(fmt.Sprintf("\n    LocalSeedURL            %v", s.App.LocalSeedURL))
 	out.WriteString(fmt.Sprintf("\n    LocalSpecialPeers       %v", s.App.LocalSpecialPeers))
+	out.WriteString(fmt.Sprintf("\n    MainCheckpoints         %v", s.App.MainCheckpoints))
+	out.WriteString(fmt.Sprintf("\n    TestCheckpoints         %v", s.App.TestCheckpoints))
+	out.WriteString(fmt.Sprintf("\n    LocalCheckpoints        %v", s.App.LocalCheckpoints))
+	out.WriteString(fmt.Sprintf("\n    EncryptPeers            %v", s.App.EncryptPeers))
+	out.WriteString(fmt.Sprintf("\n    PeerKeyFile             %v", s.App.PeerKeyFile))
+	out.WriteString(fmt.Sprintf("\n    BanDuration             %v", s.App.BanDuration))
 	out.WriteString(fmt.Sprintf("\n    NodeMode                %v", s.App.NodeMode))
 	out.WriteString(fmt.Sprintf("\n    IdentityChainID         %v", s.App.IdentityChainID))
 	out.WriteString(fmt.Sprintf("\n    LocalServerPrivKey      %v", s.App.LocalServerPrivKey))
@@ -0,0 +1,146 @@
+// Copyright 2016 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package wsapi
+
+import (
+	"crypto/subtle"
+
+	"github.com/FactomProject/factomd/common/constants"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/p2p"
+)
+
+// ShutdownFunc is called by the "shutdown" admin method.  The engine sets it
+// so the API triggers the same orderly shutdown as Ctrl+C.
+var ShutdownFunc func()
+
+// BanList is the p2p network's ban list, for the ban admin methods.  The
+// engine sets it when it starts the network.
+var BanList interface {
+	Bans() []p2p.Ban
+	BanAddress(address string, reason string) (p2p.Ban, error)
+	LiftBan(address string) bool
+}
+
+// IsSubmission returns true for the methods that put new messages into the
+// system.  These are refused once a shutdown has begun.
+func IsSubmission(method string) bool {
+	switch method {
+	case "commit-chain", "reveal-chain", "commit-entry", "reveal-entry", "factoid-submit", "send-raw-message":
+		return true
+	}
+	return false
+}
+
+// CheckAdmin decodes the params of an admin method into req, and checks the
+// password it carries against the one configured for this node.  If no
+// password is configured, the admin methods are disabled.
+func CheckAdmin(state interfaces.IState, params interface{}, req interface{}) *primitives.JSONError {
+	err := MapToObject(params, req)
+	if err != nil {
+		return NewInvalidParamsError()
+	}
+	admin := new(AdminRequest)
+	err = MapToObject(params, admin)
+	if err != nil {
+		return NewInvalidParamsError()
+	}
+	password := state.GetAdminPassword()
+	if len(password) == 0 || subtle.ConstantTimeCompare([]byte(admin.Password), []byte(password)) != 1 {
+		return NewUnauthorizedError()
+	}
+	return nil
+}
+
+func HandleV2Shutdown(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
+	req := new(AdminRequest)
+	if jsonError := CheckAdmin(state, params, req); jsonError != nil {
+		return nil, jsonError
+	}
+	if ShutdownFunc == nil {
+		return nil, NewCustomInternalError("Shutdown is not available")
+	}
+	if !state.IsShuttingDown() {
+		go ShutdownFunc()
+	}
+
+	resp := new(ShutdownResponse)
+	resp.Message = "Shutting down"
+	return resp, nil
+}
+
+func HandleV2ReplayCheck(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
+	req := new(HashRequest)
+	if jsonError := CheckAdmin(state, params, req); jsonError != nil {
+		return nil, jsonError
+	}
+	hash, err := primitives.HexToHash(req.Hash)
+	if err != nil {
+		return nil, NewInvalidHashError()
+	}
+
+	resp := new(ReplayCheckResponse)
+	resp.Hash = hash.String()
+	mask, hour, found := state.FindInReplay(hash)
+	if found {
+		resp.Found = true
+		resp.Internal = mask&constants.INTERNAL_REPLAY > 0
+		resp.Network = mask&constants.NETWORK_REPLAY > 0
+		resp.Hour = int64(hour) * 60 * 60
+	}
+	return resp, nil
+}
+
+func HandleV2BanList(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
+	req := new(AdminRequest)
+	if jsonError := CheckAdmin(state, params, req); jsonError != nil {
+		return nil, jsonError
+	}
+	if BanList == nil {
+		return nil, NewCustomInternalError("The p2p network is not running")
+	}
+
+	resp := new(BanListResponse)
+	resp.Bans = BanList.Bans()
+	return resp, nil
+}
+
+func HandleV2BanAdd(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
+	req := new(BanRequest)
+	if jsonError := CheckAdmin(state, params, req); jsonError != nil {
+		return nil, jsonError
+	}
+	if BanList == nil {
+		return nil, NewCustomInternalError("The p2p network is not running")
+	}
+	reason := req.Reason
+	if len(reason) == 0 {
+		reason = "Banned by operator"
+	}
+	ban, err := BanList.BanAddress(req.Address, reason)
+	if err != nil {
+		return nil, NewCustomInvalidParamsError(err.Error())
+	}
+
+	resp := new(BanListResponse)
+	resp.Bans = []p2p.Ban{ban}
+	return resp, nil
+}
+
+func HandleV2BanLift(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
+	req := new(BanRequest)
+	if jsonError := CheckAdmin(state, params, req); jsonError != nil {
+		return nil, jsonError
+	}
+	if BanList == nil {
+		return nil, NewCustomInternalError("The p2p network is not running")
+	}
+
+	resp := new(BanLiftResponse)
+	resp.Address = req.Address
+	resp.Lifted = BanList.LiftBan(req.Address)
+	return resp, nil
+}
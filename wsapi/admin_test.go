@@ -0,0 +1,179 @@
+package wsapi_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/FactomProject/factomd/common/constants"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/p2p"
+	"github.com/FactomProject/factomd/testHelper"
+	. "github.com/FactomProject/factomd/wsapi"
+)
+
+func TestHandleV2Shutdown(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+
+	called := make(chan bool, 1)
+	ShutdownFunc = func() { called <- true }
+	defer func() { ShutdownFunc = nil }()
+
+	req := new(AdminRequest)
+	req.Password = "secret"
+
+	// No password configured, so the admin methods are disabled.
+	_, jsonError := HandleV2Shutdown(state, req)
+	if jsonError == nil || jsonError.Code != NewUnauthorizedError().Code {
+		t.Errorf("Expected an Unauthorized error with no admin password set, got %v", jsonError)
+	}
+
+	state.AdminPassword = "not the secret"
+	_, jsonError = HandleV2Shutdown(state, req)
+	if jsonError == nil || jsonError.Code != NewUnauthorizedError().Code {
+		t.Errorf("Expected an Unauthorized error with the wrong password, got %v", jsonError)
+	}
+
+	state.AdminPassword = "secret"
+	resp, jsonError := HandleV2Shutdown(state, req)
+	if jsonError != nil {
+		t.Errorf("%v", jsonError)
+	}
+	if resp.(*ShutdownResponse).Message != "Shutting down" {
+		t.Errorf("Unexpected response - %v", resp)
+	}
+	if !<-called {
+		t.Errorf("ShutdownFunc was not called")
+	}
+}
+
+func TestShuttingDownRefusesSubmissions(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.SetShuttingDown()
+
+	msg := new(MessageRequest)
+	msg.Message = "00"
+	req := primitives.NewJSON2Request("commit-chain", 0, msg)
+	_, jsonError := HandleV2Request(state, req)
+	if jsonError == nil || jsonError.Code != NewShuttingDownError().Code {
+		t.Errorf("Expected a commit to be refused while shutting down, got %v", jsonError)
+	}
+
+	req = primitives.NewJSON2Request("directory-block-height", 0, nil)
+	_, jsonError = HandleV2Request(state, req)
+	if jsonError != nil {
+		t.Errorf("Queries should still be answered while shutting down, got %v", jsonError)
+	}
+}
+
+func TestHandleV2ReplayCheck(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.AdminPassword = "secret"
+
+	hash := primitives.Sha([]byte("replay"))
+	req := map[string]interface{}{"password": "secret", "hash": hash.String()}
+
+	resp, jsonError := HandleV2ReplayCheck(state, req)
+	if jsonError != nil {
+		t.Fatalf("%v", jsonError)
+	}
+	if resp.(*ReplayCheckResponse).Found {
+		t.Errorf("Hash found before it was seen - %v", resp)
+	}
+
+	state.Replay.IsTSValid(constants.NETWORK_REPLAY, hash, state.GetTimestamp())
+	resp, jsonError = HandleV2ReplayCheck(state, req)
+	if jsonError != nil {
+		t.Fatalf("%v", jsonError)
+	}
+	r := resp.(*ReplayCheckResponse)
+	if !r.Found || !r.Network || r.Internal || r.Hour == 0 {
+		t.Errorf("Unexpected response - %v", r)
+	}
+
+	req["password"] = "wrong"
+	_, jsonError = HandleV2ReplayCheck(state, req)
+	if jsonError == nil || jsonError.Code != NewUnauthorizedError().Code {
+		t.Errorf("Expected an Unauthorized error with the wrong password, got %v", jsonError)
+	}
+
+	req["password"] = "secret"
+	req["hash"] = "xyz"
+	_, jsonError = HandleV2ReplayCheck(state, req)
+	if jsonError == nil || jsonError.Code != NewInvalidHashError().Code {
+		t.Errorf("Expected an Invalid Hash error, got %v", jsonError)
+	}
+}
+
+type testBanList struct {
+	bans []p2p.Ban
+}
+
+func (b *testBanList) Bans() []p2p.Ban {
+	return b.bans
+}
+
+func (b *testBanList) BanAddress(address string, reason string) (p2p.Ban, error) {
+	if address == "bad" {
+		return p2p.Ban{}, fmt.Errorf("bad address")
+	}
+	ban := p2p.Ban{Address: address, Reason: reason, Source: p2p.BanSourceOperator}
+	b.bans = append(b.bans, ban)
+	return ban, nil
+}
+
+func (b *testBanList) LiftBan(address string) bool {
+	for i, ban := range b.bans {
+		if ban.Address == address {
+			b.bans = append(b.bans[:i], b.bans[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestHandleV2Bans(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.AdminPassword = "secret"
+
+	bans := new(testBanList)
+	BanList = bans
+	defer func() { BanList = nil }()
+
+	_, jsonError := HandleV2BanAdd(state, map[string]interface{}{"password": "wrong", "address": "10.0.0.1"})
+	if jsonError == nil || jsonError.Code != NewUnauthorizedError().Code {
+		t.Errorf("Expected an Unauthorized error with the wrong password, got %v", jsonError)
+	}
+
+	_, jsonError = HandleV2BanAdd(state, map[string]interface{}{"password": "secret", "address": "bad"})
+	if jsonError == nil || jsonError.Code != NewInvalidParamsError().Code {
+		t.Errorf("Expected an Invalid params error for a bad address, got %v", jsonError)
+	}
+
+	resp, jsonError := HandleV2BanAdd(state, map[string]interface{}{"password": "secret", "address": "10.0.0.1"})
+	if jsonError != nil {
+		t.Fatalf("%v", jsonError)
+	}
+	if ban := resp.(*BanListResponse).Bans[0]; ban.Address != "10.0.0.1" || ban.Reason != "Banned by operator" {
+		t.Errorf("Unexpected ban - %v", ban)
+	}
+
+	resp, jsonError = HandleV2BanList(state, map[string]interface{}{"password": "secret"})
+	if jsonError != nil {
+		t.Fatalf("%v", jsonError)
+	}
+	if len(resp.(*BanListResponse).Bans) != 1 {
+		t.Errorf("Expected 1 ban, got %v", resp)
+	}
+
+	resp, jsonError = HandleV2BanLift(state, map[string]interface{}{"password": "secret", "address": "10.0.0.1"})
+	if jsonError != nil {
+		t.Fatalf("%v", jsonError)
+	}
+	if !resp.(*BanLiftResponse).Lifted || len(bans.bans) != 0 {
+		t.Errorf("Ban was not lifted - %v", resp)
+	}
+	resp, _ = HandleV2BanLift(state, map[string]interface{}{"password": "secret", "address": "10.0.0.1"})
+	if resp.(*BanLiftResponse).Lifted {
+		t.Errorf("Lifted a ban that wasn't there")
+	}
+}
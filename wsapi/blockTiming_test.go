@@ -0,0 +1,42 @@
+package wsapi_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/testHelper"
+	. "github.com/FactomProject/factomd/wsapi"
+)
+
+func TestHandleV2BlockTiming(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.BlockTimings = nil
+	for i := uint32(0); i < 20; i++ {
+		state.TimeProcess(i, 1, time.Millisecond)
+	}
+
+	resp, jsonError := HandleV2BlockTiming(state, nil)
+	if jsonError != nil {
+		t.Fatalf("%v", jsonError)
+	}
+	timings := resp.(*BlockTimingResponse).Timings
+	if len(timings) != 10 || timings[9].DBHeight != 19 || timings[9].Minutes[1].ProcessMicro != 1000 {
+		t.Errorf("Unexpected response - %v", timings)
+	}
+
+	req := new(BlockTimingRequest)
+	req.Count = 3
+	resp, jsonError = HandleV2BlockTiming(state, req)
+	if jsonError != nil {
+		t.Fatalf("%v", jsonError)
+	}
+	if len(resp.(*BlockTimingResponse).Timings) != 3 {
+		t.Errorf("Expected 3 blocks of timings, got %v", resp)
+	}
+
+	req.Count = -1
+	_, jsonError = HandleV2BlockTiming(state, req)
+	if jsonError == nil {
+		t.Errorf("Expected an error for a negative count")
+	}
+}
@@ -91,3 +91,9 @@ func NewMissingChainHeadError() *primitives.JSONError {
 func NewReceiptError() *primitives.JSONError {
 	return primitives.NewJSONError(-32010, "Receipt creation error", nil)
 }
+func NewUnauthorizedError() *primitives.JSONError {
+	return primitives.NewJSONError(-32011, "Unauthorized", nil)
+}
+func NewShuttingDownError() *primitives.JSONError {
+	return primitives.NewJSONError(-32012, "Server is shutting down", nil)
+}
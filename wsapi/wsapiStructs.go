@@ -7,6 +7,7 @@ package wsapi
 import (
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/p2p"
 	"github.com/FactomProject/factomd/receipts"
 )
 
@@ -102,6 +103,31 @@ type SendRawMessageResponse struct {
 	Message string `json:"message"`
 }
 
+type ShutdownResponse struct {
+	Message string `json:"message"`
+}
+
+type BanListResponse struct {
+	Bans []p2p.Ban `json:"bans"`
+}
+
+type BanLiftResponse struct {
+	Address string `json:"address"`
+	Lifted  bool   `json:"lifted"`
+}
+
+type BlockTimingResponse struct {
+	Timings []interfaces.BlockTiming `json:"timings"`
+}
+
+type ReplayCheckResponse struct {
+	Hash     string `json:"hash"`
+	Found    bool   `json:"found"`
+	Internal bool   `json:"internal"`
+	Network  bool   `json:"network"`
+	Hour     int64  `json:"hour"` // Unix time of the start of the hour the hash is filed under
+}
+
 /*********************************************************************/
 
 type DBHead struct {
@@ -219,3 +245,16 @@ type TransactionRequest struct {
 type SendRawMessageRequest struct {
 	Message string `json:"message"`
 }
+
+type BlockTimingRequest struct {
+	Count int `json:"count"`
+}
+
+type AdminRequest struct {
+	Password string `json:"password"`
+}
+
+type BanRequest struct {
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+}
@@ -55,6 +55,9 @@ func HandleV2Request(state interfaces.IState, j *primitives.JSON2Request) (*prim
 	var resp interface{}
 	var jsonError *primitives.JSONError
 	params := j.Params
+	if state.IsShuttingDown() && IsSubmission(j.Method) {
+		return nil, NewShuttingDownError()
+	}
 	switch j.Method {
 	case "chain-head":
 		resp, jsonError = HandleV2ChainHead(state, params)
@@ -101,6 +104,9 @@ func HandleV2Request(state interfaces.IState, j *primitives.JSON2Request) (*prim
 	case "properties":
 		resp, jsonError = HandleV2Properties(state, params)
 		break
+	case "block-timing":
+		resp, jsonError = HandleV2BlockTiming(state, params)
+		break
 	case "reveal-chain":
 		resp, jsonError = HandleV2RevealChain(state, params)
 		break
@@ -119,6 +125,21 @@ func HandleV2Request(state interfaces.IState, j *primitives.JSON2Request) (*prim
 	case "get-transaction":
 		resp, jsonError = HandleV2GetTranasction(state, params)
 		break
+	case "shutdown":
+		resp, jsonError = HandleV2Shutdown(state, params)
+		break
+	case "ban-list":
+		resp, jsonError = HandleV2BanList(state, params)
+		break
+	case "ban-add":
+		resp, jsonError = HandleV2BanAdd(state, params)
+		break
+	case "ban-lift":
+		resp, jsonError = HandleV2BanLift(state, params)
+		break
+	case "replay-check":
+		resp, jsonError = HandleV2ReplayCheck(state, params)
+		break
 	default:
 		jsonError = NewMethodNotFoundError()
 		break
@@ -616,6 +637,24 @@ func HandleV2Properties(state interfaces.IState, params interface{}) (interface{
 	return p, nil
 }
 
+func HandleV2BlockTiming(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
+	req := new(BlockTimingRequest)
+	err := MapToObject(params, req)
+	if err != nil {
+		return nil, NewInvalidParamsError()
+	}
+	if req.Count < 0 {
+		return nil, NewInvalidParamsError()
+	}
+	if req.Count == 0 {
+		req.Count = 10
+	}
+
+	resp := new(BlockTimingResponse)
+	resp.Timings = state.GetBlockTimings(req.Count)
+	return resp, nil
+}
+
 func HandleV2SendRawMessage(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
 	r := new(SendRawMessageRequest)
 	err := MapToObject(params, r)